@@ -0,0 +1,37 @@
+package v1alpha1
+
+// status.conditions的type
+const (
+	// ConditionReady 所有子资源都已处理成功
+	ConditionReady = "Ready"
+	// ConditionProgressing 正在处理中，如deployment正在滚动更新
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded 处理失败
+	ConditionDegraded = "Degraded"
+
+	// 子资源的condition
+	ConditionServiceReady          = "ServiceReady"
+	ConditionIngressReady          = "IngressReady"
+	ConditionDeploymentReady       = "DeploymentReady"
+	ConditionPVCReady              = "PVCReady"
+	ConditionVirtualServiceReady   = "VirtualServiceReady"
+	ConditionDestinationRuleReady  = "DestinationRuleReady"
+	ConditionScrapeReady           = "ScrapeReady"
+	ConditionAutoscalerReady       = "AutoscalerReady"
+	ConditionDisruptionBudgetReady = "DisruptionBudgetReady"
+	// 灰度分析是否正常进行，配置了canary.analysis时才有
+	ConditionCanaryAnalysisReady = "CanaryAnalysisReady"
+)
+
+// status.conditions的reason
+const (
+	ReasonReconcileSucceeded = "ReconcileSucceeded"
+	ReasonReconcileFailed    = "ReconcileFailed"
+	// deployment滚动更新相关
+	ReasonRolloutInProgress        = "RolloutInProgress"
+	ReasonRolloutComplete          = "RolloutComplete"
+	ReasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+	// 灰度分析相关，灰度发布停在当前步骤
+	ReasonCanaryMetricsUnavailable   = "CanaryMetricsUnavailable"
+	ReasonCanaryAnalysisInconclusive = "CanaryAnalysisInconclusive"
+)
@@ -17,8 +17,11 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -32,8 +35,61 @@ type SQBApplicationSpec struct {
 	IngressSpec `json:",inline"`
 	ServiceSpec `json:",inline"`
 	DeploySpec  `json:",inline"`
+	// 删除SQBApplication时对子资源的处理方式
+	// +kubebuilder:default:=Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// 删除时保留的子资源类型，对应的SQBDeployment删除时同样保留
+	RetainResources []ResourceKind `json:"retainResources,omitempty"`
+	// 请求匹配位面的方式，覆盖operator配置的planeRouting
+	PlaneRouting *PlaneRoutingSpec `json:"planeRouting,omitempty"`
 }
 
+// PlaneRoutingSpec 请求匹配位面的方式，未配置的项沿用上一层的配置，默认使用x-env-flag
+type PlaneRoutingSpec struct {
+	// 按顺序生成virtualservice的match，满足任意一个即转发到位面，默认为x-env-flag的header、query参数和version source label
+	Matches []PlaneRouteMatch `json:"matches,omitempty"`
+	// 转发到位面时设置的请求header，值为位面名称，下游服务可以继续按header匹配位面，默认为x-env-flag
+	PropagateHeaders []string `json:"propagateHeaders,omitempty"`
+	// 为true时不设置propagateHeaders，例如请求中已经带有链路追踪的header
+	DisablePropagation *bool `json:"disablePropagation,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=header;query;cookie;sourceLabel;jwtClaim
+type PlaneRouteMatchType string
+
+const (
+	PlaneRouteMatchHeader      PlaneRouteMatchType = "header"
+	PlaneRouteMatchQuery       PlaneRouteMatchType = "query"
+	PlaneRouteMatchCookie      PlaneRouteMatchType = "cookie"
+	PlaneRouteMatchSourceLabel PlaneRouteMatchType = "sourceLabel"
+	// 需要在istio中配置RequestAuthentication
+	PlaneRouteMatchJWTClaim PlaneRouteMatchType = "jwtClaim"
+)
+
+type PlaneRouteMatch struct {
+	Type PlaneRouteMatchType `json:"type"`
+	// header名称、query参数名称、cookie名称、调用方pod的label或者JWT claim名称，值为位面名称
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+}
+
+// DeletionPolicy 删除对象时的处理方式
+// Protect: 禁止删除，只有带正确的qa.shouqianba.com/delete注解才能删除
+// Delete: 删除时清理所有子资源
+// Orphan: 删除时保留子资源
+// +kubebuilder:validation:Enum=Protect;Delete;Orphan
+type DeletionPolicy string
+
+// ResourceKind operator管理的子资源类型
+// +kubebuilder:validation:Enum=Service;Ingress;VirtualService;DestinationRule;ServiceMonitor;VMServiceScrape;Deployment;PersistentVolumeClaim;HorizontalPodAutoscaler;PodDisruptionBudget
+type ResourceKind string
+
+const (
+	DeletionPolicyProtect DeletionPolicy = "Protect"
+	DeletionPolicyDelete  DeletionPolicy = "Delete"
+	DeletionPolicyOrphan  DeletionPolicy = "Orphan"
+)
+
 type IngressSpec struct {
 	Domains  []Domain  `json:"domains,omitempty"`
 	Subpaths []Subpath `json:"subpaths,omitempty"`
@@ -68,6 +124,57 @@ type DeploySpec struct {
 	Volumes      []*VolumeSpec                `json:"volumes,omitempty"`
 	NodeAffinity *NodeAffinity                `json:"nodeAffinity,omitempty"`
 	Lifecycle    *Lifecycle                   `json:"lifecycle,omitempty"`
+	// 配置后operator为deployment创建HPA，并且不再管理deployment的副本数
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+	// 配置后operator为deployment创建PodDisruptionBudget
+	DisruptionBudget *DisruptionBudgetSpec `json:"disruptionBudget,omitempty"`
+	// 与主容器一起部署的sidecar容器，名称不能与主容器相同
+	Sidecars []SidecarSpec `json:"sidecars,omitempty"`
+}
+
+// SidecarSpec sidecar容器的配置
+type SidecarSpec struct {
+	// 格式与pod的containers一致，不校验容器的字段避免CRD过大
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Container corev1.Container `json:"container"`
+	// 为true时使用主容器的env，sidecar中配置的同名env优先
+	ShareEnv bool `json:"shareEnv,omitempty"`
+	// 为true时挂载主容器的volumeMounts，sidecar中配置的相同mountPath优先
+	ShareVolumeMounts bool `json:"shareVolumeMounts,omitempty"`
+}
+
+// AutoscalingSpec HorizontalPodAutoscaler的配置，operator使用autoscaling/v2beta2创建HPA，
+// 该版本在Kubernetes 1.26中已经移除，只支持1.25及以下的集群
+type AutoscalingSpec struct {
+	// 为true时不创建HPA，用于覆盖SQBApplication中的配置
+	Disabled bool `json:"disabled,omitempty"`
+	// 默认为1
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// 启用时必须配置
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+	// CPU平均使用率目标，相对于requests的百分比
+	// +kubebuilder:validation:Minimum=1
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// 内存平均使用率目标，相对于requests的百分比
+	// +kubebuilder:validation:Minimum=1
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+	// 自定义指标，格式与HPA的spec.metrics一致
+	Metrics []autoscalingv2beta2.MetricSpec `json:"metrics,omitempty"`
+}
+
+// DisruptionBudgetSpec PodDisruptionBudget的配置，minAvailable和maxUnavailable最多配置一个，
+// 都不配置时根据所属环境使用默认值
+type DisruptionBudgetSpec struct {
+	// 为true时不创建PodDisruptionBudget，用于覆盖SQBApplication中的配置
+	Disabled bool `json:"disabled,omitempty"`
+	// 数字或者百分比
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// 数字或者百分比
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
 }
 
 type VolumeSpec struct {
@@ -106,6 +213,14 @@ type InitHandler struct {
 	Exec *corev1.ExecAction `json:"exec"`
 }
 
+// KubevelaSkippedResource 由kubevela管理，operator跳过处理的子资源
+type KubevelaSkippedResource struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// kubevela最近一次apply的时间，来自app.oam.dev/last-applied-time注解
+	LastAppliedTime string `json:"lastAppliedTime,omitempty"`
+}
+
 // SQBApplicationStatus defines the observed state of SQBApplication
 type SQBApplicationStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -114,6 +229,17 @@ type SQBApplicationStatus struct {
 	Planes    map[string]int `json:"planes,omitempty"`
 	Mirrors   map[string]int `json:"mirrors,omitempty"`
 	ErrorInfo string         `json:"errorInfo,omitempty"`
+	// 灰度发布中的位面 -> 转发到该位面的流量百分比，由SQBDeployment的status.canary汇总
+	CanaryWeights map[string]int32 `json:"canaryWeights,omitempty"`
+	// 最近一次处理的metadata.generation
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// 最近一次处理成功时spec、operator配置等的hash，operator重启后hash不变的对象不再处理
+	ObservedHash string `json:"observedHash,omitempty"`
+	// 因为由kubevela管理而没有修改或删除的子资源
+	KubevelaSkipped []KubevelaSkippedResource `json:"kubevelaSkipped,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -148,6 +274,8 @@ func (old *SQBApplication) Merge(news *SQBApplication) {
 	old.Spec.Subpaths = news.Spec.Subpaths
 	// ports用新的覆盖
 	old.Spec.Ports = news.Spec.Ports
+	// planeRouting用新的覆盖
+	old.Spec.PlaneRouting = news.Spec.PlaneRouting
 	// deploy去重
 	old.Spec.DeploySpec.merge(&news.Spec.DeploySpec)
 }
@@ -182,6 +310,108 @@ func (old *DeploySpec) merge(news *DeploySpec) {
 		old.NodeAffinity = news.NodeAffinity
 	}
 	old.Lifecycle = news.Lifecycle
+	if news.Autoscaling != nil {
+		autoscaling := &AutoscalingSpec{}
+		if old.Autoscaling != nil {
+			autoscaling = old.Autoscaling.DeepCopy()
+		}
+		autoscaling.merge(news.Autoscaling)
+		old.Autoscaling = autoscaling
+	}
+	if news.DisruptionBudget != nil {
+		old.DisruptionBudget = news.DisruptionBudget
+	}
+	if len(news.Sidecars) != 0 {
+		old.Sidecars = news.Sidecars
+	}
+}
+
+// autoscaling逐个字段覆盖，disabled总是使用新的值
+func (old *AutoscalingSpec) merge(news *AutoscalingSpec) {
+	old.Disabled = news.Disabled
+	if news.MinReplicas != nil {
+		old.MinReplicas = news.MinReplicas
+	}
+	if news.MaxReplicas != 0 {
+		old.MaxReplicas = news.MaxReplicas
+	}
+	if news.TargetCPUUtilizationPercentage != nil {
+		old.TargetCPUUtilizationPercentage = news.TargetCPUUtilizationPercentage
+	}
+	if news.TargetMemoryUtilizationPercentage != nil {
+		old.TargetMemoryUtilizationPercentage = news.TargetMemoryUtilizationPercentage
+	}
+	if len(news.Metrics) != 0 {
+		old.Metrics = news.Metrics
+	}
+}
+
+// AutoscalingEnabled 是否为deployment创建HPA
+func (d *DeploySpec) AutoscalingEnabled() bool {
+	return d.Autoscaling != nil && !d.Autoscaling.Disabled
+}
+
+// DisruptionBudgetEnabled 是否为deployment创建PodDisruptionBudget
+func (d *DeploySpec) DisruptionBudgetEnabled() bool {
+	return d.DisruptionBudget != nil && !d.DisruptionBudget.Disabled
+}
+
+// Overlay 以news中设置了的字段覆盖当前配置，返回新的配置，不修改原配置
+// 与merge不同，news中没有设置healthCheck、lifecycle时保留原值，用于逐层继承
+func (old *DeploySpec) Overlay(news *DeploySpec) *DeploySpec {
+	result := old.DeepCopy()
+	if news == nil {
+		return result
+	}
+	news = news.DeepCopy()
+	healthCheck, lifecycle := result.HealthCheck, result.Lifecycle
+	result.merge(news)
+	if news.HealthCheck == nil {
+		result.HealthCheck = healthCheck
+	}
+	if news.Lifecycle == nil {
+		result.Lifecycle = lifecycle
+	}
+	return result
+}
+
+// Overlay 以news中设置了的字段覆盖当前配置，返回新的配置，不修改原配置
+func (old *PlaneRoutingSpec) Overlay(news *PlaneRoutingSpec) *PlaneRoutingSpec {
+	result := old.DeepCopy()
+	if news == nil {
+		return result
+	}
+	news = news.DeepCopy()
+	if len(news.Matches) != 0 {
+		result.Matches = news.Matches
+	}
+	if len(news.PropagateHeaders) != 0 {
+		result.PropagateHeaders = news.PropagateHeaders
+	}
+	if news.DisablePropagation != nil {
+		result.DisablePropagation = news.DisablePropagation
+	}
+	return result
+}
+
+// Validate 校验match的类型和key，operator configmap中的配置没有经过CRD的schema校验
+func (s *PlaneRoutingSpec) Validate() error {
+	for i, match := range s.Matches {
+		switch match.Type {
+		case PlaneRouteMatchHeader, PlaneRouteMatchQuery, PlaneRouteMatchCookie, PlaneRouteMatchSourceLabel, PlaneRouteMatchJWTClaim:
+		default:
+			return fmt.Errorf("matches[%d].type: unsupported value %q", i, match.Type)
+		}
+		if match.Key == "" {
+			return fmt.Errorf("matches[%d].key: required value", i)
+		}
+	}
+	for i, header := range s.PropagateHeaders {
+		if header == "" {
+			return fmt.Errorf("propagateHeaders[%d]: required value", i)
+		}
+	}
+	return nil
 }
 
 func init() {
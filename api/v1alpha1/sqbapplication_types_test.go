@@ -193,3 +193,51 @@ func TestPorts(t *testing.T) {
 	assert.Equal(t, len(old.Spec.Ports), 1)
 	assert.Equal(t, old.Spec.Ports[0].Port, int32(8080))
 }
+
+func TestOverlay(t *testing.T) {
+	app := &DeploySpec{
+		Replicas: proto.Int(2),
+		Image:    "app",
+		Env: []v1.EnvVar{
+			{
+				Name:  "a",
+				Value: "1",
+			},
+		},
+		HealthCheck: &v1.Probe{InitialDelaySeconds: 30},
+	}
+	deploy := &DeploySpec{
+		Image: "deploy",
+	}
+	result := app.Overlay(deploy)
+	assert.Equal(t, result.Image, "deploy")
+	assert.Equal(t, *result.Replicas, int32(2))
+	assert.Equal(t, len(result.Env), 1)
+	assert.Equal(t, result.HealthCheck.InitialDelaySeconds, int32(30))
+	// 不修改原配置
+	result.HealthCheck.InitialDelaySeconds = 10
+	assert.Equal(t, app.HealthCheck.InitialDelaySeconds, int32(30))
+	assert.Equal(t, app.Image, "app")
+}
+
+func TestOverlayAutoscaling(t *testing.T) {
+	app := &DeploySpec{Autoscaling: &AutoscalingSpec{MaxReplicas: 3}}
+	// 没有配置时继承
+	result := app.Overlay(&DeploySpec{})
+	assert.Equal(t, result.AutoscalingEnabled(), true)
+	assert.Equal(t, result.Autoscaling.MaxReplicas, int32(3))
+	// 覆盖为不启用
+	result = app.Overlay(&DeploySpec{Autoscaling: &AutoscalingSpec{Disabled: true}})
+	assert.Equal(t, result.AutoscalingEnabled(), false)
+	assert.Equal(t, result.Autoscaling.MaxReplicas, int32(3))
+	assert.Equal(t, (&DeploySpec{}).AutoscalingEnabled(), false)
+	// 逐个字段覆盖
+	minReplicas, targetCPU := int32(2), int32(60)
+	result = app.Overlay(&DeploySpec{Autoscaling: &AutoscalingSpec{MinReplicas: &minReplicas}})
+	result = result.Overlay(&DeploySpec{Autoscaling: &AutoscalingSpec{TargetCPUUtilizationPercentage: &targetCPU}})
+	assert.Equal(t, result.AutoscalingEnabled(), true)
+	assert.Equal(t, result.Autoscaling.MaxReplicas, int32(3))
+	assert.Equal(t, *result.Autoscaling.MinReplicas, int32(2))
+	assert.Equal(t, *result.Autoscaling.TargetCPUUtilizationPercentage, int32(60))
+	assert.Assert(t, app.Autoscaling.MinReplicas == nil)
+}
@@ -29,6 +29,106 @@ type SQBDeploymentSpec struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	Selector   Selector `json:"selector"`
 	DeploySpec `json:",inline"`
+	// 删除SQBDeployment时对子资源的处理方式
+	// +kubebuilder:default:=Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// 删除时保留的子资源类型
+	RetainResources []ResourceKind `json:"retainResources,omitempty"`
+	// 灰度发布：将没有匹配到特性环境的部分流量转发到当前位面，基础环境的SQBDeployment不能配置
+	Canary *CanarySpec `json:"canary,omitempty"`
+}
+
+// CanarySpec 按steps逐步提升转发到当前位面的流量，到达最后一步后保持最后的权重
+type CanarySpec struct {
+	// +kubebuilder:validation:MinItems=1
+	Steps []CanaryStep `json:"steps"`
+	// 灰度发布期间查询当前位面的错误率和延迟，超过阈值时回滚，需要配置operator的canaryMetricsAddress
+	Analysis *CanaryAnalysis `json:"analysis,omitempty"`
+}
+
+// CanaryAnalysis 每个interval查询一次指标，当前步骤的最近一次分析成功后才进入下一步
+type CanaryAnalysis struct {
+	// 分析间隔，同时是查询的时间窗口，默认1m
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// 允许的最大错误率，5xx请求的百分比，如"1"、"0.5"
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	MaxErrorRate string `json:"maxErrorRate,omitempty"`
+	// 允许的最大p99延迟
+	MaxLatency *metav1.Duration `json:"maxLatency,omitempty"`
+	// 连续失败的次数达到failureLimit时回滚，默认1
+	// +kubebuilder:validation:Minimum=1
+	FailureLimit int32 `json:"failureLimit,omitempty"`
+	// 自定义错误率查询，结果为百分比，可以使用{{.Namespace}}、{{.Name}}、{{.Plane}}、{{.Interval}}
+	ErrorRateQuery string `json:"errorRateQuery,omitempty"`
+	// 自定义延迟查询，结果单位为毫秒，变量同errorRateQuery
+	LatencyQuery string `json:"latencyQuery,omitempty"`
+}
+
+type CanaryStep struct {
+	// 转发到当前位面的流量百分比
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+	// 保持当前权重的时间，之后自动进入下一步；不配置时停在这一步，修改steps后继续
+	Pause *metav1.Duration `json:"pause,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Progressing;Paused;Completed;RolledBack
+type CanaryPhase string
+
+const (
+	CanaryPhaseProgressing CanaryPhase = "Progressing"
+	// 当前步骤没有配置pause，等待修改steps
+	CanaryPhasePaused CanaryPhase = "Paused"
+	// 已经到达最后一步
+	CanaryPhaseCompleted CanaryPhase = "Completed"
+	// 分析失败，权重回到0，修改spec后重新开始
+	CanaryPhaseRolledBack CanaryPhase = "RolledBack"
+)
+
+// +kubebuilder:validation:Enum=Succeeded;Failed;Inconclusive
+type CanaryAnalysisResult string
+
+const (
+	CanaryAnalysisSucceeded CanaryAnalysisResult = "Succeeded"
+	// 超过阈值，计入失败次数
+	CanaryAnalysisFailed CanaryAnalysisResult = "Failed"
+	// 查询失败或者没有数据，不推进，连续3次计入一次失败
+	CanaryAnalysisInconclusive CanaryAnalysisResult = "Inconclusive"
+)
+
+// CanaryAnalysisRun 一次分析的结果
+type CanaryAnalysisRun struct {
+	Step   int32       `json:"step"`
+	Weight int32       `json:"weight"`
+	Time   metav1.Time `json:"time"`
+	// 错误率，百分比
+	ErrorRate string `json:"errorRate,omitempty"`
+	// p99延迟
+	Latency string               `json:"latency,omitempty"`
+	Result  CanaryAnalysisResult `json:"result"`
+	Message string               `json:"message,omitempty"`
+}
+
+// CanaryStatus 灰度发布的进度
+type CanaryStatus struct {
+	// 当前步骤，从0开始
+	Step int32 `json:"step"`
+	// 当前转发到位面的流量百分比
+	Weight int32 `json:"weight"`
+	// 进入当前步骤的时间
+	StepStartTime metav1.Time `json:"stepStartTime"`
+	Phase         CanaryPhase `json:"phase"`
+	// 当前步骤连续分析失败的次数
+	Failures int32 `json:"failures,omitempty"`
+	// 当前步骤连续无法得出结论(Inconclusive)的次数，达到3次时计入一次失败
+	Inconclusive int32 `json:"inconclusive,omitempty"`
+	// 最近的分析结果，最多保留10条
+	Analysis []CanaryAnalysisRun `json:"analysis,omitempty"`
+	// 回滚时的metadata.generation，spec修改后重新开始灰度发布
+	RollbackGeneration int64 `json:"rollbackGeneration,omitempty"`
+	// spec.canary.steps的hash，steps修改后从第一步重新开始
+	StepsHash string `json:"stepsHash,omitempty"`
 }
 
 type Selector struct {
@@ -41,8 +141,40 @@ type SQBDeploymentStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	ErrorInfo string `json:"errorInfo,omitempty"`
+	// 实际生效的部署配置，由operator configmap默认配置、SQBApplication、SQBDeployment逐层覆盖得到
+	DeploySpec *DeploySpec `json:"deploySpec,omitempty"`
+	// 同deployment的副本数
+	Replicas          int32 `json:"replicas,omitempty"`
+	ReadyReplicas     int32 `json:"readyReplicas,omitempty"`
+	UpdatedReplicas   int32 `json:"updatedReplicas,omitempty"`
+	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
+	// deployment当前使用的镜像
+	Image string `json:"image,omitempty"`
+	// deployment滚动更新的阶段
+	Phase RolloutPhase `json:"phase,omitempty"`
+	// 最近一次处理的metadata.generation
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// 最近一次处理成功时spec、operator配置等的hash，operator重启后hash不变的对象不再处理
+	ObservedHash string `json:"observedHash,omitempty"`
+	// 因为由kubevela管理而没有修改或删除的子资源
+	KubevelaSkipped []KubevelaSkippedResource `json:"kubevelaSkipped,omitempty"`
+	// 灰度发布的进度，没有配置canary时为空
+	Canary *CanaryStatus `json:"canary,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// +kubebuilder:validation:Enum=Progressing;Complete;Failed
+type RolloutPhase string
+
+const (
+	RolloutPhaseProgressing RolloutPhase = "Progressing"
+	RolloutPhaseComplete    RolloutPhase = "Complete"
+	// 超过progressDeadlineSeconds仍未完成
+	RolloutPhaseFailed RolloutPhase = "Failed"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 
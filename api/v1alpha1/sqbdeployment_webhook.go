@@ -19,43 +19,38 @@ package v1alpha1
 import (
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
-	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
-// log is for logging in this package.
-var sqbdeploymentlog = logf.Log.WithName("sqbdeployment-resource")
+// SQBDeployment的校验已经移到github.com/wosai/elastic-env-operator/webhooks，
+// 这里只保留原来的方法，兼容引用了api模块的代码
 
-func (r *SQBDeployment) SetupWebhookWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewWebhookManagedBy(mgr).
-		For(r).
-		Complete()
+// SetupWebhookWithManager 不再注册webhook，避免和webhooks包注册的path冲突
+//
+// Deprecated: 使用webhooks.SetupWebhookWithManager
+func (r *SQBDeployment) SetupWebhookWithManager(_ ctrl.Manager) error {
+	return nil
 }
 
-// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-
-// TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
-// +kubebuilder:webhook:verbs=update,path=/validate-qa-shouqianba-com-v1alpha1-sqbdeployment,mutating=false,failurePolicy=fail,groups=qa.shouqianba.com,resources=sqbdeployments,versions=v1alpha1,name=vsqbdeployment.kb.io
-
 var _ webhook.Validator = &SQBDeployment{}
 
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+// ValidateCreate implements webhook.Validator
+//
+// Deprecated: 由webhooks包校验
 func (r *SQBDeployment) ValidateCreate() error {
 	return nil
 }
 
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *SQBDeployment) ValidateUpdate(old runtime.Object) error {
-	sqbdeploymentlog.Info("validate update", "name", r.Name)
-	oldcr := old.(*SQBDeployment)
-	if r.Spec.Selector.App != oldcr.Spec.Selector.App ||
-		r.Spec.Selector.Plane != oldcr.Spec.Selector.Plane {
-		sqbdeploymentlog.Info("sqbdeployment selector updated", "name", r.Name)
-	}
+// ValidateUpdate implements webhook.Validator
+//
+// Deprecated: 由webhooks包校验
+func (r *SQBDeployment) ValidateUpdate(_ runtime.Object) error {
 	return nil
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+// ValidateDelete implements webhook.Validator
+//
+// Deprecated: 由webhooks包校验
 func (r *SQBDeployment) ValidateDelete() error {
 	return nil
 }
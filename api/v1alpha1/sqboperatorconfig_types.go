@@ -0,0 +1,190 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"strconv"
+	"strings"
+)
+
+// operator namespace下名为operator-config的SQBOperatorConfig为全局配置，其他namespace下的为覆盖配置
+const OperatorConfigName = "operator-config"
+
+// SQBOperatorConfigSpec defines the desired state of SQBOperatorConfig
+// 字段含义与operator-configmap的同名配置项一致，未配置的项使用默认值
+type SQBOperatorConfigSpec struct {
+	// 默认是否开启ingress
+	IngressOpen *bool `json:"ingressOpen,omitempty"`
+	// 默认是否启用istio
+	IstioInject *bool `json:"istioInject,omitempty"`
+	// 集群是否安装istio
+	IstioEnable *bool `json:"istioEnable,omitempty"`
+	// 集群是否启用istio-ingressgateway
+	IstioIngressGateway *bool `json:"istioIngressGateway,omitempty"`
+	// 是否根据位面生成virtualservice和destinationrule
+	IstioRoutingEnable *bool `json:"istioRoutingEnable,omitempty"`
+	// 请求匹配位面的方式，SQBApplication的planeRouting可以覆盖
+	PlaneRouting *PlaneRoutingSpec `json:"planeRouting,omitempty"`
+	// istio超时时间，单位秒
+	// +kubebuilder:validation:Minimum=1
+	IstioTimeout *int64 `json:"istioTimeout,omitempty"`
+	// virtualservice的gateways
+	IstioGateways []string `json:"istioGateways,omitempty"`
+	// 集群是否安装prometheus，与victoriaMetricsEnable互斥
+	ServiceMonitorEnable *bool `json:"serviceMonitorEnable,omitempty"`
+	// 集群是否安装victoria metrics
+	VictoriaMetricsEnable *bool `json:"victoriaMetricsEnable,omitempty"`
+	// 灰度分析查询的prometheus兼容接口地址，如http://vmselect:8481/select/0/prometheus
+	CanaryMetricsAddress string `json:"canaryMetricsAddress,omitempty"`
+	// 集群是否使用PVC
+	PVCEnable *bool `json:"pvcEnable,omitempty"`
+	// ingress class -> 域名后缀，*会替换为应用名
+	DomainPostfix map[string]string `json:"domainPostfix,omitempty"`
+	// 默认的image pull secret
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+	// 特殊入口所在的ingress class
+	SpecialVirtualServiceIngress string `json:"specialVirtualServiceIngress,omitempty"`
+	// deployment的spec的默认配置
+	// +kubebuilder:pruning:PreserveUnknownFields
+	DeploymentSpec *runtime.RawExtension `json:"deploymentSpec,omitempty"`
+	// deploymentSpec生效的namespace，"*"表示所有namespace
+	DeploymentSpecNamespaces []string `json:"deploymentSpecNamespaces,omitempty"`
+	// SQBApplication deploy配置的默认值
+	DefaultDeploySpec *DeploySpec `json:"defaultDeploySpec,omitempty"`
+	// init container镜像
+	InitContainerImage string `json:"initContainerImage,omitempty"`
+	// 基础环境标识
+	BaseFlag string `json:"baseFlag,omitempty"`
+	// 所属环境
+	// +kubebuilder:validation:Enum=test;prod
+	Env string `json:"env,omitempty"`
+}
+
+// SQBOperatorConfigStatus defines the observed state of SQBOperatorConfig
+type SQBOperatorConfigStatus struct {
+	// 最近一次处理的metadata.generation
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// 解析、校验失败的配置项，存在错误时配置不会生效
+	Errors []string `json:"errors,omitempty"`
+	// 当前实际生效的配置，包括默认值
+	Effective map[string]string `json:"effective,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// SQBOperatorConfig is the Schema for the sqboperatorconfigs API
+type SQBOperatorConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SQBOperatorConfigSpec   `json:"spec,omitempty"`
+	Status SQBOperatorConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SQBOperatorConfigList contains a list of SQBOperatorConfig
+type SQBOperatorConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SQBOperatorConfig `json:"items"`
+}
+
+// ToConfigMapData 转换为operator-configmap的配置格式，只包含配置了的项
+func (s *SQBOperatorConfigSpec) ToConfigMapData() (map[string]string, error) {
+	data := make(map[string]string)
+	setBool := func(key string, b *bool) {
+		if b != nil {
+			data[key] = strconv.FormatBool(*b)
+		}
+	}
+	setString := func(key, value string) {
+		if value != "" {
+			data[key] = value
+		}
+	}
+	setJson := func(key string, v interface{}) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data[key] = string(b)
+		return nil
+	}
+
+	setBool("ingressOpen", s.IngressOpen)
+	setBool("istioInject", s.IstioInject)
+	setBool("istioEnable", s.IstioEnable)
+	setBool("istioIngressGateway", s.IstioIngressGateway)
+	setBool("istioRoutingEnable", s.IstioRoutingEnable)
+	setBool("serviceMonitorEnable", s.ServiceMonitorEnable)
+	setBool("victoriaMetricsEnable", s.VictoriaMetricsEnable)
+	setBool("pvcEnable", s.PVCEnable)
+	if s.IstioTimeout != nil {
+		data["istioTimeout"] = strconv.FormatInt(*s.IstioTimeout, 10)
+	}
+	if len(s.IstioGateways) != 0 {
+		if err := setJson("istioGateways", s.IstioGateways); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.DomainPostfix) != 0 {
+		if err := setJson("domainPostfix", s.DomainPostfix); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.DeploymentSpecNamespaces) != 0 {
+		if err := setJson("deploymentSpecNamespaces", s.DeploymentSpecNamespaces); err != nil {
+			return nil, err
+		}
+	}
+	if s.DefaultDeploySpec != nil {
+		if err := setJson("defaultDeploySpec", s.DefaultDeploySpec); err != nil {
+			return nil, err
+		}
+	}
+	if s.PlaneRouting != nil {
+		if err := s.PlaneRouting.Validate(); err != nil {
+			return nil, fmt.Errorf("planeRouting: %w", err)
+		}
+		if err := setJson("planeRouting", s.PlaneRouting); err != nil {
+			return nil, err
+		}
+	}
+	if s.DeploymentSpec != nil && len(s.DeploymentSpec.Raw) != 0 {
+		data["deploymentSpec"] = string(s.DeploymentSpec.Raw)
+	}
+	setString("imagePullSecrets", strings.Join(s.ImagePullSecrets, ","))
+	setString("specialVirtualServiceIngress", s.SpecialVirtualServiceIngress)
+	setString("initContainerImage", s.InitContainerImage)
+	setString("canaryMetricsAddress", s.CanaryMetricsAddress)
+	setString("baseFlag", s.BaseFlag)
+	setString("env", s.Env)
+	return data, nil
+}
+
+func init() {
+	SchemeBuilder.Register(&SQBOperatorConfig{}, &SQBOperatorConfigList{})
+}
@@ -0,0 +1,64 @@
+package v1alpha1
+
+import (
+	"gotest.tools/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"testing"
+)
+
+func TestToConfigMapData(t *testing.T) {
+	istioInject := true
+	timeout := int64(60)
+	replicas := int32(2)
+	spec := &SQBOperatorConfigSpec{
+		IstioInject:      &istioInject,
+		IstioTimeout:     &timeout,
+		IstioGateways:    []string{"mesh"},
+		DomainPostfix:    map[string]string{"nginx": "*.iwosai.com"},
+		ImagePullSecrets: []string{"reg-wosai", "reg-dev"},
+		DeploymentSpec:   &runtime.RawExtension{Raw: []byte(`{"replicas":2}`)},
+		DefaultDeploySpec: &DeploySpec{
+			Replicas: &replicas,
+		},
+		PlaneRouting: &PlaneRoutingSpec{
+			Matches: []PlaneRouteMatch{{Type: PlaneRouteMatchCookie, Key: "env"}},
+		},
+		BaseFlag: "stable",
+	}
+	data, err := spec.ToConfigMapData()
+	assert.NilError(t, err)
+	assert.Equal(t, data["istioInject"], "true")
+	assert.Equal(t, data["istioTimeout"], "60")
+	assert.Equal(t, data["istioGateways"], `["mesh"]`)
+	assert.Equal(t, data["domainPostfix"], `{"nginx":"*.iwosai.com"}`)
+	assert.Equal(t, data["imagePullSecrets"], "reg-wosai,reg-dev")
+	assert.Equal(t, data["deploymentSpec"], `{"replicas":2}`)
+	assert.Equal(t, data["defaultDeploySpec"], `{"replicas":2}`)
+	assert.Equal(t, data["baseFlag"], "stable")
+	assert.Equal(t, data["planeRouting"], `{"matches":[{"type":"cookie","key":"env"}]}`)
+	// 未配置的项不输出，使用默认值
+	_, ok := data["istioEnable"]
+	assert.Equal(t, ok, false)
+	_, ok = data["env"]
+	assert.Equal(t, ok, false)
+}
+
+func TestPlaneRoutingOverlay(t *testing.T) {
+	disabled := true
+	base := &PlaneRoutingSpec{
+		Matches:          []PlaneRouteMatch{{Type: PlaneRouteMatchHeader, Key: "x-env-flag"}},
+		PropagateHeaders: []string{"x-env-flag"},
+	}
+	result := base.Overlay(&PlaneRoutingSpec{DisablePropagation: &disabled})
+	assert.DeepEqual(t, result.Matches, base.Matches)
+	assert.Equal(t, *result.DisablePropagation, true)
+	assert.Assert(t, base.DisablePropagation == nil)
+
+	result = base.Overlay(&PlaneRoutingSpec{Matches: []PlaneRouteMatch{{Type: PlaneRouteMatchJWTClaim, Key: "env"}}})
+	assert.Equal(t, result.Matches[0].Type, PlaneRouteMatchJWTClaim)
+	assert.DeepEqual(t, result.PropagateHeaders, []string{"x-env-flag"})
+	assert.NilError(t, result.Validate())
+
+	assert.ErrorContains(t, (&PlaneRoutingSpec{Matches: []PlaneRouteMatch{{Type: "grpc", Key: "env"}}}).Validate(), "matches[0].type")
+	assert.ErrorContains(t, (&PlaneRoutingSpec{Matches: []PlaneRouteMatch{{Type: PlaneRouteMatchQuery}}}).Validate(), "matches[0].key")
+}
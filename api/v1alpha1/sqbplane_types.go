@@ -28,6 +28,27 @@ type SQBPlaneSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Description string `json:"description,omitempty"`
+	// 删除SQBPlane时对子资源的处理方式
+	// +kubebuilder:default:=Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// 存活时间，从创建或者最近一次续期(qa.shouqianba.com/lease-renew-time注解)开始计算
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// 过期时间，与ttl同时配置时取较早的时间
+	ExpireAt *metav1.Time `json:"expireAt,omitempty"`
+	// 所有deployment都没有ready副本的时间超过idleTimeout后删除
+	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
+	// 从另一个位面复制SQBDeployment，每个应用只复制一次
+	CloneFrom    string        `json:"cloneFrom,omitempty"`
+	CloneOptions *CloneOptions `json:"cloneOptions,omitempty"`
+}
+
+type CloneOptions struct {
+	// 只复制这些应用，为空表示复制全部应用
+	Include []string `json:"include,omitempty"`
+	// 不复制这些应用
+	Exclude []string `json:"exclude,omitempty"`
+	// 应用名 -> 镜像，覆盖复制出的SQBDeployment的镜像
+	ImageOverrides map[string]string `json:"imageOverrides,omitempty"`
 }
 
 // SQBPlaneStatus defines the observed state of SQBPlane
@@ -36,6 +57,17 @@ type SQBPlaneStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	Mirrors   map[string]int `json:"mirrors,omitempty"`
 	ErrorInfo string         `json:"errorInfo,omitempty"`
+	// 最近一次处理的metadata.generation
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// 根据ttl和expireAt计算出的过期时间
+	ExpireTime *metav1.Time `json:"expireTime,omitempty"`
+	// 开始空闲的时间，只有配置了idleTimeout才会记录
+	IdleSince *metav1.Time `json:"idleSince,omitempty"`
+	// 从cloneFrom位面复制创建的SQBDeployment
+	ClonedDeployments []string `json:"clonedDeployments,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -21,10 +21,193 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/autoscaling/v2beta2"
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoscalingSpec) DeepCopyInto(out *AutoscalingSpec) {
+	*out = *in
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetCPUUtilizationPercentage != nil {
+		in, out := &in.TargetCPUUtilizationPercentage, &out.TargetCPUUtilizationPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetMemoryUtilizationPercentage != nil {
+		in, out := &in.TargetMemoryUtilizationPercentage, &out.TargetMemoryUtilizationPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = make([]v2beta2.MetricSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingSpec.
+func (in *AutoscalingSpec) DeepCopy() *AutoscalingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryAnalysis) DeepCopyInto(out *CanaryAnalysis) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxLatency != nil {
+		in, out := &in.MaxLatency, &out.MaxLatency
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryAnalysis.
+func (in *CanaryAnalysis) DeepCopy() *CanaryAnalysis {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryAnalysis)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryAnalysisRun) DeepCopyInto(out *CanaryAnalysisRun) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryAnalysisRun.
+func (in *CanaryAnalysisRun) DeepCopy() *CanaryAnalysisRun {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryAnalysisRun)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanarySpec) DeepCopyInto(out *CanarySpec) {
+	*out = *in
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]CanaryStep, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Analysis != nil {
+		in, out := &in.Analysis, &out.Analysis
+		*out = new(CanaryAnalysis)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanarySpec.
+func (in *CanarySpec) DeepCopy() *CanarySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CanarySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryStatus) DeepCopyInto(out *CanaryStatus) {
+	*out = *in
+	in.StepStartTime.DeepCopyInto(&out.StepStartTime)
+	if in.Analysis != nil {
+		in, out := &in.Analysis, &out.Analysis
+		*out = make([]CanaryAnalysisRun, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryStatus.
+func (in *CanaryStatus) DeepCopy() *CanaryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryStep) DeepCopyInto(out *CanaryStep) {
+	*out = *in
+	if in.Pause != nil {
+		in, out := &in.Pause, &out.Pause
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryStep.
+func (in *CanaryStep) DeepCopy() *CanaryStep {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloneOptions) DeepCopyInto(out *CloneOptions) {
+	*out = *in
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ImageOverrides != nil {
+		in, out := &in.ImageOverrides, &out.ImageOverrides
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloneOptions.
+func (in *CloneOptions) DeepCopy() *CloneOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(CloneOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DeploySpec) DeepCopyInto(out *DeploySpec) {
 	*out = *in
@@ -88,6 +271,23 @@ func (in *DeploySpec) DeepCopyInto(out *DeploySpec) {
 		*out = new(Lifecycle)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(AutoscalingSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DisruptionBudget != nil {
+		in, out := &in.DisruptionBudget, &out.DisruptionBudget
+		*out = new(DisruptionBudgetSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Sidecars != nil {
+		in, out := &in.Sidecars, &out.Sidecars
+		*out = make([]SidecarSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeploySpec.
@@ -100,6 +300,31 @@ func (in *DeploySpec) DeepCopy() *DeploySpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DisruptionBudgetSpec) DeepCopyInto(out *DisruptionBudgetSpec) {
+	*out = *in
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DisruptionBudgetSpec.
+func (in *DisruptionBudgetSpec) DeepCopy() *DisruptionBudgetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DisruptionBudgetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Domain) DeepCopyInto(out *Domain) {
 	*out = *in
@@ -184,6 +409,21 @@ func (in *InitHandler) DeepCopy() *InitHandler {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubevelaSkippedResource) DeepCopyInto(out *KubevelaSkippedResource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubevelaSkippedResource.
+func (in *KubevelaSkippedResource) DeepCopy() *KubevelaSkippedResource {
+	if in == nil {
+		return nil
+	}
+	out := new(KubevelaSkippedResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Lifecycle) DeepCopyInto(out *Lifecycle) {
 	*out = *in
@@ -250,6 +490,51 @@ func (in *NodeSelector) DeepCopy() *NodeSelector {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaneRouteMatch) DeepCopyInto(out *PlaneRouteMatch) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaneRouteMatch.
+func (in *PlaneRouteMatch) DeepCopy() *PlaneRouteMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaneRouteMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaneRoutingSpec) DeepCopyInto(out *PlaneRoutingSpec) {
+	*out = *in
+	if in.Matches != nil {
+		in, out := &in.Matches, &out.Matches
+		*out = make([]PlaneRouteMatch, len(*in))
+		copy(*out, *in)
+	}
+	if in.PropagateHeaders != nil {
+		in, out := &in.PropagateHeaders, &out.PropagateHeaders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DisablePropagation != nil {
+		in, out := &in.DisablePropagation, &out.DisablePropagation
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaneRoutingSpec.
+func (in *PlaneRoutingSpec) DeepCopy() *PlaneRoutingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaneRoutingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SQBApplication) DeepCopyInto(out *SQBApplication) {
 	*out = *in
@@ -315,6 +600,16 @@ func (in *SQBApplicationSpec) DeepCopyInto(out *SQBApplicationSpec) {
 	in.IngressSpec.DeepCopyInto(&out.IngressSpec)
 	in.ServiceSpec.DeepCopyInto(&out.ServiceSpec)
 	in.DeploySpec.DeepCopyInto(&out.DeploySpec)
+	if in.RetainResources != nil {
+		in, out := &in.RetainResources, &out.RetainResources
+		*out = make([]ResourceKind, len(*in))
+		copy(*out, *in)
+	}
+	if in.PlaneRouting != nil {
+		in, out := &in.PlaneRouting, &out.PlaneRouting
+		*out = new(PlaneRoutingSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQBApplicationSpec.
@@ -344,6 +639,25 @@ func (in *SQBApplicationStatus) DeepCopyInto(out *SQBApplicationStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.CanaryWeights != nil {
+		in, out := &in.CanaryWeights, &out.CanaryWeights
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.KubevelaSkipped != nil {
+		in, out := &in.KubevelaSkipped, &out.KubevelaSkipped
+		*out = make([]KubevelaSkippedResource, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQBApplicationStatus.
@@ -362,7 +676,7 @@ func (in *SQBDeployment) DeepCopyInto(out *SQBDeployment) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQBDeployment.
@@ -420,6 +734,16 @@ func (in *SQBDeploymentSpec) DeepCopyInto(out *SQBDeploymentSpec) {
 	*out = *in
 	out.Selector = in.Selector
 	in.DeploySpec.DeepCopyInto(&out.DeploySpec)
+	if in.RetainResources != nil {
+		in, out := &in.RetainResources, &out.RetainResources
+		*out = make([]ResourceKind, len(*in))
+		copy(*out, *in)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(CanarySpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQBDeploymentSpec.
@@ -435,6 +759,28 @@ func (in *SQBDeploymentSpec) DeepCopy() *SQBDeploymentSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SQBDeploymentStatus) DeepCopyInto(out *SQBDeploymentStatus) {
 	*out = *in
+	if in.DeploySpec != nil {
+		in, out := &in.DeploySpec, &out.DeploySpec
+		*out = new(DeploySpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KubevelaSkipped != nil {
+		in, out := &in.KubevelaSkipped, &out.KubevelaSkipped
+		*out = make([]KubevelaSkippedResource, len(*in))
+		copy(*out, *in)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(CanaryStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQBDeploymentStatus.
@@ -447,12 +793,202 @@ func (in *SQBDeploymentStatus) DeepCopy() *SQBDeploymentStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SQBOperatorConfig) DeepCopyInto(out *SQBOperatorConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQBOperatorConfig.
+func (in *SQBOperatorConfig) DeepCopy() *SQBOperatorConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SQBOperatorConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SQBOperatorConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SQBOperatorConfigList) DeepCopyInto(out *SQBOperatorConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SQBOperatorConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQBOperatorConfigList.
+func (in *SQBOperatorConfigList) DeepCopy() *SQBOperatorConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(SQBOperatorConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SQBOperatorConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SQBOperatorConfigSpec) DeepCopyInto(out *SQBOperatorConfigSpec) {
+	*out = *in
+	if in.IngressOpen != nil {
+		in, out := &in.IngressOpen, &out.IngressOpen
+		*out = new(bool)
+		**out = **in
+	}
+	if in.IstioInject != nil {
+		in, out := &in.IstioInject, &out.IstioInject
+		*out = new(bool)
+		**out = **in
+	}
+	if in.IstioEnable != nil {
+		in, out := &in.IstioEnable, &out.IstioEnable
+		*out = new(bool)
+		**out = **in
+	}
+	if in.IstioIngressGateway != nil {
+		in, out := &in.IstioIngressGateway, &out.IstioIngressGateway
+		*out = new(bool)
+		**out = **in
+	}
+	if in.IstioRoutingEnable != nil {
+		in, out := &in.IstioRoutingEnable, &out.IstioRoutingEnable
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PlaneRouting != nil {
+		in, out := &in.PlaneRouting, &out.PlaneRouting
+		*out = new(PlaneRoutingSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IstioTimeout != nil {
+		in, out := &in.IstioTimeout, &out.IstioTimeout
+		*out = new(int64)
+		**out = **in
+	}
+	if in.IstioGateways != nil {
+		in, out := &in.IstioGateways, &out.IstioGateways
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceMonitorEnable != nil {
+		in, out := &in.ServiceMonitorEnable, &out.ServiceMonitorEnable
+		*out = new(bool)
+		**out = **in
+	}
+	if in.VictoriaMetricsEnable != nil {
+		in, out := &in.VictoriaMetricsEnable, &out.VictoriaMetricsEnable
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PVCEnable != nil {
+		in, out := &in.PVCEnable, &out.PVCEnable
+		*out = new(bool)
+		**out = **in
+	}
+	if in.DomainPostfix != nil {
+		in, out := &in.DomainPostfix, &out.DomainPostfix
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeploymentSpec != nil {
+		in, out := &in.DeploymentSpec, &out.DeploymentSpec
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeploymentSpecNamespaces != nil {
+		in, out := &in.DeploymentSpecNamespaces, &out.DeploymentSpecNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DefaultDeploySpec != nil {
+		in, out := &in.DefaultDeploySpec, &out.DefaultDeploySpec
+		*out = new(DeploySpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQBOperatorConfigSpec.
+func (in *SQBOperatorConfigSpec) DeepCopy() *SQBOperatorConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SQBOperatorConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SQBOperatorConfigStatus) DeepCopyInto(out *SQBOperatorConfigStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Errors != nil {
+		in, out := &in.Errors, &out.Errors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Effective != nil {
+		in, out := &in.Effective, &out.Effective
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQBOperatorConfigStatus.
+func (in *SQBOperatorConfigStatus) DeepCopy() *SQBOperatorConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SQBOperatorConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SQBPlane) DeepCopyInto(out *SQBPlane) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -509,6 +1045,25 @@ func (in *SQBPlaneList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SQBPlaneSpec) DeepCopyInto(out *SQBPlaneSpec) {
 	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.ExpireAt != nil {
+		in, out := &in.ExpireAt, &out.ExpireAt
+		*out = (*in).DeepCopy()
+	}
+	if in.IdleTimeout != nil {
+		in, out := &in.IdleTimeout, &out.IdleTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.CloneOptions != nil {
+		in, out := &in.CloneOptions, &out.CloneOptions
+		*out = new(CloneOptions)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQBPlaneSpec.
@@ -531,6 +1086,26 @@ func (in *SQBPlaneStatus) DeepCopyInto(out *SQBPlaneStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ExpireTime != nil {
+		in, out := &in.ExpireTime, &out.ExpireTime
+		*out = (*in).DeepCopy()
+	}
+	if in.IdleSince != nil {
+		in, out := &in.IdleSince, &out.IdleSince
+		*out = (*in).DeepCopy()
+	}
+	if in.ClonedDeployments != nil {
+		in, out := &in.ClonedDeployments, &out.ClonedDeployments
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQBPlaneStatus.
@@ -580,6 +1155,22 @@ func (in *ServiceSpec) DeepCopy() *ServiceSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SidecarSpec) DeepCopyInto(out *SidecarSpec) {
+	*out = *in
+	in.Container.DeepCopyInto(&out.Container)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SidecarSpec.
+func (in *SidecarSpec) DeepCopy() *SidecarSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SidecarSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Subpath) DeepCopyInto(out *Subpath) {
 	*out = *in
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"gotest.tools/assert"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// configGetterKeys SQBConfigMapEntity的方法读取的配置项，nil表示不影响子资源的渲染结果。
+// deploymentSpecNamespaces通过DeploymentSpecByNamespace的结果体现在deploymentSpec中
+var configGetterKeys = map[string][]string{
+	"FromMap":              nil,
+	"SetNamespaceOverride": nil,
+	"ForNamespace":         nil,
+	"ToString":             nil,
+	"IsInitialized":        nil,
+	// 只用于计算hash
+	"Effective":                    nil,
+	"GetDomainNames":               {"domainPostfix"},
+	"GetDomainNameByClass":         {"domainPostfix"},
+	"GetImagePullSecrets":          {"imagePullSecrets"},
+	"IstioTimeout":                 {"istioTimeout"},
+	"IstioGateways":                {"istioGateways"},
+	"IngressOpen":                  {"ingressOpen"},
+	"IstioEnable":                  {"istioEnable"},
+	"IstioInject":                  {"istioInject"},
+	"HasIstioIngressGateway":       {"istioEnable", "istioIngressGateway"},
+	"IstioRoutingEnable":           {"istioEnable", "istioRoutingEnable"},
+	"IsServiceMonitorEnable":       {"serviceMonitorEnable"},
+	"IsVictoriaMetricsEnable":      {"serviceMonitorEnable", "victoriaMetricsEnable"},
+	"IsPVCEnable":                  {"pvcEnable"},
+	"CanaryMetricsAddress":         {"canaryMetricsAddress"},
+	"SpecialVirtualServiceIngress": {"specialVirtualServiceIngress"},
+	"DeploymentSpec":               {"deploymentSpec"},
+	"DeploymentSpecByNamespace":    {"deploymentSpec"},
+	"DefaultDeploySpec":            {"defaultDeploySpec"},
+	"PlaneRouting":                 {"planeRouting"},
+	"InitContainerImage":           {"initContainerImage"},
+	"BaseFlag":                     {"baseFlag"},
+	"Env":                          {"env"},
+}
+
+// handlerFiles domain/handler下的文件由哪些资源的处理使用，新增文件时需要在这里登记
+var handlerFiles = map[string]struct{ application, deployment bool }{
+	"canary.go":                         {application: true, deployment: true},
+	"canary_analysis.go":                {deployment: true},
+	"deployment_handler.go":             {deployment: true},
+	"destinationrule_handler.go":        {application: true},
+	"handler.go":                        {application: true, deployment: true},
+	"hpa_handler.go":                    {deployment: true},
+	"ingress_handler.go":                {application: true, deployment: true},
+	"kubevela.go":                       {application: true, deployment: true},
+	"metrics.go":                        {application: true, deployment: true},
+	"pdb_handler.go":                    {deployment: true},
+	"plane_routing.go":                  {application: true, deployment: true},
+	"pvc_handler.go":                    {deployment: true},
+	"service_handler.go":                {application: true},
+	"service_monitor_handler.go":        {application: true},
+	"special_virtualservice_handler.go": {deployment: true},
+	"sqbapplication_handler.go":         {application: true},
+	"sqbdeployment_handler.go":          {deployment: true},
+	"sqbdeploymentlist_handler.go":      {application: true},
+	"sqbplane_handler.go":               {},
+	"virtualservice_handler.go":         {application: true},
+	"vmservice_scrape_handler.go":       {application: true},
+}
+
+func TestConfigGetterKeys(t *testing.T) {
+	// SQBConfigMapEntity新增方法时需要登记读取的配置项
+	entityType := reflect.TypeOf(&entity.SQBConfigMapEntity{})
+	for i := 0; i < entityType.NumMethod(); i++ {
+		name := entityType.Method(i).Name
+		_, ok := configGetterKeys[name]
+		assert.Assert(t, ok, "method %s is not registered in configGetterKeys", name)
+	}
+}
+
+// 子资源handler读取的配置项都需要在applicationConfigKeys或者deploymentConfigKeys中，否则配置修改后不会重新处理
+func TestConfigKeysReadByHandlers(t *testing.T) {
+	files, err := filepath.Glob("../domain/handler/*.go")
+	assert.NilError(t, err)
+	// 每个文件直接读取的配置项和调用的包级函数
+	fileKeys := make(map[string]map[string]bool)
+	fileCalls := make(map[string]map[string]bool)
+	// 包级函数直接读取的配置项和调用的包级函数，例如IsIstioInject
+	funcKeys := make(map[string]map[string]bool)
+	funcCalls := make(map[string]map[string]bool)
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		name := filepath.Base(file)
+		_, ok := handlerFiles[name]
+		assert.Assert(t, ok, "%s is not registered in handlerFiles", name)
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+		assert.NilError(t, err)
+		fileKeys[name], fileCalls[name] = readConfigKeys(f)
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+				funcKeys[fn.Name.Name], funcCalls[fn.Name.Name] = readConfigKeys(fn)
+			}
+		}
+	}
+	applicationKeys := make(map[string]bool)
+	deploymentKeys := make(map[string]bool)
+	for name, keys := range fileKeys {
+		visited := make(map[string]bool)
+		var visit func(calls map[string]bool)
+		visit = func(calls map[string]bool) {
+			for call := range calls {
+				if _, ok := funcKeys[call]; !ok || visited[call] {
+					continue
+				}
+				visited[call] = true
+				for key := range funcKeys[call] {
+					keys[key] = true
+				}
+				visit(funcCalls[call])
+			}
+		}
+		visit(fileCalls[name])
+		for key := range keys {
+			if handlerFiles[name].application {
+				applicationKeys[key] = true
+			}
+			if handlerFiles[name].deployment {
+				deploymentKeys[key] = true
+			}
+		}
+	}
+	assert.DeepEqual(t, sortedKeys(applicationKeys), sortedStrings(applicationConfigKeys))
+	assert.DeepEqual(t, sortedKeys(deploymentKeys), sortedStrings(deploymentConfigKeys))
+}
+
+// readConfigKeys 返回node中通过SQBConfigMapEntity读取的配置项和调用的函数名
+func readConfigKeys(node ast.Node) (map[string]bool, map[string]bool) {
+	keys := make(map[string]bool)
+	calls := make(map[string]bool)
+	ast.Inspect(node, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		switch fun := call.Fun.(type) {
+		case *ast.Ident:
+			calls[fun.Name] = true
+		case *ast.SelectorExpr:
+			for _, key := range configGetterKeys[fun.Sel.Name] {
+				keys[key] = true
+			}
+		}
+		return true
+	})
+	return keys, calls
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedStrings(s []string) []string {
+	result := append([]string{}, s...)
+	sort.Strings(result)
+	return result
+}
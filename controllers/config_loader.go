@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+const (
+	OperatorSecretName = "operator-secret"
+	// 非leader重新读取operator配置的间隔
+	defaultConfigLoadInterval = 30 * time.Second
+)
+
+// OperatorConfigLoader 不参与选主，在每个pod上读取operator配置和secret，保证非leader的webhook也使用最新的配置。
+// 选主成功后由ConfigMapReconciler、SQBOperatorConfigReconciler和SecretReconciler负责更新配置
+type OperatorConfigLoader struct {
+	// 读取configmap和SQBOperatorConfig
+	Client client.Reader
+	// 读取operator-secret
+	SecretReader client.Reader
+	Log          logr.Logger
+	// 为空时使用OperatorNamespace()
+	Namespace string
+	// 集群中安装了SQBOperatorConfig CRD
+	OperatorConfigEnabled bool
+	// 选主成功后关闭
+	Elected <-chan struct{}
+	// 为0时使用defaultConfigLoadInterval
+	Interval time.Duration
+
+	// 已经加载的覆盖配置的namespace
+	overrides map[string]struct{}
+}
+
+func (l *OperatorConfigLoader) NeedLeaderElection() bool {
+	return false
+}
+
+func (l *OperatorConfigLoader) Start(ctx context.Context) error {
+	interval := l.Interval
+	if interval == 0 {
+		interval = defaultConfigLoadInterval
+	}
+	_ = wait.PollImmediateUntil(interval, func() (bool, error) {
+		select {
+		case <-l.Elected:
+			return true, nil
+		default:
+		}
+		if err := l.Load(ctx); err != nil {
+			l.Log.Error(err, "load operator config")
+		}
+		return false, nil
+	}, ctx.Done())
+	return nil
+}
+
+// Load 读取operator namespace下的全局配置、其他namespace下的覆盖配置和operator-secret。
+// SQBOperatorConfig优先于operator-configmap，配置有错误时保持之前的配置
+func (l *OperatorConfigLoader) Load(ctx context.Context) error {
+	operatorNamespace := l.Namespace
+	if operatorNamespace == "" {
+		operatorNamespace = OperatorNamespace()
+	}
+	configs := make(map[string]map[string]string)
+	invalid := make(map[string]bool)
+	configMaps := &corev1.ConfigMapList{}
+	if err := l.Client.List(ctx, configMaps); err != nil {
+		return err
+	}
+	for _, configMap := range configMaps.Items {
+		if configMap.Name == OperatorConfigMapName {
+			configs[configMap.Namespace] = configMap.Data
+		}
+	}
+	if l.OperatorConfigEnabled {
+		operatorConfigs := &qav1alpha1.SQBOperatorConfigList{}
+		if err := l.Client.List(ctx, operatorConfigs); err != nil {
+			return err
+		}
+		for _, operatorConfig := range operatorConfigs.Items {
+			if operatorConfig.Name != qav1alpha1.OperatorConfigName {
+				continue
+			}
+			data, err := operatorConfig.Spec.ToConfigMapData()
+			if err != nil || len(entity.ValidateConfigMapData(data)) != 0 {
+				invalid[operatorConfig.Namespace] = true
+				data = configs[operatorConfig.Namespace]
+			}
+			configs[operatorConfig.Namespace] = data
+		}
+	}
+
+	// 全局配置不存在时不初始化，和leader保持一致
+	if data, ok := configs[operatorNamespace]; ok && !invalid[operatorNamespace] {
+		applyOperatorConfig(operatorNamespace, operatorNamespace, data)
+	}
+	overrides := make(map[string]struct{})
+	for namespace, data := range configs {
+		if namespace == operatorNamespace {
+			continue
+		}
+		overrides[namespace] = struct{}{}
+		if !invalid[namespace] {
+			applyOperatorConfig(namespace, operatorNamespace, data)
+		}
+	}
+	for namespace := range l.overrides {
+		if _, ok := overrides[namespace]; !ok {
+			applyOperatorConfig(namespace, operatorNamespace, nil)
+		}
+	}
+	l.overrides = overrides
+
+	secret := &corev1.Secret{}
+	err := l.SecretReader.Get(ctx, client.ObjectKey{Namespace: operatorNamespace, Name: OperatorSecretName}, secret)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		entity.SecretData.FromMap(nil)
+		return nil
+	}
+	entity.SecretData.FromMap(secret.Data)
+	return nil
+}
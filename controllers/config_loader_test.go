@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+	"time"
+)
+
+func TestOperatorConfigLoader(t *testing.T) {
+	s := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(s)
+	_ = qav1alpha1.AddToScheme(s)
+	istioTimeout := int64(60)
+	override := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: OperatorConfigMapName, Namespace: "a"},
+		Data: map[string]string{"baseFlag": "base-a"}}
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: OperatorConfigMapName, Namespace: "system"},
+			Data: map[string]string{"baseFlag": "base", "istioTimeout": "30"}},
+		override,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "b"},
+			Data: map[string]string{"baseFlag": "other"}},
+		// SQBOperatorConfig优先于operator-configmap
+		&qav1alpha1.SQBOperatorConfig{ObjectMeta: metav1.ObjectMeta{Name: qav1alpha1.OperatorConfigName, Namespace: "system"},
+			Spec: qav1alpha1.SQBOperatorConfigSpec{BaseFlag: "base", IstioTimeout: &istioTimeout}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: OperatorSecretName, Namespace: "system"},
+			Data: map[string][]byte{"salt": []byte("salt")}},
+	).Build()
+	defer entity.ConfigMapData.FromMap(map[string]string{})
+	defer entity.ConfigMapData.SetNamespaceOverride("a", nil)
+	defer entity.SecretData.FromMap(nil)
+	loader := &OperatorConfigLoader{
+		Client:                c,
+		SecretReader:          c,
+		Log:                   ctrl.Log.WithName("test"),
+		Namespace:             "system",
+		OperatorConfigEnabled: true,
+	}
+	ctx := context.Background()
+
+	assert.NilError(t, loader.Load(ctx))
+	assert.Equal(t, entity.ConfigMapData.IsInitialized(), true)
+	assert.Equal(t, entity.ConfigMapData.IstioTimeout(), int64(60))
+	assert.Equal(t, entity.ConfigMapData.ForNamespace("a").BaseFlag(), "base-a")
+	assert.Equal(t, entity.ConfigMapData.ForNamespace("b").BaseFlag(), "base")
+	assert.Equal(t, entity.SecretData.Salt(), "salt")
+
+	// 覆盖配置删除后恢复使用全局配置
+	assert.NilError(t, c.Delete(ctx, override))
+	assert.NilError(t, loader.Load(ctx))
+	assert.Equal(t, entity.ConfigMapData.ForNamespace("a").BaseFlag(), "base")
+
+	// 选主成功后不再读取
+	elected := make(chan struct{})
+	close(elected)
+	loader.Elected = elected
+	loader.Interval = time.Millisecond
+	done := make(chan struct{})
+	go func() {
+		_ = loader.Start(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("loader should stop after elected")
+	}
+	assert.Equal(t, loader.NeedLeaderElection(), false)
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"strings"
+)
+
+var (
+	// 影响SQBApplication子资源(service、ingress、virtualservice、destinationrule、servicemonitor等)的配置项，
+	// 需要和handler读取的配置项保持一致，由TestConfigKeysReadByHandlers检查
+	applicationConfigKeys = []string{"istioGateways", "istioTimeout", "domainPostfix", "istioRoutingEnable", "planeRouting",
+		"istioEnable", "istioInject", "istioIngressGateway", "ingressOpen", "serviceMonitorEnable", "victoriaMetricsEnable",
+		"canaryMetricsAddress", "specialVirtualServiceIngress", "baseFlag", "env"}
+	// 影响SQBDeployment子资源(deployment、pvc、pdb、ingress、special virtualservice等)的配置项
+	deploymentConfigKeys = []string{"istioGateways", "istioTimeout", "domainPostfix", "imagePullSecrets",
+		"deploymentSpec", "defaultDeploySpec", "initContainerImage", "planeRouting", "istioEnable", "istioInject",
+		"istioIngressGateway", "ingressOpen", "pvcEnable", "canaryMetricsAddress", "specialVirtualServiceIngress",
+		"baseFlag", "env"}
+)
+
+// ConfigResyncer operator配置修改后，按限速重新处理输出会变化的SQBApplication和SQBDeployment。
+// 作为manager的Runnable在leader上运行，还没有处理的对象再次需要重新处理时只处理一次
+type ConfigResyncer struct {
+	client       client.Client
+	log          logr.Logger
+	limiter      *rate.Limiter
+	queue        workqueue.Interface
+	applications chan event.GenericEvent
+	deployments  chan event.GenericEvent
+}
+
+// resyncKey 等待重新处理的对象
+type resyncKey struct {
+	application bool
+	types.NamespacedName
+}
+
+// NewConfigResyncer qps<=0时不重新处理
+func NewConfigResyncer(c client.Client, log logr.Logger, qps float64) *ConfigResyncer {
+	if qps <= 0 {
+		return nil
+	}
+	return &ConfigResyncer{
+		client:       c,
+		log:          log,
+		limiter:      rate.NewLimiter(rate.Limit(qps), 1),
+		queue:        workqueue.NewNamed("config-resync"),
+		applications: make(chan event.GenericEvent),
+		deployments:  make(chan event.GenericEvent),
+	}
+}
+
+// Apply 应用operator配置，并重新处理受影响的资源
+func (r *ConfigResyncer) Apply(ctx context.Context, namespace, operatorNamespace string, data map[string]string) error {
+	// 首次加载配置时所有资源都会处理，不需要重新处理
+	if r == nil || !entity.ConfigMapData.IsInitialized() {
+		applyOperatorConfig(namespace, operatorNamespace, data)
+		return nil
+	}
+	// 全局配置影响所有namespace，覆盖配置只影响所在的namespace
+	var opts []client.ListOption
+	if namespace != operatorNamespace {
+		opts = append(opts, client.InNamespace(namespace))
+	}
+	applications := &qav1alpha1.SQBApplicationList{}
+	if err := r.client.List(ctx, applications, opts...); err != nil {
+		return err
+	}
+	deployments := &qav1alpha1.SQBDeploymentList{}
+	if err := r.client.List(ctx, deployments, opts...); err != nil {
+		return err
+	}
+	namespaces := make(map[string]struct{})
+	for _, item := range applications.Items {
+		namespaces[item.Namespace] = struct{}{}
+	}
+	for _, item := range deployments.Items {
+		namespaces[item.Namespace] = struct{}{}
+	}
+	before := make(map[string][2]string)
+	for ns := range namespaces {
+		before[ns] = [2]string{renderedConfig(ns, applicationConfigKeys), renderedConfig(ns, deploymentConfigKeys)}
+	}
+
+	applyOperatorConfig(namespace, operatorNamespace, data)
+
+	applicationChanged := make(map[string]bool)
+	deploymentChanged := make(map[string]bool)
+	for ns, b := range before {
+		applicationChanged[ns] = b[0] != renderedConfig(ns, applicationConfigKeys)
+		deploymentChanged[ns] = b[1] != renderedConfig(ns, deploymentConfigKeys)
+	}
+	objects := make([]client.Object, 0)
+	for i := range applications.Items {
+		if applicationChanged[applications.Items[i].Namespace] {
+			objects = append(objects, &applications.Items[i])
+		}
+	}
+	for i := range deployments.Items {
+		if deploymentChanged[deployments.Items[i].Namespace] {
+			objects = append(objects, &deployments.Items[i])
+		}
+	}
+	objects = filterConfigChangeIgnored(objects)
+	if len(objects) != 0 {
+		r.log.Info("operator config changed, resync", "namespace", namespace, "objects", len(objects))
+		r.enqueue(objects)
+	}
+	return nil
+}
+
+func (r *ConfigResyncer) enqueue(objects []client.Object) {
+	for _, obj := range objects {
+		_, application := obj.(*qav1alpha1.SQBApplication)
+		r.queue.Add(resyncKey{application: application, NamespacedName: client.ObjectKeyFromObject(obj)})
+	}
+}
+
+// Start 按限速把等待重新处理的对象发送给SQBApplication和SQBDeployment的controller，manager退出时停止
+func (r *ConfigResyncer) Start(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		r.queue.ShutDown()
+	}()
+	for {
+		item, shutdown := r.queue.Get()
+		if shutdown {
+			return nil
+		}
+		key := item.(resyncKey)
+		err := r.limiter.Wait(ctx)
+		if err == nil {
+			r.send(ctx, key)
+		}
+		r.queue.Done(item)
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+func (r *ConfigResyncer) send(ctx context.Context, key resyncKey) {
+	ch := r.deployments
+	var obj client.Object = &qav1alpha1.SQBDeployment{}
+	if key.application {
+		ch = r.applications
+		obj = &qav1alpha1.SQBApplication{}
+	}
+	obj.SetNamespace(key.Namespace)
+	obj.SetName(key.Name)
+	select {
+	case ch <- event.GenericEvent{Object: obj}:
+	case <-ctx.Done():
+	}
+}
+
+// 为controller添加配置修改后重新处理的事件源
+func (r *ConfigResyncer) watch(b *builder.Builder, obj client.Object) *builder.Builder {
+	if r == nil {
+		return b
+	}
+	ch := r.deployments
+	if _, ok := obj.(*qav1alpha1.SQBApplication); ok {
+		ch = r.applications
+	}
+	return b.Watches(&source.Channel{Source: ch}, &handler.EnqueueRequestForObject{})
+}
+
+// 过滤掉有qa.shouqianba.com/ignore-config-change注解的资源
+func filterConfigChangeIgnored(objects []client.Object) []client.Object {
+	result := make([]client.Object, 0, len(objects))
+	for _, obj := range objects {
+		if obj.GetAnnotations()[entity.IgnoreConfigChangeKey] == "true" {
+			continue
+		}
+		result = append(result, obj)
+	}
+	return result
+}
+
+// namespace下影响渲染结果的配置
+func renderedConfig(namespace string, keys []string) string {
+	config := entity.ConfigMapData.ForNamespace(namespace)
+	effective := config.Effective()
+	// deploymentSpec只在deploymentSpecNamespaces中生效
+	effective["deploymentSpec"] = config.DeploymentSpecByNamespace(namespace)
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, key+"="+effective[key])
+	}
+	return strings.Join(values, "\n")
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"testing"
+	"time"
+)
+
+func TestConfigResyncerApply(t *testing.T) {
+	s := runtime.NewScheme()
+	_ = qav1alpha1.AddToScheme(s)
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		&qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "a"}},
+		&qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-base", Namespace: "a"}},
+		&qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-ignored", Namespace: "a",
+			Annotations: map[string]string{entity.IgnoreConfigChangeKey: "true"}}},
+		&qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-base", Namespace: "b"}},
+	).Build()
+	resyncer := NewConfigResyncer(c, ctrl.Log.WithName("test"), 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer entity.ConfigMapData.FromMap(map[string]string{})
+	entity.ConfigMapData.FromMap(map[string]string{"imagePullSecrets": "reg"})
+
+	received := func(ch chan event.GenericEvent, n int) []client.Object {
+		t.Helper()
+		objects := make([]client.Object, 0)
+		for len(objects) < n {
+			select {
+			case e := <-ch:
+				objects = append(objects, e.Object)
+			case <-time.After(time.Second):
+				t.Fatalf("expect %d events, got %d", n, len(objects))
+			}
+		}
+		select {
+		case e := <-ch:
+			t.Fatalf("unexpected event %s/%s", e.Object.GetNamespace(), e.Object.GetName())
+		case <-time.After(50 * time.Millisecond):
+		}
+		return objects
+	}
+
+	// 还没有发送的对象重复加入时只处理一次
+	resyncer.enqueue([]client.Object{
+		&qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-base", Namespace: "a"}},
+		&qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-base", Namespace: "a"}},
+		&qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "app-base", Namespace: "a"}},
+	})
+	done := make(chan struct{})
+	go func() {
+		_ = resyncer.Start(ctx)
+		close(done)
+	}()
+	assert.Equal(t, len(received(resyncer.deployments, 1)), 1)
+	assert.Equal(t, len(received(resyncer.applications, 1)), 1)
+
+	// imagePullSecrets只影响SQBDeployment
+	err := resyncer.Apply(ctx, "system", "system", map[string]string{"imagePullSecrets": "reg-new"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(received(resyncer.deployments, 2)), 2)
+	assert.Equal(t, len(received(resyncer.applications, 0)), 0)
+
+	// 覆盖配置只影响所在的namespace
+	err = resyncer.Apply(ctx, "b", "system", map[string]string{"istioTimeout": "60"})
+	assert.NilError(t, err)
+	deployments := received(resyncer.deployments, 1)
+	assert.Equal(t, deployments[0].GetNamespace(), "b")
+	assert.Equal(t, len(received(resyncer.applications, 0)), 0)
+
+	// 配置没有变化不重新处理
+	err = resyncer.Apply(ctx, "system", "system", map[string]string{"imagePullSecrets": "reg-new"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(received(resyncer.deployments, 0)), 0)
+	assert.Equal(t, len(received(resyncer.applications, 0)), 0)
+
+	// serviceMonitorEnable只影响SQBApplication
+	err = resyncer.Apply(ctx, "system", "system", map[string]string{"imagePullSecrets": "reg-new", "serviceMonitorEnable": "true"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(received(resyncer.applications, 1)), 1)
+	assert.Equal(t, len(received(resyncer.deployments, 0)), 0)
+
+	// defaultDeploySpec影响SQBDeployment，ingressOpen影响SQBApplication和SQBDeployment的ingress
+	err = resyncer.Apply(ctx, "a", "system", map[string]string{"defaultDeploySpec": `{"replicas":2}`, "ingressOpen": "true"})
+	assert.NilError(t, err)
+	// 按加入的顺序依次发送，SQBApplication在前
+	assert.Equal(t, len(received(resyncer.applications, 1)), 1)
+	assert.Equal(t, len(received(resyncer.deployments, 1)), 1)
+	entity.ConfigMapData.SetNamespaceOverride("a", nil)
+	entity.ConfigMapData.SetNamespaceOverride("b", nil)
+
+	// manager退出后停止
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("resyncer should stop after context canceled")
+	}
+}
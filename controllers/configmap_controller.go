@@ -15,50 +15,99 @@ package controllers
 import (
 	"context"
 	"github.com/go-logr/logr"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
 	"github.com/wosai/elastic-env-operator/domain/entity"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
-	"os"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
-// SQBPlaneReconciler reconciles a SQBPlane object
+const OperatorConfigMapName = "operator-configmap"
+
+// ConfigMapReconciler 读取operator-configmap中的配置
 type ConfigMapReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// 为空时使用OperatorNamespace()
+	Namespace string
+	// 集群中安装了SQBOperatorConfig CRD，此时同namespace下存在SQBOperatorConfig时忽略configmap
+	OperatorConfigEnabled bool
+	// 为空时配置修改后不重新处理已有资源
+	ConfigResyncer *ConfigResyncer
 }
 
 // +kubebuilder:rbac:groups=qa.shouqianba.com,resources=sqbplanes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=qa.shouqianba.com,resources=sqbplanes/status,verbs=get;update;patch
 
 func (r *ConfigMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if r.OperatorConfigEnabled {
+		// 存在SQBOperatorConfig时以SQBOperatorConfig为准，忽略operator-configmap
+		operatorConfig := &qav1alpha1.SQBOperatorConfig{}
+		err := r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: qav1alpha1.OperatorConfigName}, operatorConfig)
+		if err == nil {
+			r.Log.Info("SQBOperatorConfig exists, ignore ConfigMap", "namespace", req.Namespace)
+			return ctrl.Result{}, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, loadOperatorConfigMap(ctx, r.Client, r.Log, r.ConfigResyncer, req.Namespace, r.operatorNamespace())
+}
+
+// 读取namespace下的operator-configmap并生效，operator namespace下为全局配置，其他namespace下为覆盖配置
+func loadOperatorConfigMap(ctx context.Context, c client.Client, log logr.Logger, resyncer *ConfigResyncer,
+	namespace, operatorNamespace string) error {
 	instance := &corev1.ConfigMap{}
-	err := r.Get(ctx, req.NamespacedName, instance)
+	err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: OperatorConfigMapName}, instance)
 	if err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		if apierrors.IsNotFound(err) && namespace != operatorNamespace {
+			// 覆盖配置删除后恢复使用全局配置
+			log.Info("ConfigMap override removed", "namespace", namespace)
+			return resyncer.Apply(ctx, namespace, operatorNamespace, nil)
+		}
+		return client.IgnoreNotFound(err)
 	}
-	data := instance.Data
-	entity.ConfigMapData.FromMap(data)
-	r.Log.Info("ConfigMap Value:", "json", entity.ConfigMapData.ToString())
-	return ctrl.Result{}, nil
+	for _, e := range entity.ValidateConfigMapData(instance.Data) {
+		log.Info("invalid ConfigMap value, use default", "namespace", namespace, "error", e.Error())
+	}
+	if err = resyncer.Apply(ctx, namespace, operatorNamespace, instance.Data); err != nil {
+		return err
+	}
+	log.Info("ConfigMap Value:", "namespace", namespace,
+		"json", entity.ConfigMapData.ForNamespace(namespace).ToString())
+	return nil
 }
 
-func (r *ConfigMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	namespace := os.Getenv("CONFIGMAP_NAMESPACE")
-	if namespace == "" {
-		namespace = "elastic-env-operator-system"
+// 应用operator配置，data为nil时删除namespace的覆盖配置
+func applyOperatorConfig(namespace, operatorNamespace string, data map[string]string) {
+	if namespace == operatorNamespace {
+		if data != nil {
+			entity.ConfigMapData.FromMap(data)
+		}
+		return
 	}
+	entity.ConfigMapData.SetNamespaceOverride(namespace, data)
+}
+
+func (r *ConfigMapReconciler) operatorNamespace() string {
+	if r.Namespace == "" {
+		return OperatorNamespace()
+	}
+	return r.Namespace
+}
+
+func (r *ConfigMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.ConfigMap{}, builder.WithPredicates(predicate.NewPredicateFuncs(
 			func(object client.Object) bool {
-				if object.GetNamespace() == namespace && object.GetName() == "operator-configmap" {
-					return true
-				}
-				return false
+				// operator namespace下为全局配置，其他namespace下为覆盖配置
+				return object.GetName() == OperatorConfigMapName
 			}))).
 		Complete(r)
 }
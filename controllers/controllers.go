@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"os"
 	"reflect"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -13,9 +14,10 @@ var (
 			if event.ObjectOld == nil || event.ObjectNew == nil {
 				return false
 			}
-			//generation不变且annotation也不变，不处理
+			//generation、annotation和deletionTimestamp都不变，不处理
 			if event.ObjectNew.GetGeneration() == event.ObjectOld.GetGeneration() &&
-				reflect.DeepEqual(event.ObjectOld.GetAnnotations(), event.ObjectNew.GetAnnotations()) {
+				reflect.DeepEqual(event.ObjectOld.GetAnnotations(), event.ObjectNew.GetAnnotations()) &&
+				event.ObjectNew.GetDeletionTimestamp().Equal(event.ObjectOld.GetDeletionTimestamp()) {
 				return false
 			}
 			return true
@@ -25,3 +27,12 @@ var (
 		},
 	}
 )
+
+// OperatorNamespace operator的configmap和secret默认所在的namespace
+func OperatorNamespace() string {
+	namespace := os.Getenv("CONFIGMAP_NAMESPACE")
+	if namespace == "" {
+		namespace = "elastic-env-operator-system"
+	}
+	return namespace
+}
@@ -439,7 +439,7 @@ var _ = Describe("Controller", func() {
 
 		It("delete sqbapplication with password", func() {
 			_, err := controllerutil.CreateOrUpdate(ctx, k8sClient, sqbapplication, func() error {
-				sqbapplication.Annotations[entity.ExplicitDeleteAnnotationKey] = util.GetDeleteCheckSum(sqbapplication.Name)
+				sqbapplication.Annotations[entity.ExplicitDeleteAnnotationKey], _ = util.GetDeleteCheckSum(sqbapplication.Name)
 				sqbapplication.Annotations[entity.IngressOpenAnnotationKey] = "true"
 				return nil
 			})
@@ -757,7 +757,7 @@ var _ = Describe("Controller", func() {
 
 		It("delete sqbapplication with password", func() {
 			_, err := controllerutil.CreateOrUpdate(ctx, k8sClient, sqbapplication, func() error {
-				sqbapplication.Annotations[entity.ExplicitDeleteAnnotationKey] = util.GetDeleteCheckSum(sqbapplication.Name)
+				sqbapplication.Annotations[entity.ExplicitDeleteAnnotationKey], _ = util.GetDeleteCheckSum(sqbapplication.Name)
 				sqbapplication.Annotations[entity.IstioInjectAnnotationKey] = "true"
 				return nil
 			})
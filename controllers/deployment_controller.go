@@ -19,9 +19,12 @@ package controllers
 import (
 	"context"
 	"github.com/go-logr/logr"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
 	sqbhandler "github.com/wosai/elastic-env-operator/domain/handler"
 	v12 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -45,12 +48,21 @@ func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v12.Deployment{}, builder.WithPredicates(predicate.Funcs{
+		For(&v12.Deployment{}, builder.WithPredicates(predicate.NewPredicateFuncs(isSqbDeploymentManaged), predicate.Funcs{
 			UpdateFunc: func(event event.UpdateEvent) bool {
 				if !event.ObjectNew.GetDeletionTimestamp().IsZero() {
 					return true
 				}
-				return false
+				// status变化时同步滚动更新状态
+				oldDeployment, ok := event.ObjectOld.(*v12.Deployment)
+				if !ok {
+					return false
+				}
+				newDeployment, ok := event.ObjectNew.(*v12.Deployment)
+				if !ok {
+					return false
+				}
+				return !reflect.DeepEqual(oldDeployment.Status, newDeployment.Status)
 			},
 			GenericFunc: func(event event.GenericEvent) bool {
 				if !event.Object.GetDeletionTimestamp().IsZero() {
@@ -64,3 +76,17 @@ func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		})).
 		Complete(r)
 }
+
+// isSqbDeploymentManaged 只处理operator生成的deployment：有app或plane的label，或者owner为SQBDeployment
+func isSqbDeploymentManaged(object client.Object) bool {
+	objLabels := object.GetLabels()
+	if objLabels[entity.AppKey] != "" || objLabels[entity.PlaneKey] != "" {
+		return true
+	}
+	for _, ownerReference := range object.GetOwnerReferences() {
+		if ownerReference.Kind == "SQBDeployment" && ownerReference.APIVersion == qav1alpha1.GroupVersion.String() {
+			return true
+		}
+	}
+	return false
+}
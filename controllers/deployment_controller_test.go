@@ -0,0 +1,27 @@
+package controllers
+
+import (
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"gotest.tools/assert"
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestIsSqbDeploymentManaged(t *testing.T) {
+	deployment := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}}
+	assert.Equal(t, isSqbDeploymentManaged(deployment), false)
+
+	deployment.Labels = map[string]string{entity.AppKey: "app"}
+	assert.Equal(t, isSqbDeploymentManaged(deployment), true)
+
+	deployment.Labels = nil
+	deployment.OwnerReferences = []metav1.OwnerReference{
+		{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "other"},
+	}
+	assert.Equal(t, isSqbDeploymentManaged(deployment), false)
+	deployment.OwnerReferences = append(deployment.OwnerReferences, metav1.OwnerReference{
+		APIVersion: qav1alpha1.GroupVersion.String(), Kind: "SQBDeployment", Name: "app-base"})
+	assert.Equal(t, isSqbDeploymentManaged(deployment), true)
+}
@@ -0,0 +1,86 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// SecretReconciler 读取operator-secret中的秘钥信息
+type SecretReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// 为空时使用OperatorNamespace()
+	Namespace string
+
+	// 只缓存operator namespace下的secret，SetupWithManager时创建
+	reader client.Reader
+}
+
+// operator只需要读取operator namespace下的secret，权限为namespace级别的Role(config/rbac/secret_role.yaml)
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch,namespace=system
+
+func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	instance := &corev1.Secret{}
+	err := r.reader.Get(ctx, req.NamespacedName, instance)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			entity.SecretData.FromMap(nil)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	entity.SecretData.FromMap(instance.Data)
+	r.Log.Info("Secret loaded", "keys", len(instance.Data))
+	return ctrl.Result{}, nil
+}
+
+func (r *SecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	namespace := r.Namespace
+	if namespace == "" {
+		namespace = OperatorNamespace()
+	}
+	// manager的cache会watch所有namespace的secret，这里使用只watch operator namespace的cache
+	secretCache, err := cache.New(mgr.GetConfig(), cache.Options{
+		Scheme:    mgr.GetScheme(),
+		Mapper:    mgr.GetRESTMapper(),
+		Namespace: namespace,
+	})
+	if err != nil {
+		return err
+	}
+	if err = mgr.Add(secretCache); err != nil {
+		return err
+	}
+	r.reader = secretCache
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("secret").
+		Watches(source.NewKindWithCache(&corev1.Secret{}, secretCache), &handler.EnqueueRequestForObject{},
+			builder.WithPredicates(predicate.NewPredicateFuncs(
+				func(object client.Object) bool {
+					return object.GetNamespace() == namespace && object.GetName() == OperatorSecretName
+				}))).
+		Complete(r)
+}
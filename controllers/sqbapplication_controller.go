@@ -22,8 +22,12 @@ import (
 	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
 	sqbhandler "github.com/wosai/elastic-env-operator/domain/handler"
 	"k8s.io/apimachinery/pkg/runtime"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 // SQBApplicationReconciler reconciles a SQBApplication object
@@ -31,6 +35,8 @@ type SQBApplicationReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// 为空时operator配置修改后不重新处理
+	ConfigResyncer *ConfigResyncer
 }
 
 // +kubebuilder:rbac:groups=qa.shouqianba.com,resources=sqbapplications,verbs=get;list;watch;create;update;patch;delete
@@ -41,7 +47,43 @@ func (r *SQBApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 }
 
 func (r *SQBApplicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&qav1alpha1.SQBApplication{}).
-		Complete(r)
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&qav1alpha1.SQBApplication{}, builder.WithPredicates(predicate.Or(GenerationAnnotationPredicate, planesChangedPredicate)))
+	return r.ConfigResyncer.watch(b, &qav1alpha1.SQBApplication{}).Complete(r)
+}
+
+// planesChangedPredicate status中的位面或者灰度权重变化时重新生成virtualservice和destinationrule，
+// 只有就绪副本数(status.planes的值和status.mirrors)变化时不处理
+var planesChangedPredicate = predicate.Funcs{
+	CreateFunc: func(event.CreateEvent) bool {
+		return false
+	},
+	DeleteFunc: func(event.DeleteEvent) bool {
+		return false
+	},
+	UpdateFunc: func(event event.UpdateEvent) bool {
+		oldApplication, ok := event.ObjectOld.(*qav1alpha1.SQBApplication)
+		if !ok {
+			return false
+		}
+		newApplication, ok := event.ObjectNew.(*qav1alpha1.SQBApplication)
+		if !ok {
+			return false
+		}
+		if !reflect.DeepEqual(oldApplication.Status.CanaryWeights, newApplication.Status.CanaryWeights) {
+			return true
+		}
+		if len(oldApplication.Status.Planes) != len(newApplication.Status.Planes) {
+			return true
+		}
+		for plane := range newApplication.Status.Planes {
+			if _, ok := oldApplication.Status.Planes[plane]; !ok {
+				return true
+			}
+		}
+		return false
+	},
+	GenericFunc: func(event.GenericEvent) bool {
+		return false
+	},
 }
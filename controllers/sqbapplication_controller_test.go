@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"testing"
+)
+
+func TestPlanesChangedPredicate(t *testing.T) {
+	oldApplication := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Status: qav1alpha1.SQBApplicationStatus{Planes: map[string]int{"base": 1}, Mirrors: map[string]int{"app-base": 1}}}
+	update := func(newApplication *qav1alpha1.SQBApplication) bool {
+		return planesChangedPredicate.Update(event.UpdateEvent{ObjectOld: oldApplication, ObjectNew: newApplication})
+	}
+
+	// 就绪副本数变化不处理
+	newApplication := oldApplication.DeepCopy()
+	newApplication.Status.Planes["base"] = 3
+	newApplication.Status.Mirrors["app-base"] = 3
+	assert.Equal(t, update(newApplication), false)
+
+	// 新增位面
+	newApplication.Status.Planes["feature"] = 0
+	assert.Equal(t, update(newApplication), true)
+
+	// 灰度权重变化
+	newApplication = oldApplication.DeepCopy()
+	newApplication.Status.CanaryWeights = map[string]int32{"feature": 10}
+	assert.Equal(t, update(newApplication), true)
+	assert.Equal(t, planesChangedPredicate.Create(event.CreateEvent{Object: newApplication}), false)
+}
@@ -32,6 +32,8 @@ type SQBDeploymentReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// 为空时operator配置修改后不重新处理
+	ConfigResyncer *ConfigResyncer
 }
 
 // +kubebuilder:rbac:groups=qa.shouqianba.com,resources=sqbdeployments,verbs=get;list;watch;create;update;patch;delete
@@ -42,7 +44,7 @@ func (r *SQBDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 }
 
 func (r *SQBDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&qav1alpha1.SQBDeployment{}, builder.WithPredicates(GenerationAnnotationPredicate)).
-		Complete(r)
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&qav1alpha1.SQBDeployment{}, builder.WithPredicates(GenerationAnnotationPredicate))
+	return r.ConfigResyncer.watch(b, &qav1alpha1.SQBDeployment{}).Complete(r)
 }
@@ -0,0 +1,114 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"strings"
+)
+
+const ReasonInvalidConfig = "InvalidConfig"
+
+// SQBOperatorConfigReconciler 读取SQBOperatorConfig中的配置，SQBOperatorConfig不存在时回退到operator-configmap
+type SQBOperatorConfigReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// 为空时使用OperatorNamespace()
+	Namespace string
+	// 为空时配置修改后不重新处理已有资源
+	ConfigResyncer *ConfigResyncer
+}
+
+// +kubebuilder:rbac:groups=qa.shouqianba.com,resources=sqboperatorconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=qa.shouqianba.com,resources=sqboperatorconfigs/status,verbs=get;update;patch
+
+func (r *SQBOperatorConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	operatorNamespace := r.Namespace
+	if operatorNamespace == "" {
+		operatorNamespace = OperatorNamespace()
+	}
+	instance := &qav1alpha1.SQBOperatorConfig{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// SQBOperatorConfig删除后回退到operator-configmap
+			return ctrl.Result{}, loadOperatorConfigMap(ctx, r.Client, r.Log, r.ConfigResyncer, req.Namespace, operatorNamespace)
+		}
+		return ctrl.Result{}, err
+	}
+
+	errs := make([]string, 0)
+	data, err := instance.Spec.ToConfigMapData()
+	if err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		for _, e := range entity.ValidateConfigMapData(data) {
+			errs = append(errs, e.Error())
+		}
+	}
+	// 配置有错误时不生效，保持之前的配置
+	condition := metav1.Condition{
+		Type:               qav1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             qav1alpha1.ReasonReconcileSucceeded,
+		ObservedGeneration: instance.Generation,
+	}
+	if len(errs) == 0 {
+		if err = r.ConfigResyncer.Apply(ctx, req.Namespace, operatorNamespace, data); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.Log.Info("SQBOperatorConfig Value:", "namespace", req.Namespace,
+			"json", entity.ConfigMapData.ForNamespace(req.Namespace).ToString())
+	} else {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = ReasonInvalidConfig
+		condition.Message = strings.Join(errs, "; ")
+		r.Log.Info("invalid SQBOperatorConfig, ignored", "namespace", req.Namespace, "errors", errs)
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+	instance.Status.ObservedGeneration = instance.Generation
+	instance.Status.Errors = errs
+	if entity.ConfigMapData.IsInitialized() {
+		instance.Status.Effective = entity.ConfigMapData.ForNamespace(req.Namespace).Effective()
+	}
+	return ctrl.Result{}, r.Status().Update(ctx, instance)
+}
+
+func (r *SQBOperatorConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&qav1alpha1.SQBOperatorConfig{}, builder.WithPredicates(predicate.GenerationChangedPredicate{},
+			predicate.NewPredicateFuncs(func(object client.Object) bool {
+				return object.GetName() == qav1alpha1.OperatorConfigName
+			}))).
+		Complete(r)
+}
+
+// OperatorConfigEnabled 集群中是否安装了SQBOperatorConfig CRD，未安装时只读取operator-configmap
+func OperatorConfigEnabled(mapper meta.RESTMapper) bool {
+	gk := schema.GroupKind{Group: qav1alpha1.GroupVersion.Group, Kind: "SQBOperatorConfig"}
+	_, err := mapper.RESTMapping(gk, qav1alpha1.GroupVersion.Version)
+	return err == nil
+}
@@ -22,9 +22,12 @@ import (
 	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
 	sqbhandler "github.com/wosai/elastic-env-operator/domain/handler"
 	"k8s.io/apimachinery/pkg/runtime"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 // SQBPlaneReconciler reconciles a SQBPlane object
@@ -43,6 +46,30 @@ func (r *SQBPlaneReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 func (r *SQBPlaneReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&qav1alpha1.SQBPlane{}, builder.WithPredicates(GenerationAnnotationPredicate)).
+		For(&qav1alpha1.SQBPlane{}, builder.WithPredicates(predicate.Or(GenerationAnnotationPredicate, mirrorsChangedPredicate))).
 		Complete(r)
 }
+
+// mirrorsChangedPredicate 位面下deployment的就绪副本数(status.mirrors)变化时重新判断位面是否空闲
+var mirrorsChangedPredicate = predicate.Funcs{
+	CreateFunc: func(event.CreateEvent) bool {
+		return false
+	},
+	DeleteFunc: func(event.DeleteEvent) bool {
+		return false
+	},
+	UpdateFunc: func(event event.UpdateEvent) bool {
+		oldPlane, ok := event.ObjectOld.(*qav1alpha1.SQBPlane)
+		if !ok {
+			return false
+		}
+		newPlane, ok := event.ObjectNew.(*qav1alpha1.SQBPlane)
+		if !ok {
+			return false
+		}
+		return !reflect.DeepEqual(oldPlane.Status.Mirrors, newPlane.Status.Mirrors)
+	},
+	GenericFunc: func(event.GenericEvent) bool {
+		return false
+	},
+}
@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"testing"
+)
+
+func TestMirrorsChangedPredicate(t *testing.T) {
+	oldPlane := &qav1alpha1.SQBPlane{ObjectMeta: metav1.ObjectMeta{Name: "feature", Namespace: "default"},
+		Status: qav1alpha1.SQBPlaneStatus{Mirrors: map[string]int{"app-feature": 1}}}
+	newPlane := oldPlane.DeepCopy()
+	newPlane.Status.ErrorInfo = "error"
+	assert.Equal(t, mirrorsChangedPredicate.Update(event.UpdateEvent{ObjectOld: oldPlane, ObjectNew: newPlane}), false)
+
+	// 就绪副本数变化
+	newPlane.Status.Mirrors["app-feature"] = 0
+	assert.Equal(t, mirrorsChangedPredicate.Update(event.UpdateEvent{ObjectOld: oldPlane, ObjectNew: newPlane}), true)
+	assert.Equal(t, mirrorsChangedPredicate.Create(event.CreateEvent{Object: newPlane}), false)
+}
@@ -189,8 +189,9 @@ var _ = BeforeSuite(func(done Done) {
 		"domainPostfix":                `{"nginx-vpc":"*.beta.iwosai.com","nginx":"*.iwosai.com"}`,
 		"istioGateways":                `["istio-system/ingressgateway","mesh"]`,
 		"specialVirtualServiceIngress": "nginx",
-		"operatorDelay":                "0",
 	})
+	entity.SecretData.FromMap(map[string][]byte{"salt": []byte("salt")})
+	handler.SetReady(true)
 
 	close(done)
 }, 60)
@@ -20,10 +20,34 @@ const (
 	DestinationRuleAnnotationKey = "qa.shouqianba.com/passthrough-destinationrule"
 	VirtualServiceAnnotationKey  = "qa.shouqianba.com/passthrough-virtualservice"
 	InitializeAnnotationKey      = "qa.shouqianba.com/initialized"
+	RetainedAnnotationKey        = "qa.shouqianba.com/retained"
+	LeaseRenewAnnotationKey      = "qa.shouqianba.com/lease-renew-time"
+	LastAppliedHashAnnotationKey = "qa.shouqianba.com/last-applied-hash"
+	IgnoreConfigChangeKey        = "qa.shouqianba.com/ignore-config-change"
 	IngressClassAnnotationKey    = "kubernetes.io/ingress.class"
 	IstioSidecarInjectKey        = "sidecar.istio.io/inject"
 	JaegerInjectAnnotationKey    = "sidecar.jaegertracing.io/inject"
 	JaegerInjectedLabelKey       = "sidecar.jaegertracing.io/injected"
 	KubevelaLastAppliedTime      = "app.oam.dev/last-applied-time"
 	KubevelaAppNameLabel         = "app.oam.dev/name"
+	KubevelaModeAnnotationKey    = "qa.shouqianba.com/kubevela-mode"
+	KubevelaCommandAnnotationKey = "qa.shouqianba.com/kubevela-command"
+)
+
+// kubevela管理的对象的处理方式，通过qa.shouqianba.com/kubevela-mode注解配置，默认为vela
+const (
+	// operator拥有对象，冲突时强制接管字段，可以删除
+	KubevelaModeOperator = "operator"
+	// operator只apply自己渲染的字段，冲突时报错，不删除
+	KubevelaModeMerge = "merge"
+	// kubevela拥有对象，operator不修改也不删除
+	KubevelaModeVela = "vela"
+)
+
+// 通过qa.shouqianba.com/kubevela-command注解切换处理方式，执行后注解被移除
+const (
+	// 切换为operator，并强制接管operator渲染的字段
+	KubevelaCommandTakeover = "takeover"
+	// 切换为vela
+	KubevelaCommandHandback = "handback"
 )
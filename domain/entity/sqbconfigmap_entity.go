@@ -4,10 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	v1 "k8s.io/api/core/v1"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 )
 
 var ConfigMapData = &SQBConfigMapEntity{}
@@ -18,16 +18,20 @@ type (
 		istioInject                  bool              // 默认是否启用istio
 		istioEnable                  bool              // 集群是否安装istio
 		istioIngressGateway          bool              // 集群是否启用istio-ingressgateway，默认与istioEnable一致
+		istioRoutingEnable           bool              // 是否根据位面生成virtualservice和destinationrule
 		istioTimeout                 int64             // istio连接超时时间
 		istioGateways                []string          // virtualservice应用的gateway
+		planeRouting                 string            // 请求匹配位面的方式，格式同SQBApplication的planeRouting
 		serviceMonitorEnable         bool              // 集群是否安装prometheus
 		victoriaMetricsEnable        bool              // 集群是否安装victoria metrics,serviceMonitorEnable和victoriaMetricsEnable互斥
 		pvcEnable                    bool              // 集群是否使用PVC
+		canaryMetricsAddress         string            // 灰度分析查询的prometheus兼容接口地址
 		domainPostfix                map[string]string // 默认的域名后缀{"ingress class":"host"}
 		imagePullSecrets             string            // 默认的image pull secret名称
 		specialVirtualServiceIngress string            // 特性入口的域名对应的ingress class
 		deploymentSpec               string            // 默认的deployment全局配置
-		operatorDelay                int               // 启动完成后的延迟时间，主要为了operator重启后不全量reconcile
+		deploymentSpecNamespaces     []string          // deploymentSpec生效的namespace，"*"表示所有namespace
+		defaultDeploySpec            string            // 默认的DeploySpec，SQBApplication和SQBDeployment在此基础上覆盖
 		initContainerImage           string            // init container镜像
 		baseFlag                     string            // 基础环境标识
 		env                          string            // 所属环境，test/prod
@@ -37,9 +41,11 @@ type (
 // operator相关的业务配置实体
 type SQBConfigMapEntity struct {
 	data        configMapData
+	raw         map[string]string              // 全局operator-configmap的原始配置
+	namespaces  map[string]map[string]string   // 各namespace下operator-configmap的覆盖配置
+	overrides   map[string]*SQBConfigMapEntity // 合并后的namespace配置
 	mux         sync.RWMutex
-	initialized bool // 是否初始化，初始化后才开始接收event，初始化之前的event requeue
-	ready       bool // 是否已就绪，就绪后才真正开始处理event，Initialized到Ready状态之间的event直接忽略
+	initialized bool // 是否初始化，初始化后才开始处理event，初始化之前的event requeue
 }
 
 const (
@@ -47,74 +53,186 @@ const (
 	ENV_PROD string = "prod"
 )
 
-func (sc *SQBConfigMapEntity) FromMap(data map[string]string) {
-	sc.mux.Lock()
-	defer sc.mux.Unlock()
+// 解析operator-configmap的配置，未配置或者解析失败的项使用默认值，解析失败的项通过errs返回
+func parseConfigMapData(data map[string]string) (cd configMapData, errs []error) {
 	if len(data) == 0 {
 		data = make(map[string]string)
 	}
-	sc.data.ingressOpen = data["ingressOpen"] == "true"
-	sc.data.istioInject = data["istioInject"] == "true"
-	sc.data.istioEnable = data["istioEnable"] == "true"
-	sc.data.istioIngressGateway = data["istioIngressGateway"] != "false"
-	sc.data.serviceMonitorEnable = data["serviceMonitorEnable"] == "true"
-	sc.data.victoriaMetricsEnable = data["victoriaMetricsEnable"] == "true"
-	if sc.data.serviceMonitorEnable && sc.data.victoriaMetricsEnable {
-		sc.data.victoriaMetricsEnable = false
-	}
-	sc.data.pvcEnable = data["pvcEnable"] == "true"
-
-	if istioTimeout, ok := data["istioTimeout"]; ok {
-		timeout, err := strconv.Atoi(istioTimeout)
-		if err == nil {
-			sc.data.istioTimeout = int64(timeout)
-		} else {
-			sc.data.istioTimeout = 30
+	parseBool := func(key string, defaultValue bool) bool {
+		value, ok := data[key]
+		if !ok || value == "" {
+			return defaultValue
 		}
-	} else {
-		sc.data.istioTimeout = 30
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return defaultValue
+		}
+		return b
 	}
-	if domainPostfix, ok := data["domainPostfix"]; ok {
-		domains := make(map[string]string)
-		_ = json.Unmarshal([]byte(domainPostfix), &domains)
-		sc.data.domainPostfix = domains
+	parseInt := func(key string, defaultValue int) int {
+		value, ok := data[key]
+		if !ok || value == "" {
+			return defaultValue
+		}
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return defaultValue
+		}
+		return i
 	}
-	sc.data.imagePullSecrets = data["imagePullSecrets"]
-	if istioGateways, ok := data["istioGateways"]; ok {
-		gateways := make([]string, 0)
-		_ = json.Unmarshal([]byte(istioGateways), &gateways)
-		sc.data.istioGateways = gateways
+	parseJson := func(key string, v interface{}) bool {
+		value, ok := data[key]
+		if !ok || value == "" {
+			return false
+		}
+		if err := json.Unmarshal([]byte(value), v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return false
+		}
+		return true
 	}
-	if len(sc.data.istioGateways) == 0 {
-		sc.data.istioGateways = []string{"mesh"}
+
+	cd.ingressOpen = parseBool("ingressOpen", false)
+	cd.istioInject = parseBool("istioInject", false)
+	cd.istioEnable = parseBool("istioEnable", false)
+	cd.istioIngressGateway = parseBool("istioIngressGateway", true)
+	cd.istioRoutingEnable = parseBool("istioRoutingEnable", false)
+	cd.serviceMonitorEnable = parseBool("serviceMonitorEnable", false)
+	cd.victoriaMetricsEnable = parseBool("victoriaMetricsEnable", false)
+	if cd.serviceMonitorEnable && cd.victoriaMetricsEnable {
+		cd.victoriaMetricsEnable = false
+	}
+	cd.pvcEnable = parseBool("pvcEnable", false)
+	cd.canaryMetricsAddress = strings.TrimSuffix(data["canaryMetricsAddress"], "/")
+	if cd.canaryMetricsAddress != "" {
+		if u, err := url.Parse(cd.canaryMetricsAddress); err != nil {
+			errs = append(errs, fmt.Errorf("canaryMetricsAddress: %w", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("canaryMetricsAddress: scheme must be http or https"))
+		}
+	}
+
+	cd.istioTimeout = int64(parseInt("istioTimeout", 30))
+	domains := make(map[string]string)
+	if parseJson("domainPostfix", &domains) {
+		cd.domainPostfix = domains
+	}
+	cd.imagePullSecrets = data["imagePullSecrets"]
+	gateways := make([]string, 0)
+	if parseJson("istioGateways", &gateways) {
+		cd.istioGateways = gateways
+	}
+	if len(cd.istioGateways) == 0 {
+		cd.istioGateways = []string{"mesh"}
 	}
 	if specialVirtualServiceIngress, ok := data["specialVirtualServiceIngress"]; ok {
-		sc.data.specialVirtualServiceIngress = specialVirtualServiceIngress
+		cd.specialVirtualServiceIngress = specialVirtualServiceIngress
+	} else {
+		cd.specialVirtualServiceIngress = "nginx"
+	}
+	// deploymentSpec和defaultDeploySpec保留原值，使用时再报错
+	cd.deploymentSpec = data["deploymentSpec"]
+	parseJson("deploymentSpec", &map[string]interface{}{})
+	namespaces := make([]string, 0)
+	if _, ok := data["deploymentSpecNamespaces"]; !ok {
+		cd.deploymentSpecNamespaces = []string{"sqb"}
+	} else if parseJson("deploymentSpecNamespaces", &namespaces) {
+		cd.deploymentSpecNamespaces = namespaces
+	}
+	cd.defaultDeploySpec = data["defaultDeploySpec"]
+	parseJson("defaultDeploySpec", &map[string]interface{}{})
+	cd.planeRouting = data["planeRouting"]
+	parseJson("planeRouting", &map[string]interface{}{})
+	cd.initContainerImage = data["initContainerImage"]
+	cd.baseFlag = data["baseFlag"]
+	if cd.baseFlag == "" {
+		cd.baseFlag = "base"
+	}
+	cd.env = data["env"]
+	if cd.env != "" && cd.env != ENV_TEST && cd.env != ENV_PROD {
+		errs = append(errs, fmt.Errorf("env: must be %s or %s", ENV_TEST, ENV_PROD))
+	}
+	return cd, errs
+}
+
+// ValidateConfigMapData 校验operator配置，返回所有解析失败的配置项
+func ValidateConfigMapData(data map[string]string) []error {
+	_, errs := parseConfigMapData(data)
+	return errs
+}
+
+func (sc *SQBConfigMapEntity) FromMap(data map[string]string) {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	raw := mergeStringMap(data, nil)
+	keepValidDeploymentSpecNamespaces(raw, sc.raw)
+	sc.raw = raw
+	sc.data, _ = parseConfigMapData(sc.raw)
+	// 全局配置变化后，namespace的配置需要重新合并
+	sc.overrides = nil
+	sc.initialized = true
+}
+
+// SetNamespaceOverride 设置namespace下operator-configmap的覆盖配置，data为nil表示删除覆盖配置
+func (sc *SQBConfigMapEntity) SetNamespaceOverride(namespace string, data map[string]string) {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	if sc.namespaces == nil {
+		sc.namespaces = make(map[string]map[string]string)
+	}
+	if data == nil {
+		delete(sc.namespaces, namespace)
+	} else {
+		override := mergeStringMap(data, nil)
+		keepValidDeploymentSpecNamespaces(override, sc.namespaces[namespace])
+		sc.namespaces[namespace] = override
+	}
+	delete(sc.overrides, namespace)
+}
+
+// deploymentSpecNamespaces解析失败时保留之前的配置，没有之前的配置时使用默认值，避免deploymentSpec在所有namespace失效
+func keepValidDeploymentSpecNamespaces(data, previous map[string]string) {
+	value, ok := data["deploymentSpecNamespaces"]
+	if !ok || value == "" || json.Unmarshal([]byte(value), &[]string{}) == nil {
+		return
+	}
+	if old, ok := previous["deploymentSpecNamespaces"]; ok {
+		data["deploymentSpecNamespaces"] = old
 	} else {
-		sc.data.specialVirtualServiceIngress = "nginx"
+		delete(data, "deploymentSpecNamespaces")
+	}
+}
+
+// ForNamespace namespace下生效的配置：namespace的operator-configmap覆盖全局配置
+func (sc *SQBConfigMapEntity) ForNamespace(namespace string) *SQBConfigMapEntity {
+	sc.mux.RLock()
+	override, ok := sc.namespaces[namespace]
+	cached := sc.overrides[namespace]
+	sc.mux.RUnlock()
+	if !ok {
+		return sc
 	}
-	sc.data.deploymentSpec = data["deploymentSpec"]
-	operatorDeplay, err := strconv.Atoi(data["operatorDelay"])
-	if err != nil {
-		operatorDeplay = 30
+	if cached != nil {
+		return cached
 	}
-	sc.data.operatorDelay = operatorDeplay
-	sc.data.initContainerImage = data["initContainerImage"]
-	sc.data.baseFlag = data["baseFlag"]
-	if sc.data.baseFlag == "" {
-		sc.data.baseFlag = "base"
+
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	if override, ok = sc.namespaces[namespace]; !ok {
+		return sc
 	}
-	sc.data.env = data["env"]
-	if !sc.initialized {
-		sc.initialized = true
+	data, _ := parseConfigMapData(mergeStringMap(sc.raw, override))
+	merged := &SQBConfigMapEntity{
+		data:        data,
+		initialized: true,
 	}
-	if !sc.ready {
-		go func() {
-			timer := time.NewTimer(time.Duration(operatorDeplay) * time.Second)
-			<-timer.C
-			sc.ready = true
-		}()
+	if sc.overrides == nil {
+		sc.overrides = make(map[string]*SQBConfigMapEntity)
 	}
+	sc.overrides[namespace] = merged
+	return merged
 }
 
 func (sc *SQBConfigMapEntity) ToString() string {
@@ -126,6 +244,45 @@ func (sc *SQBConfigMapEntity) ToString() string {
 		sc.data.victoriaMetricsEnable, sc.data.pvcEnable)
 }
 
+// Effective 实际生效的配置，未配置的项为默认值
+func (sc *SQBConfigMapEntity) Effective() map[string]string {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	toJson := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	effective := map[string]string{
+		"ingressOpen":                  strconv.FormatBool(sc.data.ingressOpen),
+		"istioInject":                  strconv.FormatBool(sc.data.istioInject),
+		"istioEnable":                  strconv.FormatBool(sc.data.istioEnable),
+		"istioIngressGateway":          strconv.FormatBool(sc.data.istioIngressGateway),
+		"istioRoutingEnable":           strconv.FormatBool(sc.data.istioRoutingEnable),
+		"istioTimeout":                 strconv.FormatInt(sc.data.istioTimeout, 10),
+		"istioGateways":                toJson(sc.data.istioGateways),
+		"planeRouting":                 sc.data.planeRouting,
+		"serviceMonitorEnable":         strconv.FormatBool(sc.data.serviceMonitorEnable),
+		"victoriaMetricsEnable":        strconv.FormatBool(sc.data.victoriaMetricsEnable),
+		"pvcEnable":                    strconv.FormatBool(sc.data.pvcEnable),
+		"canaryMetricsAddress":         sc.data.canaryMetricsAddress,
+		"domainPostfix":                toJson(sc.data.domainPostfix),
+		"imagePullSecrets":             sc.data.imagePullSecrets,
+		"specialVirtualServiceIngress": sc.data.specialVirtualServiceIngress,
+		"deploymentSpec":               sc.data.deploymentSpec,
+		"deploymentSpecNamespaces":     toJson(sc.data.deploymentSpecNamespaces),
+		"defaultDeploySpec":            sc.data.defaultDeploySpec,
+		"initContainerImage":           sc.data.initContainerImage,
+		"baseFlag":                     sc.data.baseFlag,
+		"env":                          sc.data.env,
+	}
+	for k, v := range effective {
+		if v == "" || v == "null" {
+			delete(effective, k)
+		}
+	}
+	return effective
+}
+
 func (sc *SQBConfigMapEntity) GetDomainNames(prefix string) map[string]string {
 	sc.mux.RLock()
 	defer sc.mux.RUnlock()
@@ -199,6 +356,13 @@ func (sc *SQBConfigMapEntity) HasIstioIngressGateway() bool {
 	}
 }
 
+// IstioRoutingEnable 集群安装了istio时，是否由operator根据位面生成virtualservice和destinationrule
+func (sc *SQBConfigMapEntity) IstioRoutingEnable() bool {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.data.istioEnable && sc.data.istioRoutingEnable
+}
+
 func (sc *SQBConfigMapEntity) IsServiceMonitorEnable() bool {
 	sc.mux.RLock()
 	defer sc.mux.RUnlock()
@@ -217,6 +381,13 @@ func (sc *SQBConfigMapEntity) IsPVCEnable() bool {
 	return sc.data.pvcEnable
 }
 
+// CanaryMetricsAddress 为空时不进行灰度分析
+func (sc *SQBConfigMapEntity) CanaryMetricsAddress() string {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.data.canaryMetricsAddress
+}
+
 func (sc *SQBConfigMapEntity) SpecialVirtualServiceIngress() string {
 	sc.mux.RLock()
 	defer sc.mux.RUnlock()
@@ -229,22 +400,34 @@ func (sc *SQBConfigMapEntity) DeploymentSpec() string {
 	return sc.data.deploymentSpec
 }
 
-func (sc *SQBConfigMapEntity) IsInitialized() bool {
+// DeploymentSpecByNamespace namespace下生效的deploymentSpec
+func (sc *SQBConfigMapEntity) DeploymentSpecByNamespace(namespace string) string {
 	sc.mux.RLock()
 	defer sc.mux.RUnlock()
-	return sc.initialized
+	for _, ns := range sc.data.deploymentSpecNamespaces {
+		if ns == "*" || ns == namespace {
+			return sc.data.deploymentSpec
+		}
+	}
+	return ""
 }
 
-func (sc *SQBConfigMapEntity) IsReady() bool {
+func (sc *SQBConfigMapEntity) DefaultDeploySpec() string {
 	sc.mux.RLock()
 	defer sc.mux.RUnlock()
-	return sc.ready
+	return sc.data.defaultDeploySpec
 }
 
-func (sc *SQBConfigMapEntity) OperatorDelay() int {
+func (sc *SQBConfigMapEntity) PlaneRouting() string {
 	sc.mux.RLock()
 	defer sc.mux.RUnlock()
-	return sc.data.operatorDelay
+	return sc.data.planeRouting
+}
+
+func (sc *SQBConfigMapEntity) IsInitialized() bool {
+	sc.mux.RLock()
+	defer sc.mux.RUnlock()
+	return sc.initialized
 }
 
 func (sc *SQBConfigMapEntity) InitContainerImage() string {
@@ -268,3 +451,15 @@ func (sc *SQBConfigMapEntity) Env() string {
 		return ENV_PROD
 	}
 }
+
+// util依赖entity，这里不能引用util.MergeStringMap
+func mergeStringMap(base, toMerge map[string]string) map[string]string {
+	result := make(map[string]string)
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range toMerge {
+		result[k] = v
+	}
+	return result
+}
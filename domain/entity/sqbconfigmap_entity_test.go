@@ -57,7 +57,116 @@ func TestConfigMap(t *testing.T) {
 		assert.Equal(t, gateways[1], "mesh")
 	})
 
+	t.Run("istio routing", func(t *testing.T) {
+		assert.Equal(t, configmap.IstioRoutingEnable(), false)
+		routing := &SQBConfigMapEntity{}
+		routing.FromMap(map[string]string{"istioRoutingEnable": "true"})
+		// 集群没有安装istio时不生效
+		assert.Equal(t, routing.IstioRoutingEnable(), false)
+		routing.FromMap(map[string]string{"istioEnable": "true", "istioRoutingEnable": "true"})
+		assert.Equal(t, routing.IstioRoutingEnable(), true)
+	})
+
 	t.Run("initialized", func(t *testing.T) {
 		assert.Equal(t, configmap.IsInitialized(), true)
 	})
 }
+
+func TestDeploymentSpecByNamespace(t *testing.T) {
+	var configmap = &SQBConfigMapEntity{}
+	configmap.FromMap(map[string]string{"deploymentSpec": `{"replicas": 2}`})
+	assert.Equal(t, configmap.DeploymentSpecByNamespace("sqb"), `{"replicas": 2}`)
+	assert.Equal(t, configmap.DeploymentSpecByNamespace("other"), "")
+
+	configmap.FromMap(map[string]string{
+		"deploymentSpec":           `{"replicas": 2}`,
+		"deploymentSpecNamespaces": `["qa", "dev"]`,
+	})
+	assert.Equal(t, configmap.DeploymentSpecByNamespace("sqb"), "")
+	assert.Equal(t, configmap.DeploymentSpecByNamespace("dev"), `{"replicas": 2}`)
+
+	configmap.FromMap(map[string]string{
+		"deploymentSpec":           `{"replicas": 2}`,
+		"deploymentSpecNamespaces": `["*"]`,
+	})
+	assert.Equal(t, configmap.DeploymentSpecByNamespace("other"), `{"replicas": 2}`)
+
+	// 解析失败时保留之前的配置
+	configmap.FromMap(map[string]string{
+		"deploymentSpec":           `{"replicas": 2}`,
+		"deploymentSpecNamespaces": `"qa"`,
+	})
+	assert.Equal(t, configmap.DeploymentSpecByNamespace("other"), `{"replicas": 2}`)
+	configmap.SetNamespaceOverride("qa", map[string]string{"deploymentSpecNamespaces": `qa`})
+	assert.Equal(t, configmap.ForNamespace("qa").DeploymentSpecByNamespace("qa"), `{"replicas": 2}`)
+
+	// 没有之前的配置时使用默认值
+	configmap = &SQBConfigMapEntity{}
+	configmap.FromMap(map[string]string{
+		"deploymentSpec":           `{"replicas": 2}`,
+		"deploymentSpecNamespaces": `sqb`,
+	})
+	assert.Equal(t, configmap.DeploymentSpecByNamespace("sqb"), `{"replicas": 2}`)
+}
+
+func TestForNamespace(t *testing.T) {
+	var configmap = &SQBConfigMapEntity{}
+	configmap.FromMap(map[string]string{
+		"istioInject":      "true",
+		"baseFlag":         "base",
+		"imagePullSecrets": "global",
+		"domainPostfix":    `{"nginx-class": "*.beta.iwosai.com"}`,
+	})
+	assert.Equal(t, configmap.ForNamespace("qa"), configmap)
+
+	configmap.SetNamespaceOverride("qa", map[string]string{
+		"istioInject":   "false",
+		"baseFlag":      "stable",
+		"domainPostfix": `{"nginx-class": "*.qa.iwosai.com"}`,
+	})
+	qa := configmap.ForNamespace("qa")
+	assert.Equal(t, qa.IstioInject(), false)
+	assert.Equal(t, qa.BaseFlag(), "stable")
+	assert.Equal(t, qa.GetImagePullSecrets()[0].Name, "global")
+	assert.Equal(t, qa.GetDomainNameByClass("app", "nginx-class"), "app.qa.iwosai.com")
+	assert.Equal(t, configmap.ForNamespace("sqb").BaseFlag(), "base")
+
+	// 全局配置变化后重新合并
+	configmap.FromMap(map[string]string{"imagePullSecrets": "changed"})
+	assert.Equal(t, configmap.ForNamespace("qa").GetImagePullSecrets()[0].Name, "changed")
+	assert.Equal(t, configmap.ForNamespace("qa").BaseFlag(), "stable")
+
+	configmap.SetNamespaceOverride("qa", nil)
+	assert.Equal(t, configmap.ForNamespace("qa"), configmap)
+}
+
+func TestValidateConfigMapData(t *testing.T) {
+	errs := ValidateConfigMapData(map[string]string{
+		"istioInject":          "true",
+		"istioTimeout":         "60",
+		"istioGateways":        `["mesh"]`,
+		"canaryMetricsAddress": "http://vmselect:8481/select/0/prometheus/",
+	})
+	assert.Equal(t, len(errs), 0)
+
+	errs = ValidateConfigMapData(map[string]string{
+		"istioInject":          "yes",
+		"istioTimeout":         "30s",
+		"domainPostfix":        `{"nginx":`,
+		"istioGateways":        `mesh`,
+		"defaultDeploySpec":    `{`,
+		"env":                  "dev",
+		"canaryMetricsAddress": "vmselect:8481",
+	})
+	assert.Equal(t, len(errs), 7)
+
+	// 解析失败的项使用默认值
+	var configmap = &SQBConfigMapEntity{}
+	configmap.FromMap(map[string]string{"istioTimeout": "30s", "istioGateways": "mesh"})
+	assert.Equal(t, configmap.IstioTimeout(), int64(30))
+	assert.DeepEqual(t, configmap.IstioGateways(), []string{"mesh"})
+	effective := configmap.Effective()
+	assert.Equal(t, effective["istioTimeout"], "30")
+	assert.Equal(t, effective["baseFlag"], "base")
+	assert.Equal(t, effective["deploymentSpecNamespaces"], `["sqb"]`)
+}
@@ -0,0 +1,22 @@
+package entity
+
+import "sync"
+
+var SecretData = &SQBSecretEntity{}
+
+type SQBSecretEntity struct {
+	salt string // 计算删除注解checksum的salt
+	mux  sync.RWMutex
+}
+
+func (ss *SQBSecretEntity) FromMap(data map[string][]byte) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	ss.salt = string(data["salt"])
+}
+
+func (ss *SQBSecretEntity) Salt() string {
+	ss.mux.RLock()
+	defer ss.mux.RUnlock()
+	return ss.salt
+}
@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"github.com/wosai/elastic-env-operator/domain/util"
+	istioapi "istio.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"time"
+)
+
+// advanceCanary 按steps推进灰度发布，更新status.canary，返回距离下一步或者下一次分析的时间，0表示不需要再推进。
+// 配置了analysis时，当前步骤最近一次分析成功后才进入下一步，连续失败达到failureLimit时回滚；
+// 没有配置canaryMetricsAddress时停在当前步骤
+func advanceCanary(ctx context.Context, in *qav1alpha1.SQBDeployment, now time.Time) time.Duration {
+	canary := in.Spec.Canary
+	if canary == nil || len(canary.Steps) == 0 {
+		in.Status.Canary = nil
+		return 0
+	}
+	status := in.Status.Canary
+	stepsHash := canaryStepsHash(canary.Steps)
+	// steps修改后重新开始，升级前的status没有记录hash时沿用当前进度
+	if status != nil && status.StepsHash != "" && status.StepsHash != stepsHash {
+		log.Info("canary steps changed, restart", "namespace", in.Namespace, "name", in.Name)
+		status = nil
+	}
+	// 回滚后spec修改时重新开始
+	if status != nil && status.Phase == qav1alpha1.CanaryPhaseRolledBack {
+		if status.RollbackGeneration == in.Generation {
+			return 0
+		}
+		status = nil
+	}
+	if status == nil {
+		status = &qav1alpha1.CanaryStatus{StepStartTime: metav1.NewTime(now)}
+		in.Status.Canary = status
+	}
+	status.StepsHash = stepsHash
+	// steps被缩短时停在最后一步
+	last := int32(len(canary.Steps) - 1)
+	if status.Step > last {
+		status.Step = last
+	}
+	analysisEnabled := canaryAnalysisEnabled(in)
+	for {
+		step := canary.Steps[status.Step]
+		status.Weight = step.Weight
+		if status.Step == last {
+			status.Phase = qav1alpha1.CanaryPhaseCompleted
+			return 0
+		}
+		if step.Pause == nil {
+			status.Phase = qav1alpha1.CanaryPhasePaused
+			return 0
+		}
+		status.Phase = qav1alpha1.CanaryPhaseProgressing
+		next := status.StepStartTime.Add(step.Pause.Duration)
+		passed := true
+		if analysisEnabled {
+			interval := canaryAnalysisInterval(canary.Analysis)
+			if entity.ConfigMapData.ForNamespace(in.Namespace).CanaryMetricsAddress() == "" {
+				return interval
+			}
+			// 进入步骤一个interval之后才开始分析，查询的时间窗口内都是当前的权重
+			lastRun := lastCanaryAnalysisRun(status)
+			nextAnalysis := status.StepStartTime.Add(interval)
+			if lastRun != nil {
+				nextAnalysis = lastRun.Time.Add(interval)
+			}
+			if !now.Before(nextAnalysis) {
+				run := runCanaryAnalysis(ctx, in, now)
+				recordCanaryAnalysisRun(status, run)
+				switch run.Result {
+				case qav1alpha1.CanaryAnalysisSucceeded:
+					status.Failures = 0
+					status.Inconclusive = 0
+				case qav1alpha1.CanaryAnalysisFailed:
+					status.Failures++
+					status.Inconclusive = 0
+				case qav1alpha1.CanaryAnalysisInconclusive:
+					status.Inconclusive++
+					if status.Inconclusive >= maxCanaryInconclusiveRuns {
+						status.Failures++
+						status.Inconclusive = 0
+					}
+				}
+				if status.Failures >= canaryFailureLimit(canary.Analysis) {
+					log.Info("canary rolled back", "namespace", in.Namespace, "name", in.Name, "step", status.Step)
+					status.Phase = qav1alpha1.CanaryPhaseRolledBack
+					status.Weight = 0
+					status.RollbackGeneration = in.Generation
+					return 0
+				}
+				lastRun = &run
+				nextAnalysis = now.Add(interval)
+			}
+			passed = lastRun != nil && lastRun.Result == qav1alpha1.CanaryAnalysisSucceeded
+			if now.Before(next) && nextAnalysis.Before(next) {
+				next = nextAnalysis
+			}
+			if !now.Before(next) && !passed {
+				next = nextAnalysis
+			}
+		}
+		if now.Before(next) {
+			return next.Sub(now)
+		}
+		log.Info("canary step advanced", "namespace", in.Namespace, "name", in.Name, "step", status.Step+1)
+		status.Step++
+		status.StepStartTime = metav1.NewTime(now)
+		status.Failures = 0
+		status.Inconclusive = 0
+	}
+}
+
+func canaryStepsHash(steps []qav1alpha1.CanaryStep) string {
+	b, err := json.Marshal(steps)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b))[:16]
+}
+
+func canaryFailureLimit(analysis *qav1alpha1.CanaryAnalysis) int32 {
+	if analysis.FailureLimit <= 0 {
+		return 1
+	}
+	return analysis.FailureLimit
+}
+
+func isCanaryProgressing(in *qav1alpha1.SQBDeployment) bool {
+	return in.Status.Canary != nil && in.Status.Canary.Phase == qav1alpha1.CanaryPhaseProgressing
+}
+
+// syncCanaryWeight 将位面的灰度权重汇总到SQBApplication的status，触发virtualservice的更新。
+// 多个位面同时更新，用merge patch只修改当前位面的权重，避免覆盖其他位面的权重
+func syncCanaryWeight(ctx context.Context, in *qav1alpha1.SQBDeployment, deleted bool) error {
+	sqbapplication := &qav1alpha1.SQBApplication{}
+	if err := k8sclient.Get(ctx, client.ObjectKey{Namespace: in.Namespace, Name: in.Spec.Selector.App}, sqbapplication); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !sqbapplication.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	plane := in.Labels[entity.PlaneKey]
+	current, ok := sqbapplication.Status.CanaryWeights[plane]
+	// 值为null时删除位面的权重
+	var weight *int32
+	if !deleted && in.Status.Canary != nil {
+		weight = &in.Status.Canary.Weight
+	}
+	if (weight == nil && !ok) || (weight != nil && ok && *weight == current) {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"canaryWeights": map[string]*int32{plane: weight},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	err = k8sclient.Status().Patch(ctx, sqbapplication, client.RawPatch(types.MergePatchType, patch))
+	log.Info("patch canary weight", "namespace", sqbapplication.Namespace, "name", sqbapplication.Name,
+		"plane", plane, "weight", weight, "error", err)
+	return client.IgnoreNotFound(err)
+}
+
+// getCanaryWeights 灰度发布中的位面的权重，来自未删除的SQBDeployment，不包括基础环境
+func getCanaryWeights(ctx context.Context, sqbapplication *qav1alpha1.SQBApplication) (map[string]int32, error) {
+	sqbdeployments, err := listPlaneSQBDeployments(ctx, sqbapplication)
+	if err != nil {
+		return nil, err
+	}
+	baseFlag := entity.ConfigMapData.ForNamespace(sqbapplication.Namespace).BaseFlag()
+	weights := make(map[string]int32)
+	for _, sqbdeployment := range sqbdeployments {
+		plane := sqbdeployment.Labels[entity.PlaneKey]
+		if plane == baseFlag || sqbdeployment.Spec.Canary == nil || sqbdeployment.Status.Canary == nil {
+			continue
+		}
+		weights[plane] = sqbdeployment.Status.Canary.Weight
+	}
+	return weights, nil
+}
+
+// setCanaryDestinations 按灰度权重拆分基础环境route的流量，转发到灰度位面的请求带上routing的propagateHeaders。
+// 多个位面的权重之和超过100时，按位面名称的顺序分配
+func setCanaryDestinations(httpRoute *istioapi.HTTPRoute, host string, weights map[string]int32, routing *qav1alpha1.PlaneRoutingSpec) {
+	if len(httpRoute.Route) == 0 {
+		return
+	}
+	base := *httpRoute.Route[0]
+	base.Weight = 0
+	httpRoute.Route = []*istioapi.HTTPRouteDestination{&base}
+	planes := make([]string, 0, len(weights))
+	for plane := range weights {
+		planes = append(planes, plane)
+	}
+	sort.Strings(planes)
+	total := int32(0)
+	for _, plane := range planes {
+		weight := weights[plane]
+		if weight > 100-total {
+			weight = 100 - total
+		}
+		if weight <= 0 {
+			continue
+		}
+		total += weight
+		httpRoute.Route = append(httpRoute.Route, &istioapi.HTTPRouteDestination{
+			Destination: &istioapi.Destination{
+				Host:   host,
+				Subset: util.GetSubsetName(host, plane),
+			},
+			Weight:  weight,
+			Headers: planeRequestHeaders(routing, plane),
+		})
+	}
+	if total != 0 {
+		base.Weight = 100 - total
+	}
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultCanaryAnalysisInterval = time.Minute
+	// status中保留的分析结果条数
+	maxCanaryAnalysisRuns = 10
+	canaryQueryTimeout    = 10 * time.Second
+	// 连续无法得出结论的次数达到上限时计入一次失败，避免一直停在当前步骤
+	maxCanaryInconclusiveRuns = 3
+)
+
+// 默认查询istio的标准指标，destination_workload为SQBDeployment生成的deployment
+const (
+	defaultErrorRateQuery = `(sum(rate(istio_requests_total{reporter="destination",destination_workload_namespace="{{.Namespace}}",destination_workload="{{.Name}}",response_code=~"5.."}[{{.Interval}}])) or on() vector(0))` +
+		` / sum(rate(istio_requests_total{reporter="destination",destination_workload_namespace="{{.Namespace}}",destination_workload="{{.Name}}"}[{{.Interval}}])) * 100`
+	defaultLatencyQuery = `histogram_quantile(0.99, sum(rate(istio_request_duration_milliseconds_bucket{reporter="destination",destination_workload_namespace="{{.Namespace}}",destination_workload="{{.Name}}"}[{{.Interval}}])) by (le))`
+)
+
+// canaryQueryVars 查询模板中可以使用的变量
+type canaryQueryVars struct {
+	Namespace string
+	Name      string
+	Plane     string
+	Interval  string
+}
+
+func canaryAnalysisEnabled(in *qav1alpha1.SQBDeployment) bool {
+	return in.Spec.Canary != nil && in.Spec.Canary.Analysis != nil
+}
+
+// setCanaryAnalysisCondition 灰度发布因为没有配置canaryMetricsAddress或者分析无法得出结论而停在当前步骤时，
+// CanaryAnalysisReady为False，汇总到Degraded
+func setCanaryAnalysisCondition(in *qav1alpha1.SQBDeployment) {
+	status := in.Status.Canary
+	if !canaryAnalysisEnabled(in) || status == nil {
+		meta.RemoveStatusCondition(&in.Status.Conditions, qav1alpha1.ConditionCanaryAnalysisReady)
+		return
+	}
+	if status.Phase == qav1alpha1.CanaryPhaseProgressing {
+		if entity.ConfigMapData.ForNamespace(in.Namespace).CanaryMetricsAddress() == "" {
+			setCondition(&in.Status.Conditions, in.Generation, qav1alpha1.ConditionCanaryAnalysisReady, metav1.ConditionFalse,
+				qav1alpha1.ReasonCanaryMetricsUnavailable, "canaryMetricsAddress is not configured, canary is held at the current step")
+			return
+		}
+		if run := lastCanaryAnalysisRun(status); run != nil && run.Result == qav1alpha1.CanaryAnalysisInconclusive {
+			setCondition(&in.Status.Conditions, in.Generation, qav1alpha1.ConditionCanaryAnalysisReady, metav1.ConditionFalse,
+				qav1alpha1.ReasonCanaryAnalysisInconclusive, run.Message)
+			return
+		}
+	}
+	setCondition(&in.Status.Conditions, in.Generation, qav1alpha1.ConditionCanaryAnalysisReady, metav1.ConditionTrue,
+		qav1alpha1.ReasonReconcileSucceeded, "")
+}
+
+func canaryAnalysisInterval(analysis *qav1alpha1.CanaryAnalysis) time.Duration {
+	if analysis.Interval == nil || analysis.Interval.Duration <= 0 {
+		return defaultCanaryAnalysisInterval
+	}
+	return analysis.Interval.Duration
+}
+
+// lastCanaryAnalysisRun 当前步骤最近一次的分析结果
+func lastCanaryAnalysisRun(status *qav1alpha1.CanaryStatus) *qav1alpha1.CanaryAnalysisRun {
+	if len(status.Analysis) == 0 {
+		return nil
+	}
+	run := &status.Analysis[len(status.Analysis)-1]
+	if run.Step != status.Step || run.Time.Before(&status.StepStartTime) {
+		return nil
+	}
+	return run
+}
+
+func recordCanaryAnalysisRun(status *qav1alpha1.CanaryStatus, run qav1alpha1.CanaryAnalysisRun) {
+	status.Analysis = append(status.Analysis, run)
+	if len(status.Analysis) > maxCanaryAnalysisRuns {
+		status.Analysis = status.Analysis[len(status.Analysis)-maxCanaryAnalysisRuns:]
+	}
+}
+
+// runCanaryAnalysis 查询当前位面的错误率和延迟并和阈值比较，查询失败或者没有数据时结果为Inconclusive
+func runCanaryAnalysis(ctx context.Context, in *qav1alpha1.SQBDeployment, now time.Time) qav1alpha1.CanaryAnalysisRun {
+	analysis := in.Spec.Canary.Analysis
+	status := in.Status.Canary
+	run := qav1alpha1.CanaryAnalysisRun{
+		Step:   status.Step,
+		Weight: status.Weight,
+		Time:   metav1.NewTime(now),
+		Result: qav1alpha1.CanaryAnalysisSucceeded,
+	}
+	inconclusive := func(err error) qav1alpha1.CanaryAnalysisRun {
+		run.Result = qav1alpha1.CanaryAnalysisInconclusive
+		run.Message = err.Error()
+		return run
+	}
+	address := entity.ConfigMapData.ForNamespace(in.Namespace).CanaryMetricsAddress()
+	vars := canaryQueryVars{
+		Namespace: in.Namespace,
+		Name:      in.Name,
+		Plane:     in.Labels[entity.PlaneKey],
+		Interval:  fmt.Sprintf("%ds", int64(canaryAnalysisInterval(analysis).Seconds())),
+	}
+
+	if analysis.MaxErrorRate != "" {
+		threshold, err := strconv.ParseFloat(analysis.MaxErrorRate, 64)
+		if err != nil {
+			return inconclusive(fmt.Errorf("maxErrorRate: %w", err))
+		}
+		errorRate, err := queryCanaryMetric(ctx, address, analysis.ErrorRateQuery, defaultErrorRateQuery, vars, now)
+		if err != nil {
+			return inconclusive(fmt.Errorf("error rate: %w", err))
+		}
+		run.ErrorRate = strconv.FormatFloat(errorRate, 'f', 2, 64)
+		if errorRate > threshold {
+			run.Result = qav1alpha1.CanaryAnalysisFailed
+			run.Message = fmt.Sprintf("error rate %s%% exceeds %s%%", run.ErrorRate, analysis.MaxErrorRate)
+		}
+	}
+	if analysis.MaxLatency != nil {
+		latency, err := queryCanaryMetric(ctx, address, analysis.LatencyQuery, defaultLatencyQuery, vars, now)
+		if err != nil {
+			return inconclusive(fmt.Errorf("latency: %w", err))
+		}
+		latencyDuration := time.Duration(latency * float64(time.Millisecond)).Round(time.Millisecond)
+		run.Latency = latencyDuration.String()
+		if latencyDuration > analysis.MaxLatency.Duration && run.Result == qav1alpha1.CanaryAnalysisSucceeded {
+			run.Result = qav1alpha1.CanaryAnalysisFailed
+			run.Message = fmt.Sprintf("p99 latency %s exceeds %s", run.Latency, analysis.MaxLatency.Duration)
+		}
+	}
+	log.Info("canary analysis", "namespace", in.Namespace, "name", in.Name, "step", run.Step,
+		"result", run.Result, "errorRate", run.ErrorRate, "latency", run.Latency)
+	return run
+}
+
+func renderCanaryQuery(query string, vars canaryQueryVars) (string, error) {
+	tmpl, err := template.New("query").Parse(query)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err = tmpl.Execute(buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ValidateCanaryQuery 校验自定义查询的模板，只能使用canaryQueryVars中的变量
+func ValidateCanaryQuery(query string) error {
+	_, err := renderCanaryQuery(query, canaryQueryVars{})
+	return err
+}
+
+// queryCanaryMetric 通过prometheus的/api/v1/query接口查询，结果为空或者NaN时返回错误
+func queryCanaryMetric(ctx context.Context, address, query, defaultQuery string, vars canaryQueryVars, now time.Time) (float64, error) {
+	if query == "" {
+		query = defaultQuery
+	}
+	query, err := renderCanaryQuery(query, vars)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, canaryQueryTimeout)
+	defer cancel()
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("time", strconv.FormatInt(now.Unix(), 10))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address+"/api/v1/query?"+params.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	result := &struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return 0, fmt.Errorf("status %d: %w", resp.StatusCode, err)
+	}
+	if result.Status != "success" {
+		return 0, fmt.Errorf("status %d: %s", resp.StatusCode, result.Error)
+	}
+
+	// vector取第一个元素，scalar直接取值
+	var value []interface{}
+	switch result.Data.ResultType {
+	case "vector":
+		vector := make([]struct {
+			Value []interface{} `json:"value"`
+		}, 0)
+		if err = json.Unmarshal(result.Data.Result, &vector); err != nil {
+			return 0, err
+		}
+		if len(vector) == 0 {
+			return 0, fmt.Errorf("no data")
+		}
+		value = vector[0].Value
+	case "scalar":
+		if err = json.Unmarshal(result.Data.Result, &value); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("unsupported result type %s", result.Data.ResultType)
+	}
+	if len(value) != 2 {
+		return 0, fmt.Errorf("invalid value %v", value)
+	}
+	s, ok := value[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid value %v", value)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) {
+		return 0, fmt.Errorf("no data")
+	}
+	return f, nil
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"gotest.tools/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMetricsServer 模拟prometheus的/api/v1/query接口，按查询中的指标名返回结果
+type fakeMetricsServer struct {
+	sync.Mutex
+	errorRate string
+	latency   string
+	queries   []string
+}
+
+func (s *fakeMetricsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	if r.URL.Path != "/api/v1/query" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query().Get("query")
+	s.queries = append(s.queries, query)
+	value := s.errorRate
+	if strings.Contains(query, "istio_request_duration_milliseconds_bucket") {
+		value = s.latency
+	}
+	if value == "" {
+		_, _ = fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		return
+	}
+	_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[%d,"%s"]}]}}`,
+		time.Now().Unix(), value)
+}
+
+func (s *fakeMetricsServer) set(errorRate, latency string) {
+	s.Lock()
+	defer s.Unlock()
+	s.errorRate = errorRate
+	s.latency = latency
+}
+
+func TestCanaryAnalysis(t *testing.T) {
+	SetK8sLog(ctrl.Log.WithName("test"))
+	metrics := &fakeMetricsServer{}
+	server := httptest.NewServer(metrics)
+	defer server.Close()
+	entity.ConfigMapData.FromMap(map[string]string{"canaryMetricsAddress": server.URL})
+	defer entity.ConfigMapData.FromMap(map[string]string{})
+
+	ctx := context.Background()
+	now := time.Now()
+	in := &qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-feature-a", Namespace: "default",
+		Labels: map[string]string{entity.PlaneKey: "feature-a"}, Generation: 1}}
+	in.Spec.Canary = &qav1alpha1.CanarySpec{
+		Steps: []qav1alpha1.CanaryStep{
+			{Weight: 10, Pause: &metav1.Duration{Duration: 30 * time.Second}},
+			{Weight: 50, Pause: &metav1.Duration{Duration: 3 * time.Minute}},
+			{Weight: 100},
+		},
+		Analysis: &qav1alpha1.CanaryAnalysis{
+			MaxErrorRate: "1",
+			MaxLatency:   &metav1.Duration{Duration: 500 * time.Millisecond},
+			FailureLimit: 2,
+		},
+	}
+
+	// 进入步骤一个interval之后才分析，pause比interval短时等待分析
+	assert.Equal(t, advanceCanary(ctx, in, now), 30*time.Second)
+	assert.Equal(t, advanceCanary(ctx, in, now.Add(30*time.Second)), 30*time.Second)
+	assert.Equal(t, len(metrics.queries), 0)
+
+	// 没有数据时不推进，也不计入失败次数
+	now = now.Add(time.Minute)
+	assert.Equal(t, advanceCanary(ctx, in, now), time.Minute)
+	assert.Equal(t, in.Status.Canary.Step, int32(0))
+	assert.Equal(t, in.Status.Canary.Failures, int32(0))
+	assert.Equal(t, in.Status.Canary.Inconclusive, int32(1))
+	assert.Equal(t, in.Status.Canary.Analysis[0].Result, qav1alpha1.CanaryAnalysisInconclusive)
+	setCanaryAnalysisCondition(in)
+	condition := meta.FindStatusCondition(in.Status.Conditions, qav1alpha1.ConditionCanaryAnalysisReady)
+	assert.Equal(t, condition.Status, metav1.ConditionFalse)
+	assert.Equal(t, condition.Reason, qav1alpha1.ReasonCanaryAnalysisInconclusive)
+	assert.Assert(t, strings.Contains(metrics.queries[0], `destination_workload="app-feature-a"`))
+	assert.Assert(t, strings.Contains(metrics.queries[0], `[60s]`))
+
+	// 分析成功后进入下一步
+	metrics.set("0.5", "120.4")
+	now = now.Add(time.Minute)
+	assert.Equal(t, advanceCanary(ctx, in, now), time.Minute)
+	assert.Equal(t, in.Status.Canary.Step, int32(1))
+	assert.Equal(t, in.Status.Canary.Weight, int32(50))
+	run := in.Status.Canary.Analysis[1]
+	assert.Equal(t, run.Result, qav1alpha1.CanaryAnalysisSucceeded)
+	assert.Equal(t, run.Step, int32(0))
+	assert.Equal(t, run.ErrorRate, "0.50")
+	assert.Equal(t, run.Latency, "120ms")
+	assert.Equal(t, in.Status.Canary.Inconclusive, int32(0))
+	setCanaryAnalysisCondition(in)
+	assert.Equal(t, meta.IsStatusConditionTrue(in.Status.Conditions, qav1alpha1.ConditionCanaryAnalysisReady), true)
+
+	// 未到分析时间不查询
+	queries := len(metrics.queries)
+	assert.Equal(t, advanceCanary(ctx, in, now.Add(10*time.Second)), 50*time.Second)
+	assert.Equal(t, len(metrics.queries), queries)
+
+	// 连续失败达到failureLimit时回滚
+	metrics.set("0.5", "800")
+	now = now.Add(time.Minute)
+	assert.Equal(t, advanceCanary(ctx, in, now), time.Minute)
+	assert.Equal(t, in.Status.Canary.Failures, int32(1))
+	assert.Equal(t, in.Status.Canary.Phase, qav1alpha1.CanaryPhaseProgressing)
+	assert.Equal(t, in.Status.Canary.Analysis[2].Message, "p99 latency 800ms exceeds 500ms")
+	metrics.set("5", "100")
+	now = now.Add(time.Minute)
+	assert.Equal(t, advanceCanary(ctx, in, now), time.Duration(0))
+	assert.Equal(t, in.Status.Canary.Phase, qav1alpha1.CanaryPhaseRolledBack)
+	assert.Equal(t, in.Status.Canary.Weight, int32(0))
+	assert.Equal(t, in.Status.Canary.Analysis[3].Result, qav1alpha1.CanaryAnalysisFailed)
+	assert.Assert(t, !isCanaryProgressing(in))
+
+	// 回滚后保持，spec修改后重新开始
+	metrics.set("0", "100")
+	assert.Equal(t, advanceCanary(ctx, in, now.Add(time.Hour)), time.Duration(0))
+	assert.Equal(t, in.Status.Canary.Weight, int32(0))
+	in.Generation = 2
+	assert.Equal(t, advanceCanary(ctx, in, now), 30*time.Second)
+	assert.Equal(t, in.Status.Canary.Phase, qav1alpha1.CanaryPhaseProgressing)
+	assert.Equal(t, in.Status.Canary.Weight, int32(10))
+	assert.Equal(t, len(in.Status.Canary.Analysis), 0)
+
+	// 没有配置canaryMetricsAddress时停在当前步骤，Degraded为True
+	entity.ConfigMapData.FromMap(map[string]string{})
+	assert.Equal(t, advanceCanary(ctx, in, now.Add(time.Hour)), time.Minute)
+	assert.Equal(t, in.Status.Canary.Step, int32(0))
+	assert.Equal(t, in.Status.Canary.Phase, qav1alpha1.CanaryPhaseProgressing)
+	setCanaryAnalysisCondition(in)
+	setReconcileSucceeded(&in.Status.Conditions, in.Generation)
+	condition = meta.FindStatusCondition(in.Status.Conditions, qav1alpha1.ConditionDegraded)
+	assert.Equal(t, condition.Status, metav1.ConditionTrue)
+	assert.Equal(t, condition.Reason, qav1alpha1.ReasonCanaryMetricsUnavailable)
+
+	// 连续3次无法得出结论时计入一次失败
+	entity.ConfigMapData.FromMap(map[string]string{"canaryMetricsAddress": server.URL})
+	metrics.set("", "")
+	for i := 1; i <= 3; i++ {
+		assert.Equal(t, advanceCanary(ctx, in, now.Add(time.Duration(i)*time.Minute)), time.Minute)
+	}
+	assert.Equal(t, in.Status.Canary.Step, int32(0))
+	assert.Equal(t, in.Status.Canary.Failures, int32(1))
+	assert.Equal(t, in.Status.Canary.Inconclusive, int32(0))
+	for i := 4; i <= 6; i++ {
+		advanceCanary(ctx, in, now.Add(time.Duration(i)*time.Minute))
+	}
+	assert.Equal(t, in.Status.Canary.Phase, qav1alpha1.CanaryPhaseRolledBack)
+
+	// 没有配置analysis时删除condition
+	in.Spec.Canary.Analysis = nil
+	setCanaryAnalysisCondition(in)
+	assert.Assert(t, meta.FindStatusCondition(in.Status.Conditions, qav1alpha1.ConditionCanaryAnalysisReady) == nil)
+}
+
+func TestQueryCanaryMetric(t *testing.T) {
+	responses := map[string]string{
+		"scalar":  `{"status":"success","data":{"resultType":"scalar","result":[1600000000,"1.5"]}}`,
+		"nan":     `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1600000000,"NaN"]}]}}`,
+		"error":   `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+		"matrix":  `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+		"invalid": `not json`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, responses[r.URL.Query().Get("query")])
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	vars := canaryQueryVars{Namespace: "default", Name: "app", Interval: "60s"}
+
+	value, err := queryCanaryMetric(ctx, server.URL, "scalar", "", vars, time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, value, 1.5)
+	for _, query := range []string{"nan", "error", "matrix", "invalid"} {
+		_, err = queryCanaryMetric(ctx, server.URL, query, "", vars, time.Now())
+		assert.Assert(t, err != nil, query)
+	}
+
+	assert.NilError(t, ValidateCanaryQuery(defaultErrorRateQuery))
+	assert.NilError(t, ValidateCanaryQuery(defaultLatencyQuery))
+	assert.Assert(t, ValidateCanaryQuery(`sum(x{app="{{.App}}"})`) != nil)
+	assert.Assert(t, ValidateCanaryQuery(`sum(x{app="{{.Name}"})`) != nil)
+}
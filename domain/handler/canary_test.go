@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"github.com/wosai/elastic-env-operator/domain/util"
+	"gotest.tools/assert"
+	istioapi "istio.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+	"time"
+)
+
+func TestAdvanceCanary(t *testing.T) {
+	SetK8sLog(ctrl.Log.WithName("test"))
+	now := time.Now()
+	in := &qav1alpha1.SQBDeployment{}
+	assert.Equal(t, advanceCanary(context.Background(), in, now), time.Duration(0))
+	assert.Assert(t, in.Status.Canary == nil)
+
+	in.Spec.Canary = &qav1alpha1.CanarySpec{Steps: []qav1alpha1.CanaryStep{
+		{Weight: 10, Pause: &metav1.Duration{Duration: time.Minute}},
+		{Weight: 30, Pause: &metav1.Duration{Duration: time.Minute}},
+		{Weight: 50},
+		{Weight: 100},
+	}}
+	assert.Equal(t, advanceCanary(context.Background(), in, now), time.Minute)
+	assert.Equal(t, in.Status.Canary.Weight, int32(10))
+	assert.Equal(t, in.Status.Canary.Phase, qav1alpha1.CanaryPhaseProgressing)
+	assert.Assert(t, isCanaryProgressing(in))
+
+	// 未到时间不推进
+	assert.Equal(t, advanceCanary(context.Background(), in, now.Add(20*time.Second)), 40*time.Second)
+	assert.Equal(t, in.Status.Canary.Step, int32(0))
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, advanceCanary(context.Background(), in, now), time.Minute)
+	assert.Equal(t, in.Status.Canary.Step, int32(1))
+	assert.Equal(t, in.Status.Canary.Weight, int32(30))
+
+	// 没有pause的步骤停止推进
+	now = now.Add(time.Minute)
+	assert.Equal(t, advanceCanary(context.Background(), in, now), time.Duration(0))
+	assert.Equal(t, in.Status.Canary.Step, int32(2))
+	assert.Equal(t, in.Status.Canary.Weight, int32(50))
+	assert.Equal(t, in.Status.Canary.Phase, qav1alpha1.CanaryPhasePaused)
+	assert.Assert(t, !isCanaryProgressing(in))
+
+	// 修改steps后从第一步重新开始
+	in.Spec.Canary.Steps[2].Pause = &metav1.Duration{Duration: time.Minute}
+	now = now.Add(time.Minute)
+	assert.Equal(t, advanceCanary(context.Background(), in, now), time.Minute)
+	assert.Equal(t, in.Status.Canary.Step, int32(0))
+	assert.Equal(t, in.Status.Canary.Weight, int32(10))
+	assert.Equal(t, in.Status.Canary.StepStartTime.Time, now)
+	assert.Equal(t, in.Status.Canary.Phase, qav1alpha1.CanaryPhaseProgressing)
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Minute)
+		advanceCanary(context.Background(), in, now)
+	}
+	assert.Equal(t, in.Status.Canary.Weight, int32(100))
+	assert.Equal(t, in.Status.Canary.Phase, qav1alpha1.CanaryPhaseCompleted)
+
+	// 升级前的status没有记录hash时沿用当前进度，steps缩短时停在最后一步
+	in.Status.Canary.StepsHash = ""
+	in.Spec.Canary.Steps = in.Spec.Canary.Steps[:2]
+	assert.Equal(t, advanceCanary(context.Background(), in, now.Add(time.Minute)), time.Duration(0))
+	assert.Equal(t, in.Status.Canary.Step, int32(1))
+	assert.Equal(t, in.Status.Canary.Weight, int32(30))
+	assert.Equal(t, in.Status.Canary.StepsHash, canaryStepsHash(in.Spec.Canary.Steps))
+
+	in.Spec.Canary = nil
+	advanceCanary(context.Background(), in, now)
+	assert.Assert(t, in.Status.Canary == nil)
+}
+
+func TestSetCanaryDestinations(t *testing.T) {
+	base := func() *istioapi.HTTPRoute {
+		return &istioapi.HTTPRoute{Route: []*istioapi.HTTPRouteDestination{
+			{Destination: &istioapi.Destination{Host: "app", Subset: util.GetSubsetName("app", "base")}},
+		}}
+	}
+	route := base()
+	setCanaryDestinations(route, "app", nil, defaultPlaneRouting())
+	assert.Equal(t, len(route.Route), 1)
+	assert.Equal(t, route.Route[0].Weight, int32(0))
+
+	route = base()
+	setCanaryDestinations(route, "app", map[string]int32{"feature-b": 70, "feature-a": 20, "feature-c": 30}, defaultPlaneRouting())
+	assert.Equal(t, len(route.Route), 4)
+	assert.Equal(t, route.Route[0].Weight, int32(0))
+	assert.Equal(t, route.Route[1].Destination.Subset, util.GetSubsetName("app", "feature-a"))
+	assert.Equal(t, route.Route[1].Weight, int32(20))
+	assert.Equal(t, route.Route[1].Headers.Request.Set[entity.XEnvFlag], "feature-a")
+	assert.Equal(t, route.Route[2].Destination.Subset, util.GetSubsetName("app", "feature-b"))
+	assert.Equal(t, route.Route[2].Weight, int32(70))
+	// 超过100的部分不再分配
+	assert.Equal(t, route.Route[3].Destination.Subset, util.GetSubsetName("app", "feature-c"))
+	assert.Equal(t, route.Route[3].Weight, int32(10))
+
+	route = base()
+	setCanaryDestinations(route, "app", map[string]int32{"feature-a": 20}, defaultPlaneRouting())
+	assert.Equal(t, len(route.Route), 2)
+	assert.Equal(t, route.Route[0].Weight, int32(80))
+
+	// 权重为0的位面不生成destination
+	route = base()
+	setCanaryDestinations(route, "app", map[string]int32{"feature-a": 0}, defaultPlaneRouting())
+	assert.Equal(t, len(route.Route), 1)
+	assert.Equal(t, route.Route[0].Weight, int32(0))
+}
+
+func TestSyncCanaryWeight(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = qav1alpha1.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	sqbapplication := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	sqbapplication.Status.CanaryWeights = map[string]int32{"feature-b": 20}
+	SetK8sClient(fake.NewClientBuilder().WithScheme(scheme).WithObjects(sqbapplication).Build())
+	ctx := context.Background()
+	in := &qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-feature-a", Namespace: "default",
+		Labels: map[string]string{entity.PlaneKey: "feature-a"}}}
+	in.Spec.Selector = qav1alpha1.Selector{App: "app", Plane: "feature-a"}
+	in.Status.Canary = &qav1alpha1.CanaryStatus{Weight: 10}
+
+	assert.NilError(t, syncCanaryWeight(ctx, in, false))
+	assert.NilError(t, k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbapplication), sqbapplication))
+	assert.DeepEqual(t, sqbapplication.Status.CanaryWeights, map[string]int32{"feature-a": 10, "feature-b": 20})
+
+	assert.NilError(t, syncCanaryWeight(ctx, in, true))
+	sqbapplication = &qav1alpha1.SQBApplication{}
+	assert.NilError(t, k8sclient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app"}, sqbapplication))
+	assert.DeepEqual(t, sqbapplication.Status.CanaryWeights, map[string]int32{"feature-b": 20})
+}
@@ -10,25 +10,36 @@ import (
 	"github.com/wosai/elastic-env-operator/domain/util"
 	appv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"math"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
-	"time"
+)
+
+const (
+	// 启用HPA时接管operator管理的副本数
+	hpaHandoverFieldManager = "handover-to-hpa"
+	// lifecycle.init和initContainerImage使用的初始化容器名称，sidecar不能使用
+	InitContainerName = "init0"
 )
 
 type deploymentHandler struct {
 	sqbdeployment *qav1alpha1.SQBDeployment
+	deploy        *qav1alpha1.DeploySpec
 	ctx           context.Context
 	req           ctrl.Request
 }
 
-func NewDeploymentHandler(sqbdeployment *qav1alpha1.SQBDeployment, ctx context.Context) *deploymentHandler {
-	return &deploymentHandler{sqbdeployment: sqbdeployment, ctx: ctx}
+func NewDeploymentHandler(sqbdeployment *qav1alpha1.SQBDeployment, deploy *qav1alpha1.DeploySpec, ctx context.Context) *deploymentHandler {
+	return &deploymentHandler{sqbdeployment: sqbdeployment, deploy: deploy, ctx: ctx}
 }
 
 func NewDeploymentHandlerWithReq(req ctrl.Request, ctx context.Context) *deploymentHandler {
@@ -36,11 +47,13 @@ func NewDeploymentHandlerWithReq(req ctrl.Request, ctx context.Context) *deploym
 }
 
 func (h *deploymentHandler) CreateOrUpdate() error {
-	deployment := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
-	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: deployment.Namespace, Name: deployment.Name}, deployment)
+	// 集群中的deployment只用于读取不可变的selector，apply的对象只包含operator渲染的字段
+	live := &appv1.Deployment{}
+	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}, live)
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
+	deployment := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
 
 	sqbapplication := &qav1alpha1.SQBApplication{}
 	if err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Spec.Selector.App},
@@ -57,7 +70,7 @@ func (h *deploymentHandler) CreateOrUpdate() error {
 		}
 	}
 
-	deploy := h.sqbdeployment.Spec.DeploySpec
+	deploy := h.deploy
 	volumes, volumeMounts := h.getVolumeAndVolumeMounts(deploy.Volumes)
 	// 临时处理：/etc/podinfo不挂业务容器，避免与arms冲突  todo
 	containerMounts := make([]corev1.VolumeMount, 0)
@@ -94,9 +107,10 @@ func (h *deploymentHandler) CreateOrUpdate() error {
 		container.Lifecycle = &lifecycle
 	}
 
-	deployment.Labels = util.MergeStringMap(deployment.Labels, h.sqbdeployment.Labels)
+	deployment.Labels = util.MergeStringMap(nil, h.sqbdeployment.Labels)
 	deployment.Spec.Replicas = deploy.Replicas
 	// 从apps/v1beta2开始，deployment的selector是不可变的。兼容线上配置，线上存量的label.app=appname+ "-ack"
+	deployment.Spec.Selector = live.Spec.Selector
 	if deployment.Spec.Selector == nil {
 		deployment.Spec.Selector = &metav1.LabelSelector{
 			MatchLabels: map[string]string{
@@ -108,10 +122,14 @@ func (h *deploymentHandler) CreateOrUpdate() error {
 		deployment.Spec.Selector.MatchLabels)
 	deployment.Spec.Template.Spec.Volumes = volumes
 	deployment.Spec.Template.Spec.HostAliases = deploy.HostAlias
-	containers := []corev1.Container{container}
+	sidecars, err := h.sidecarContainers(container)
+	if err != nil {
+		return err
+	}
+	containers := append([]corev1.Container{container}, sidecars...)
 
 	deployment.Spec.Template.Spec.Containers = containers
-	deployment.Spec.Template.Spec.ImagePullSecrets = entity.ConfigMapData.GetImagePullSecrets()
+	deployment.Spec.Template.Spec.ImagePullSecrets = entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).GetImagePullSecrets()
 
 	if anno, ok := h.sqbdeployment.Annotations[entity.PodAnnotationKey]; ok {
 		deployment.Spec.Template.Annotations = make(map[string]string)
@@ -126,21 +144,19 @@ func (h *deploymentHandler) CreateOrUpdate() error {
 	if anno, ok := h.sqbdeployment.Annotations[entity.DeploymentAnnotationKey]; ok {
 		deployment.Annotations = make(map[string]string)
 		_ = json.Unmarshal([]byte(anno), &deployment.Annotations)
-	} else {
-		deployment.Annotations = nil
 	}
 	// 去掉jaeger注解和label
 	delete(deployment.Annotations, "sidecar.jaegertracing.io/inject")
 	delete(deployment.Labels, "sidecar.jaegertracing.io/injected")
 	delete(deployment.Spec.Template.Labels, "sidecar.jaegertracing.io/injected")
 	// init lifecycle
-	image := entity.ConfigMapData.InitContainerImage()
+	image := entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).InitContainerImage()
 	if (deploy.Lifecycle != nil && deploy.Lifecycle.Init != nil) || image != "" {
 		if image == "" {
 			image = "busybox:1.32"
 		}
 		initContainer := corev1.Container{
-			Name:            "init0",
+			Name:            InitContainerName,
 			Image:           image,
 			Env:             deploy.Env,
 			VolumeMounts:    volumeMounts,
@@ -155,16 +171,115 @@ func (h *deploymentHandler) CreateOrUpdate() error {
 	h.addStartupProbe(deployment)
 	h.addPodAntiAffinity(deployment)
 	h.addVaultConfig(deployment)
-	h.configRollingUpdate(deployment)
 	controllerutil.AddFinalizer(deployment, entity.FINALIZER)
 	if err = h.additionalSpec(deployment); err != nil {
 		return err
 	}
-	return CreateOrUpdate(h.ctx, deployment)
+	// 在合并deploymentSpec之后设置默认值，mergo不会覆盖已有的值
+	h.configRollingUpdate(deployment)
+	// 启用HPA后副本数由HPA管理
+	if deploy.AutoscalingEnabled() {
+		deployment.Spec.Replicas = nil
+		if err = h.handoverReplicas(live); err != nil {
+			return err
+		}
+	}
+	// DeploymentReady由deployment的滚动更新状态决定，不是创建或更新成功就ready
+	if err = Apply(h.ctx, deployment); err != nil {
+		setCondition(&h.sqbdeployment.Status.Conditions, h.sqbdeployment.Generation,
+			qav1alpha1.ConditionDeploymentReady, metav1.ConditionFalse, qav1alpha1.ReasonReconcileFailed, err.Error())
+		return err
+	}
+	setRolloutStatus(h.sqbdeployment, deployment)
+	return nil
+}
+
+// apply不再包含replicas时，如果replicas只属于operator会被删除并重置为默认值，
+// 所以先由hpaHandoverFieldManager以当前副本数apply一次，之后由HPA接管
+func (h *deploymentHandler) handoverReplicas(live *appv1.Deployment) error {
+	if live.CreationTimestamp.IsZero() || live.Spec.Replicas == nil ||
+		!ownsField(live, FieldManager, "f:spec", "f:replicas") {
+		return nil
+	}
+	handover := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"namespace": live.Namespace,
+			"name":      live.Name,
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(*live.Spec.Replicas),
+		},
+	}}
+	err := k8sclient.Patch(h.ctx, handover, client.Apply, client.FieldOwner(hpaHandoverFieldManager))
+	log.Info("handover replicas to hpa", "namespace", live.Namespace, "name", live.Name,
+		"replicas", *live.Spec.Replicas, "error", err)
+	return err
+}
+
+// sidecarContainers 按配置共享主容器的env和volumeMounts。只apply配置中的容器，
+// 其他field manager添加到deployment的容器不受影响
+func (h *deploymentHandler) sidecarContainers(main corev1.Container) ([]corev1.Container, error) {
+	containers := make([]corev1.Container, 0, len(h.deploy.Sidecars))
+	for _, sidecar := range h.deploy.Sidecars {
+		container := sidecar.Container.DeepCopy()
+		if container.Name == main.Name || container.Name == InitContainerName {
+			return nil, fmt.Errorf("sidecar %s conflicts with main container or init container", container.Name)
+		}
+		if sidecar.ShareEnv {
+			env := make([]corev1.EnvVar, 0, len(main.Env)+len(container.Env))
+			for _, e := range main.Env {
+				if !hasEnv(container.Env, e.Name) {
+					env = append(env, e)
+				}
+			}
+			container.Env = append(env, container.Env...)
+		}
+		if sidecar.ShareVolumeMounts {
+			mounts := make([]corev1.VolumeMount, 0, len(main.VolumeMounts)+len(container.VolumeMounts))
+			for _, mount := range main.VolumeMounts {
+				if !hasVolumeMount(container.VolumeMounts, mount.MountPath) {
+					mounts = append(mounts, mount)
+				}
+			}
+			container.VolumeMounts = append(mounts, container.VolumeMounts...)
+		}
+		containers = append(containers, *container)
+	}
+	return containers, nil
+}
+
+func hasEnv(env []corev1.EnvVar, name string) bool {
+	for _, e := range env {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVolumeMount(mounts []corev1.VolumeMount, mountPath string) bool {
+	for _, mount := range mounts {
+		if mount.MountPath == mountPath {
+			return true
+		}
+	}
+	return false
+}
+
+// mainContainer 与deployment同名的业务容器
+func mainContainer(deployment *appv1.Deployment) *corev1.Container {
+	for i := range deployment.Spec.Template.Spec.Containers {
+		if container := &deployment.Spec.Template.Spec.Containers[i]; container.Name == deployment.Name {
+			return container
+		}
+	}
+	return nil
 }
 
 func (h *deploymentHandler) additionalSpec(deployment *appv1.Deployment) error {
-	if specString := entity.ConfigMapData.DeploymentSpec(); specString != "" && deployment.Namespace == "sqb" {
+	if specString := entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).DeploymentSpecByNamespace(deployment.Namespace); specString != "" {
 		if err := h.merge(deployment, specString); err != nil {
 			return err
 		}
@@ -270,10 +385,15 @@ func (h *deploymentHandler) getVolumeAndVolumeMounts(volumemap []*qav1alpha1.Vol
 }
 
 func (h *deploymentHandler) configRollingUpdate(deployment *appv1.Deployment) {
+	// 没有配置strategy时默认为RollingUpdate
+	if deployment.Spec.Strategy.Type == "" {
+		deployment.Spec.Strategy.Type = appv1.RollingUpdateDeploymentStrategyType
+	}
 	if deployment.Spec.Strategy.Type == appv1.RollingUpdateDeploymentStrategyType {
 		maxUnavailable := intstr.FromInt(0)
 		if deployment.Spec.Strategy.RollingUpdate != nil {
-			if deployment.Spec.Strategy.RollingUpdate.MaxUnavailable.String() == "25%" {
+			if current := deployment.Spec.Strategy.RollingUpdate.MaxUnavailable; current == nil ||
+				current.String() == "25%" {
 				deployment.Spec.Strategy.RollingUpdate.MaxUnavailable = &maxUnavailable
 			}
 		} else {
@@ -293,7 +413,7 @@ func (h *deploymentHandler) addVaultConfig(deployment *appv1.Deployment) {
 }
 
 func (h *deploymentHandler) addNodeAffinity(deployment *appv1.Deployment) {
-	deploy := h.sqbdeployment.Spec
+	deploy := h.deploy
 	if deploy.NodeAffinity != nil {
 		nodeAffinity := &corev1.NodeAffinity{}
 		if len(deploy.NodeAffinity.Require) != 0 {
@@ -346,25 +466,30 @@ func (h *deploymentHandler) addNodeAffinity(deployment *appv1.Deployment) {
 }
 
 func (h *deploymentHandler) addStartupProbe(deployment *appv1.Deployment) {
-	deploy := h.sqbdeployment.Spec.DeploySpec
-	if deploy.HealthCheck != nil {
-		initialDelaySeconds := int32(math.Max(float64(deploy.HealthCheck.InitialDelaySeconds), 180))
+	container := mainContainer(deployment)
+	if container == nil {
+		return
+	}
+	if h.deploy.HealthCheck != nil {
+		// 复制一份，避免修改生效配置
+		healthCheck := h.deploy.HealthCheck.DeepCopy()
+		initialDelaySeconds := int32(math.Max(float64(healthCheck.InitialDelaySeconds), 180))
 		startupProbe := &corev1.Probe{
-			InitialDelaySeconds: deploy.HealthCheck.InitialDelaySeconds,
+			InitialDelaySeconds: healthCheck.InitialDelaySeconds,
 			PeriodSeconds:       10,
 			SuccessThreshold:    1,
 			FailureThreshold:    initialDelaySeconds / 10,
-			TimeoutSeconds:      deploy.HealthCheck.TimeoutSeconds,
-			Handler:             deploy.HealthCheck.Handler,
+			TimeoutSeconds:      healthCheck.TimeoutSeconds,
+			Handler:             healthCheck.Handler,
 		}
-		deploy.HealthCheck.InitialDelaySeconds = 10
-		deployment.Spec.Template.Spec.Containers[0].LivenessProbe = deploy.HealthCheck
-		deployment.Spec.Template.Spec.Containers[0].ReadinessProbe = deploy.HealthCheck
-		deployment.Spec.Template.Spec.Containers[0].StartupProbe = startupProbe
+		healthCheck.InitialDelaySeconds = 10
+		container.LivenessProbe = healthCheck
+		container.ReadinessProbe = healthCheck
+		container.StartupProbe = startupProbe
 	} else {
-		deployment.Spec.Template.Spec.Containers[0].LivenessProbe = nil
-		deployment.Spec.Template.Spec.Containers[0].ReadinessProbe = nil
-		deployment.Spec.Template.Spec.Containers[0].StartupProbe = nil
+		container.LivenessProbe = nil
+		container.ReadinessProbe = nil
+		container.StartupProbe = nil
 	}
 }
 
@@ -402,7 +527,7 @@ func (h *deploymentHandler) addPodAntiAffinity(deployment *appv1.Deployment) {
 
 func (h *deploymentHandler) Delete() error {
 	deployment := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
-	return Delete(h.ctx, deployment)
+	return deleteOrRetain(h.ctx, deployment, h.sqbdeployment)
 }
 
 func (h *deploymentHandler) Handle() error {
@@ -414,7 +539,6 @@ func (h *deploymentHandler) Handle() error {
 
 func (h *deploymentHandler) GetInstance() (runtimeObj, error) {
 	in := &appv1.Deployment{}
-	time.Sleep(200 * time.Millisecond) // 很奇怪，predicate过滤的是有deletionTimestamp的，但是取出来的deployment确没有，等200ms之后取出来才有
 	err := k8sclient.Get(h.ctx, h.req.NamespacedName, in)
 	return in, err
 }
@@ -427,6 +551,10 @@ func (h *deploymentHandler) Operate(obj runtimeObj) error {
 	in := obj.(*appv1.Deployment)
 	app := in.Labels[entity.AppKey]
 	plane := in.Labels[entity.PlaneKey]
+	// 更新sqbdeployment的status
+	if err := h.updateSqbDeploymentStatus(in); err != nil {
+		return err
+	}
 	// 更新sqbapplication的status
 	deployments := &appv1.DeploymentList{}
 	if app != "" {
@@ -442,9 +570,9 @@ func (h *deploymentHandler) Operate(obj runtimeObj) error {
 		mirrors := make(map[string]int)
 		for _, deployment := range deployments.Items {
 			if deployment.DeletionTimestamp.IsZero() {
-				mirrors[deployment.Name] = 1
+				mirrors[deployment.Name] = int(deployment.Status.ReadyReplicas)
 				if p, ok := deployment.Labels[entity.PlaneKey]; ok {
-					planes[p] = 1
+					planes[p] += int(deployment.Status.ReadyReplicas)
 				}
 			}
 		}
@@ -455,7 +583,9 @@ func (h *deploymentHandler) Operate(obj runtimeObj) error {
 				return err
 			}
 		} else {
-			if sqbapplication.DeletionTimestamp.IsZero() {
+			if sqbapplication.DeletionTimestamp.IsZero() && (sqbapplication.Status.ErrorInfo != "" ||
+				!reflect.DeepEqual(sqbapplication.Status.Planes, planes) ||
+				!reflect.DeepEqual(sqbapplication.Status.Mirrors, mirrors)) {
 				sqbapplication.Status.Planes = planes
 				sqbapplication.Status.Mirrors = mirrors
 				sqbapplication.Status.ErrorInfo = ""
@@ -478,7 +608,7 @@ func (h *deploymentHandler) Operate(obj runtimeObj) error {
 		mirrors := make(map[string]int)
 		for _, deployment := range deployments.Items {
 			if deployment.DeletionTimestamp.IsZero() {
-				mirrors[deployment.Name] = 1
+				mirrors[deployment.Name] = int(deployment.Status.ReadyReplicas)
 			}
 		}
 		sqbplane := &qav1alpha1.SQBPlane{}
@@ -488,7 +618,8 @@ func (h *deploymentHandler) Operate(obj runtimeObj) error {
 				return err
 			}
 		} else {
-			if sqbplane.DeletionTimestamp.IsZero() {
+			if sqbplane.DeletionTimestamp.IsZero() && (sqbplane.Status.ErrorInfo != "" ||
+				!reflect.DeepEqual(sqbplane.Status.Mirrors, mirrors)) {
 				sqbplane.Status.Mirrors = mirrors
 				sqbplane.Status.ErrorInfo = ""
 				if err = UpdateStatus(h.ctx, sqbplane); err != nil {
@@ -500,12 +631,96 @@ func (h *deploymentHandler) Operate(obj runtimeObj) error {
 	// 删除deployment的时候，先更新sqbapplication和sqbplane的状态，再进行删除
 	// finalizer主要是为了避免，deployment删除之后，get不到
 	if !in.DeletionTimestamp.IsZero() {
-		controllerutil.RemoveFinalizer(in, entity.FINALIZER)
-		return CreateOrUpdate(h.ctx, in)
+		return removeFinalizer(h.ctx, in)
 	}
 	return nil
 }
 
+// 将deployment的滚动更新状态同步到同名的sqbdeployment
+func (h *deploymentHandler) updateSqbDeploymentStatus(deployment *appv1.Deployment) error {
+	if !deployment.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	sqbdeployment := &qav1alpha1.SQBDeployment{}
+	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: deployment.Namespace, Name: deployment.Name}, sqbdeployment)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !sqbdeployment.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	status := sqbdeployment.Status.DeepCopy()
+	setRolloutStatus(sqbdeployment, deployment)
+	// 上一次调和失败的话，保留失败的状态
+	if degraded := meta.FindStatusCondition(sqbdeployment.Status.Conditions, qav1alpha1.ConditionDegraded); degraded == nil ||
+		degraded.Reason != qav1alpha1.ReasonReconcileFailed {
+		setReconcileSucceeded(&sqbdeployment.Status.Conditions, sqbdeployment.Generation)
+	}
+	if equality.Semantic.DeepEqual(status, &sqbdeployment.Status) {
+		return nil
+	}
+	return UpdateStatus(h.ctx, sqbdeployment)
+}
+
+// 根据deployment的status计算滚动更新的阶段，逻辑与kubectl rollout status一致
+func getRolloutPhase(deployment *appv1.Deployment) (qav1alpha1.RolloutPhase, string, string) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return qav1alpha1.RolloutPhaseProgressing, qav1alpha1.ReasonRolloutInProgress,
+			"waiting for deployment spec update to be observed"
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return qav1alpha1.RolloutPhaseFailed, qav1alpha1.ReasonProgressDeadlineExceeded, condition.Message
+		}
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	if status.UpdatedReplicas < replicas {
+		return qav1alpha1.RolloutPhaseProgressing, qav1alpha1.ReasonRolloutInProgress,
+			fmt.Sprintf("%d out of %d new replicas have been updated", status.UpdatedReplicas, replicas)
+	}
+	if status.Replicas > status.UpdatedReplicas {
+		return qav1alpha1.RolloutPhaseProgressing, qav1alpha1.ReasonRolloutInProgress,
+			fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas)
+	}
+	if status.AvailableReplicas < status.UpdatedReplicas {
+		return qav1alpha1.RolloutPhaseProgressing, qav1alpha1.ReasonRolloutInProgress,
+			fmt.Sprintf("%d of %d updated replicas are available", status.AvailableReplicas, status.UpdatedReplicas)
+	}
+	return qav1alpha1.RolloutPhaseComplete, qav1alpha1.ReasonRolloutComplete, ""
+}
+
+// 将deployment的副本数、镜像和滚动更新状态记录到sqbdeployment的status
+func setRolloutStatus(sqbdeployment *qav1alpha1.SQBDeployment, deployment *appv1.Deployment) {
+	sqbdeployment.Status.Replicas = deployment.Status.Replicas
+	sqbdeployment.Status.ReadyReplicas = deployment.Status.ReadyReplicas
+	sqbdeployment.Status.UpdatedReplicas = deployment.Status.UpdatedReplicas
+	sqbdeployment.Status.AvailableReplicas = deployment.Status.AvailableReplicas
+	sqbdeployment.Status.Image = ""
+	if container := mainContainer(deployment); container != nil {
+		sqbdeployment.Status.Image = container.Image
+	}
+
+	phase, reason, message := getRolloutPhase(deployment)
+	sqbdeployment.Status.Phase = phase
+	generation := sqbdeployment.Generation
+	conditions := &sqbdeployment.Status.Conditions
+	switch phase {
+	case qav1alpha1.RolloutPhaseComplete:
+		setCondition(conditions, generation, qav1alpha1.ConditionDeploymentReady, metav1.ConditionTrue, reason, message)
+		setCondition(conditions, generation, qav1alpha1.ConditionProgressing, metav1.ConditionFalse, reason, message)
+	case qav1alpha1.RolloutPhaseProgressing:
+		setCondition(conditions, generation, qav1alpha1.ConditionDeploymentReady, metav1.ConditionFalse, reason, message)
+		setCondition(conditions, generation, qav1alpha1.ConditionProgressing, metav1.ConditionTrue, reason, message)
+	case qav1alpha1.RolloutPhaseFailed:
+		setCondition(conditions, generation, qav1alpha1.ConditionDeploymentReady, metav1.ConditionFalse, reason, message)
+		setCondition(conditions, generation, qav1alpha1.ConditionProgressing, metav1.ConditionFalse, reason, message)
+	}
+}
+
 func (h *deploymentHandler) ReconcileFail(_ runtimeObj, _ error) {
 	return
 }
@@ -1,9 +1,20 @@
 package handler
 
 import (
+	"context"
+	"github.com/gogo/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
 	appv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"testing"
 )
 
@@ -38,3 +49,160 @@ func TestMerge(t *testing.T) {
 	assert.Equal(t, src.Spec.Template.Spec.DNSConfig.Nameservers, []string{"1.1.1.1", "2.2.2.2"})
 	assert.Equal(t, src.Spec.Template.Spec.DNSConfig.Searches, []string{"a", "b"})
 }
+
+func TestGetRolloutPhase(t *testing.T) {
+	deployment := &appv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-base", Generation: 2},
+		Spec: appv1.DeploymentSpec{
+			Replicas: proto.Int32(2),
+		},
+		Status: appv1.DeploymentStatus{ObservedGeneration: 1},
+	}
+	phase, reason, _ := getRolloutPhase(deployment)
+	assert.Equal(t, qav1alpha1.RolloutPhaseProgressing, phase)
+	assert.Equal(t, qav1alpha1.ReasonRolloutInProgress, reason)
+
+	deployment.Status = appv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2}
+	phase, _, message := getRolloutPhase(deployment)
+	assert.Equal(t, qav1alpha1.RolloutPhaseProgressing, phase)
+	assert.Equal(t, "1 old replicas are pending termination", message)
+
+	deployment.Status = appv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1}
+	phase, _, _ = getRolloutPhase(deployment)
+	assert.Equal(t, qav1alpha1.RolloutPhaseProgressing, phase)
+
+	deployment.Status = appv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2,
+		AvailableReplicas: 2, ReadyReplicas: 2}
+	phase, reason, _ = getRolloutPhase(deployment)
+	assert.Equal(t, qav1alpha1.RolloutPhaseComplete, phase)
+	assert.Equal(t, qav1alpha1.ReasonRolloutComplete, reason)
+
+	deployment.Status = appv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1,
+		Conditions: []appv1.DeploymentCondition{
+			{
+				Type:    appv1.DeploymentProgressing,
+				Status:  v1.ConditionFalse,
+				Reason:  "ProgressDeadlineExceeded",
+				Message: "ReplicaSet has timed out progressing.",
+			},
+		},
+	}
+	phase, reason, _ = getRolloutPhase(deployment)
+	assert.Equal(t, qav1alpha1.RolloutPhaseFailed, phase)
+	assert.Equal(t, qav1alpha1.ReasonProgressDeadlineExceeded, reason)
+}
+
+func TestSetRolloutStatus(t *testing.T) {
+	sqbdeployment := &qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-base", Generation: 1}}
+	deployment := &appv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-base", Generation: 1},
+		Spec: appv1.DeploymentSpec{
+			Replicas: proto.Int32(1),
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{Name: "app-base", Image: "app:v1"}},
+				},
+			},
+		},
+		Status: appv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1},
+	}
+	setRolloutStatus(sqbdeployment, deployment)
+	setReconcileSucceeded(&sqbdeployment.Status.Conditions, sqbdeployment.Generation)
+	assert.Equal(t, "app:v1", sqbdeployment.Status.Image)
+	assert.Equal(t, qav1alpha1.RolloutPhaseProgressing, sqbdeployment.Status.Phase)
+	assert.True(t, meta.IsStatusConditionTrue(sqbdeployment.Status.Conditions, qav1alpha1.ConditionProgressing))
+	assert.True(t, meta.IsStatusConditionFalse(sqbdeployment.Status.Conditions, qav1alpha1.ConditionReady))
+	assert.True(t, meta.IsStatusConditionFalse(sqbdeployment.Status.Conditions, qav1alpha1.ConditionDegraded))
+
+	deployment.Status.AvailableReplicas = 1
+	deployment.Status.ReadyReplicas = 1
+	setRolloutStatus(sqbdeployment, deployment)
+	setReconcileSucceeded(&sqbdeployment.Status.Conditions, sqbdeployment.Generation)
+	assert.Equal(t, int32(1), sqbdeployment.Status.ReadyReplicas)
+	assert.Equal(t, qav1alpha1.RolloutPhaseComplete, sqbdeployment.Status.Phase)
+	assert.True(t, meta.IsStatusConditionFalse(sqbdeployment.Status.Conditions, qav1alpha1.ConditionProgressing))
+	assert.True(t, meta.IsStatusConditionTrue(sqbdeployment.Status.Conditions, qav1alpha1.ConditionReady))
+
+	deployment.Status.Conditions = []appv1.DeploymentCondition{
+		{Type: appv1.DeploymentProgressing, Status: v1.ConditionFalse, Reason: "ProgressDeadlineExceeded"},
+	}
+	setRolloutStatus(sqbdeployment, deployment)
+	setReconcileSucceeded(&sqbdeployment.Status.Conditions, sqbdeployment.Generation)
+	assert.Equal(t, qav1alpha1.RolloutPhaseFailed, sqbdeployment.Status.Phase)
+	assert.True(t, meta.IsStatusConditionTrue(sqbdeployment.Status.Conditions, qav1alpha1.ConditionDegraded))
+	assert.True(t, meta.IsStatusConditionFalse(sqbdeployment.Status.Conditions, qav1alpha1.ConditionReady))
+}
+
+func TestSidecarContainers(t *testing.T) {
+	main := v1.Container{
+		Name:         "app-base",
+		Env:          []v1.EnvVar{{Name: "A", Value: "main"}, {Name: "B", Value: "main"}},
+		VolumeMounts: []v1.VolumeMount{{Name: "volume-0", MountPath: "/data"}},
+	}
+	h := &deploymentHandler{deploy: &qav1alpha1.DeploySpec{Sidecars: []qav1alpha1.SidecarSpec{
+		{
+			Container: v1.Container{Name: "proxy", Image: "proxy:v1", Env: []v1.EnvVar{{Name: "B", Value: "proxy"}}},
+			ShareEnv:  true,
+		},
+		{
+			Container:         v1.Container{Name: "filebeat", Image: "filebeat:v1"},
+			ShareVolumeMounts: true,
+		},
+	}}}
+	containers, err := h.sidecarContainers(main)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(containers))
+	assert.Equal(t, []v1.EnvVar{{Name: "A", Value: "main"}, {Name: "B", Value: "proxy"}}, containers[0].Env)
+	assert.Nil(t, containers[0].VolumeMounts)
+	assert.Nil(t, containers[1].Env)
+	assert.Equal(t, main.VolumeMounts, containers[1].VolumeMounts)
+	// 不修改生效的配置
+	assert.Equal(t, 1, len(h.deploy.Sidecars[0].Container.Env))
+
+	h.deploy.Sidecars[1].Container.Name = "app-base"
+	_, err = h.sidecarContainers(main)
+	assert.NotNil(t, err)
+}
+
+func TestAddStartupProbe(t *testing.T) {
+	deployment := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app-base"}}
+	// 主容器不在第一个
+	deployment.Spec.Template.Spec.Containers = []v1.Container{{Name: "proxy"}, {Name: "app-base"}}
+	h := &deploymentHandler{deploy: &qav1alpha1.DeploySpec{HealthCheck: &v1.Probe{InitialDelaySeconds: 30}}}
+	h.addStartupProbe(deployment)
+	assert.Nil(t, deployment.Spec.Template.Spec.Containers[0].StartupProbe)
+	assert.Equal(t, int32(18), deployment.Spec.Template.Spec.Containers[1].StartupProbe.FailureThreshold)
+	assert.Equal(t, int32(10), deployment.Spec.Template.Spec.Containers[1].LivenessProbe.InitialDelaySeconds)
+}
+
+func TestDeploymentSpecStrategy(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = qav1alpha1.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	SetK8sLog(ctrl.Log.WithName("test"))
+	defer entity.ConfigMapData.FromMap(map[string]string{})
+	ctx := context.Background()
+	sqbapplication := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "sqb"}}
+	sqbdeployment := &qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-base", Namespace: "sqb",
+		Labels: map[string]string{entity.AppKey: "app", entity.PlaneKey: "base"}}}
+	sqbdeployment.Spec.Selector = qav1alpha1.Selector{App: "app", Plane: "base"}
+	deploy := &qav1alpha1.DeploySpec{Image: "nginx"}
+
+	// namespace的deploymentSpec配置的strategy不被默认值覆盖
+	entity.ConfigMapData.FromMap(map[string]string{"deploymentSpec": `{"strategy": {"type": "Recreate"}}`})
+	SetK8sClient(&applyClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(sqbapplication).Build()})
+	assert.Nil(t, NewDeploymentHandler(sqbdeployment, deploy, ctx).CreateOrUpdate())
+	deployment := &appv1.Deployment{}
+	assert.Nil(t, k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbdeployment), deployment))
+	assert.Equal(t, deployment.Spec.Strategy.Type, appv1.RecreateDeploymentStrategyType)
+	assert.Nil(t, deployment.Spec.Strategy.RollingUpdate)
+
+	// 没有配置时默认为RollingUpdate
+	entity.ConfigMapData.FromMap(map[string]string{})
+	SetK8sClient(&applyClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(sqbapplication).Build()})
+	assert.Nil(t, NewDeploymentHandler(sqbdeployment, deploy, ctx).CreateOrUpdate())
+	assert.Nil(t, k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbdeployment), deployment))
+	assert.Equal(t, deployment.Spec.Strategy.Type, appv1.RollingUpdateDeploymentStrategyType)
+	assert.Equal(t, deployment.Spec.Strategy.RollingUpdate.MaxUnavailable.IntValue(), 0)
+}
@@ -8,9 +8,7 @@ import (
 	"github.com/wosai/elastic-env-operator/domain/util"
 	istioapi "istio.io/api/networking/v1beta1"
 	istio "istio.io/client-go/pkg/apis/networking/v1beta1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type destinationRuleHandler struct {
@@ -24,14 +22,14 @@ func NewDestinationRuleHandler(sqbapplication *qav1alpha1.SQBApplication, ctx co
 
 func (h *destinationRuleHandler) CreateOrUpdate() error {
 	destinationrule := &istio.DestinationRule{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
-	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: destinationrule.Namespace, Name: destinationrule.Name}, destinationrule)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return err
-	}
 	destinationrule.Spec.Host = h.sqbapplication.Name
 
+	planes, err := getPlanes(h.ctx, h.sqbapplication)
+	if err != nil {
+		return err
+	}
 	subsets := make([]*istioapi.Subset, 0)
-	for plane := range h.sqbapplication.Status.Planes {
+	for _, plane := range planes {
 		subsets = append(subsets, &istioapi.Subset{
 			Name: util.GetSubsetName(h.sqbapplication.Name, plane),
 			Labels: map[string]string{
@@ -43,22 +41,25 @@ func (h *destinationRuleHandler) CreateOrUpdate() error {
 	destinationrule.Spec.Subsets = subsets
 	if anno, ok := h.sqbapplication.Annotations[entity.DestinationRuleAnnotationKey]; ok {
 		_ = json.Unmarshal([]byte(anno), &destinationrule.Annotations)
-	} else {
-		destinationrule.Annotations = nil
 	}
-	destinationrule.Labels = h.sqbapplication.Labels
-	return CreateOrUpdate(h.ctx, destinationrule)
+	destinationrule.Labels = util.MergeStringMap(nil, h.sqbapplication.Labels)
+	return Apply(h.ctx, destinationrule)
 }
 
 func (h *destinationRuleHandler) Delete() error {
 	destinationrule := &istio.DestinationRule{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
-	return Delete(h.ctx, destinationrule)
+	return deleteOrRetain(h.ctx, destinationrule, h.sqbapplication)
 }
 
 func (h *destinationRuleHandler) Handle() error {
-	if !entity.ConfigMapData.IstioEnable() {
+	config := entity.ConfigMapData.ForNamespace(h.sqbapplication.Namespace)
+	// 没有安装istio时不处理，关闭istioRoutingEnable后删除之前生成的destinationrule
+	if !config.IstioEnable() {
 		return nil
 	}
+	if !config.IstioRoutingEnable() {
+		return h.Delete()
+	}
 	if deleted, _ := IsDeleted(h.sqbapplication); deleted {
 		return h.Delete()
 	}
@@ -67,3 +68,7 @@ func (h *destinationRuleHandler) Handle() error {
 	}
 	return h.Delete()
 }
+
+func (h *destinationRuleHandler) ConditionType() string {
+	return qav1alpha1.ConditionDestinationRuleReady
+}
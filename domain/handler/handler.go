@@ -2,23 +2,43 @@ package handler
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"github.com/go-logr/logr"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
 	"github.com/wosai/elastic-env-operator/domain/entity"
 	"github.com/wosai/elastic-env-operator/domain/util"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	// server-side apply使用的field manager
+	FieldManager = "elastic-env-operator"
+	// 使用Update写入时默认的field manager，即二进制的名称
+	legacyFieldManager = "manager"
+)
+
 var (
 	k8sclient client.Client
 	log       logr.Logger
 	k8sScheme *runtime.Scheme
+	// cache同步完成并且成为leader后才开始处理事件
+	ready int32
+	// operator启动后已经处理过的对象的UID，对象删除时移除
+	reconciled sync.Map
 )
 
 type (
@@ -38,6 +58,23 @@ type (
 	SQBHandler interface {
 		Handle() error
 	}
+
+	// SQBConditionHandler 处理子资源的handler，处理结果记录到status的conditions中
+	SQBConditionHandler interface {
+		SQBHandler
+		ConditionType() string
+	}
+
+	// SQBRequeuer 处理成功后需要在一段时间后再次处理，返回0表示不需要
+	SQBRequeuer interface {
+		RequeueAfter() time.Duration
+	}
+
+	// SQBHasher operator启动后第一次处理对象时，hash与status中记录的一致则跳过
+	SQBHasher interface {
+		Hash(runtimeObj) string
+		ObservedHash(runtimeObj) string
+	}
 )
 
 func SetK8sClient(c client.Client) {
@@ -52,13 +89,22 @@ func SetK8sScheme(s *runtime.Scheme) {
 	k8sScheme = s
 }
 
-func HandleReconcile(r SQBReconciler) (ctrl.Result, error) {
-	if !entity.ConfigMapData.IsInitialized() {
-		return ctrl.Result{RequeueAfter: time.Second}, nil
+func SetReady(r bool) {
+	if r {
+		atomic.StoreInt32(&ready, 1)
+	} else {
+		atomic.StoreInt32(&ready, 0)
 	}
+}
 
-	if !entity.ConfigMapData.IsReady() {
-		return ctrl.Result{}, nil
+func IsReady() bool {
+	return atomic.LoadInt32(&ready) == 1
+}
+
+func HandleReconcile(r SQBReconciler) (ctrl.Result, error) {
+	// 就绪前的事件requeue，不能丢弃
+	if !entity.ConfigMapData.IsInitialized() || !IsReady() {
+		return ctrl.Result{RequeueAfter: time.Second}, nil
 	}
 
 	obj, err := r.GetInstance()
@@ -71,6 +117,10 @@ func HandleReconcile(r SQBReconciler) (ctrl.Result, error) {
 		}
 	}
 
+	if hasher, ok := r.(SQBHasher); ok && unchangedSinceRestart(obj, hasher) {
+		return ctrl.Result{}, nil
+	}
+
 	generation := obj.GetGeneration()
 	if yes, err := r.IsInitialized(obj); !yes {
 		if err != nil {
@@ -86,9 +136,45 @@ func HandleReconcile(r SQBReconciler) (ctrl.Result, error) {
 		r.ReconcileFail(obj, err)
 		return ctrl.Result{}, util.IgnoreInvalidError(err)
 	}
+	if requeuer, ok := r.(SQBRequeuer); ok {
+		return ctrl.Result{RequeueAfter: requeuer.RequeueAfter()}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
+// operator启动后第一次处理对象，并且spec、operator配置等都没有变化
+func unchangedSinceRestart(obj runtimeObj, hasher SQBHasher) bool {
+	// 删除中的对象不再记录，避免reconciled一直增长
+	if !obj.GetDeletionTimestamp().IsZero() {
+		reconciled.Delete(obj.GetUID())
+		return false
+	}
+	if _, loaded := reconciled.LoadOrStore(obj.GetUID(), struct{}{}); loaded {
+		return false
+	}
+	observed := hasher.ObservedHash(obj)
+	return observed != "" && observed == hasher.Hash(obj)
+}
+
+// 根据对象的label、annotation、所在namespace生效的operator配置以及values计算hash
+func objectHash(obj runtimeObj, values ...interface{}) string {
+	b, err := json.Marshal(struct {
+		Labels      map[string]string
+		Annotations map[string]string
+		Config      map[string]string
+		Values      []interface{}
+	}{
+		Labels:      obj.GetLabels(),
+		Annotations: obj.GetAnnotations(),
+		Config:      entity.ConfigMapData.ForNamespace(obj.GetNamespace()).Effective(),
+		Values:      values,
+	})
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
 func CreateOrUpdate(ctx context.Context, obj runtimeObj) error {
 	kind, _ := apiutil.GVKForObject(obj, k8sScheme)
 	if obj.GetCreationTimestamp().Time.IsZero() {
@@ -97,7 +183,8 @@ func CreateOrUpdate(ctx context.Context, obj runtimeObj) error {
 			"namespace", obj.GetNamespace(), "name", obj.GetName(), "error", err)
 		return err
 	}
-	if _, ok := obj.GetLabels()[entity.KubevelaAppNameLabel]; ok {
+	if kubevelaMode(obj) == entity.KubevelaModeVela {
+		recordKubevelaSkipped(ctx, obj)
 		return nil
 	}
 	err := k8sclient.Update(ctx, obj)
@@ -106,6 +193,215 @@ func CreateOrUpdate(ctx context.Context, obj runtimeObj) error {
 	return err
 }
 
+// Apply 使用server-side apply创建或更新子资源，obj只包含operator渲染的字段，其他字段由各自的field manager维护。
+// 与其他field manager冲突时返回错误，不强制覆盖；kubevela管理的对象按kubevela-mode处理。处理完成后obj为集群中的对象
+func Apply(ctx context.Context, obj runtimeObj) error {
+	kind, err := apiutil.GVKForObject(obj, k8sScheme)
+	if err != nil {
+		return err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(kind)
+	obj.SetResourceVersion("")
+	obj.SetManagedFields(nil)
+	// 记录期望状态的hash，期望状态没有变化并且集群中的对象包含期望状态时跳过
+	hash, err := desiredHash(obj)
+	if err != nil {
+		return err
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[entity.LastAppliedHashAnnotationKey] = hash
+	obj.SetAnnotations(annotations)
+
+	// 读取到空对象中，避免与期望状态合并
+	live := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtimeObj)
+	err = k8sclient.Get(ctx, client.ObjectKeyFromObject(obj), live)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	created := err != nil
+	force := false
+	if !created {
+		takeover, err := handleKubevelaCommand(ctx, live)
+		if err != nil {
+			return err
+		}
+		switch kubevelaMode(live) {
+		case entity.KubevelaModeVela:
+			recordKubevelaSkipped(ctx, live)
+			setObject(obj, live)
+			return nil
+		case entity.KubevelaModeOperator:
+			// operator拥有kubevela创建的对象时，强制接管与kubevela冲突的字段
+			force = isKubevelaManaged(live)
+		}
+		if !takeover && unchanged(obj, live) {
+			childWrites.WithLabelValues(kind.Kind, writeResultSkipped).Inc()
+			setObject(obj, live)
+			return nil
+		}
+	}
+	opts := []client.PatchOption{client.FieldOwner(FieldManager)}
+	if force {
+		opts = append(opts, client.ForceOwnership)
+	}
+	err = k8sclient.Patch(ctx, obj, client.Apply, opts...)
+	if !force && apierrors.IsConflict(err) && legacyConflict(err) {
+		// 之前通过Update写入的字段属于legacyFieldManager，第一次apply时接管
+		err = k8sclient.Patch(ctx, obj, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+	}
+	log.Info("apply obj", "kind", kind,
+		"namespace", obj.GetNamespace(), "name", obj.GetName(), "error", err)
+	if err != nil {
+		if apierrors.IsConflict(err) {
+			return fmt.Errorf("apply %s %s/%s conflicts with other field managers, "+
+				"remove the fields from the other manager or stop managing them by operator: %w",
+				kind.Kind, obj.GetNamespace(), obj.GetName(), err)
+		}
+		return err
+	}
+	if created {
+		childWrites.WithLabelValues(kind.Kind, writeResultCreated).Inc()
+	} else {
+		childWrites.WithLabelValues(kind.Kind, writeResultUpdated).Inc()
+	}
+	return nil
+}
+
+// ownsField manager是否通过apply管理对象的字段，path为managedFields中的路径，如"f:spec", "f:replicas"
+func ownsField(obj runtimeObj, manager string, path ...string) bool {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != manager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		found := true
+		for _, key := range path {
+			next, ok := fields[key].(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			fields = next
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// 冲突的字段都属于legacyFieldManager
+func legacyConflict(err error) bool {
+	status, ok := err.(apierrors.APIStatus)
+	if !ok || status.Status().Details == nil || len(status.Status().Details.Causes) == 0 {
+		return false
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict ||
+			!strings.Contains(cause.Message, fmt.Sprintf("conflict with %q", legacyFieldManager)) {
+			return false
+		}
+	}
+	return true
+}
+
+func setObject(obj, live runtimeObj) {
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(live).Elem())
+}
+
+// 集群中的对象是上次apply的期望状态，并且operator渲染的字段没有被修改
+func unchanged(desired, live runtimeObj) bool {
+	hash := desired.GetAnnotations()[entity.LastAppliedHashAnnotationKey]
+	if live.GetAnnotations()[entity.LastAppliedHashAnnotationKey] != hash {
+		return false
+	}
+	desiredContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return false
+	}
+	liveContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+	if err != nil {
+		return false
+	}
+	// 从cache中读取的对象没有apiVersion和kind
+	for _, key := range []string{"apiVersion", "kind", "status"} {
+		delete(desiredContent, key)
+	}
+	return contains(liveContent, desiredContent)
+}
+
+// live包含desired中所有非空的字段，列表需要长度一致并且每一项都包含
+func contains(live, desired interface{}) bool {
+	switch d := desired.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range d {
+			if value == nil {
+				continue
+			}
+			if _, ok := l[key]; !ok {
+				return false
+			}
+			if !contains(l[key], value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			return false
+		}
+		for i := range d {
+			if !contains(l[i], d[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(live, desired)
+	}
+}
+
+// 对象除status、系统维护的metadata和hash注解之外内容的hash
+func desiredHash(obj runtimeObj) (string, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return "", err
+	}
+	delete(content, "apiVersion")
+	delete(content, "kind")
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		for _, key := range []string{"resourceVersion", "generation", "managedFields", "uid", "selfLink",
+			"creationTimestamp"} {
+			delete(metadata, key)
+		}
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, entity.LastAppliedHashAnnotationKey)
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+	b, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
 func UpdateStatus(ctx context.Context, obj runtimeObj) error {
 	kind, _ := apiutil.GVKForObject(obj, k8sScheme)
 	err := k8sclient.Status().Update(ctx, obj)
@@ -114,8 +410,16 @@ func UpdateStatus(ctx context.Context, obj runtimeObj) error {
 	return err
 }
 
+// Delete 删除对象，kubevela管理的对象只有kubevela-mode为operator时才删除
 func Delete(ctx context.Context, obj runtimeObj) error {
-	if _, ok := obj.GetLabels()[entity.KubevelaAppNameLabel]; ok {
+	if err := k8sclient.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if _, err := handleKubevelaCommand(ctx, obj); err != nil {
+		return err
+	}
+	if kubevelaMode(obj) != entity.KubevelaModeOperator {
+		recordKubevelaSkipped(ctx, obj)
 		return nil
 	}
 	kind, _ := apiutil.GVKForObject(obj, k8sScheme)
@@ -125,13 +429,234 @@ func Delete(ctx context.Context, obj runtimeObj) error {
 	return client.IgnoreNotFound(err)
 }
 
+// Release 保留子资源：去掉operator的label和finalizer，不再由operator管理
+func Release(ctx context.Context, obj runtimeObj) error {
+	if err := k8sclient.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if kubevelaMode(obj) != entity.KubevelaModeOperator {
+		recordKubevelaSkipped(ctx, obj)
+		return nil
+	}
+	objLabels := obj.GetLabels()
+	delete(objLabels, entity.AppKey)
+	delete(objLabels, entity.PlaneKey)
+	obj.SetLabels(objLabels)
+	controllerutil.RemoveFinalizer(obj, entity.FINALIZER)
+	obj.SetAnnotations(util.MergeStringMap(obj.GetAnnotations(), map[string]string{entity.RetainedAnnotationKey: "true"}))
+	kind, _ := apiutil.GVKForObject(obj, k8sScheme)
+	err := k8sclient.Update(ctx, obj)
+	log.Info("release obj", "kind", kind,
+		"namespace", obj.GetNamespace(), "name", obj.GetName(), "error", err)
+	return client.IgnoreNotFound(err)
+}
+
+// deleteOrRetain 删除子资源，owner正在删除且retainResources包含该资源类型时改为保留
+func deleteOrRetain(ctx context.Context, obj runtimeObj, owner runtimeObj) error {
+	if deleted, _ := IsDeleted(owner); deleted {
+		kind, _ := apiutil.GVKForObject(obj, k8sScheme)
+		for _, retain := range getRetainResources(owner) {
+			if string(retain) == kind.Kind {
+				return Release(ctx, obj)
+			}
+		}
+	}
+	return Delete(ctx, obj)
+}
+
+func getRetainResources(obj runtimeObj) []qav1alpha1.ResourceKind {
+	switch in := obj.(type) {
+	case *qav1alpha1.SQBApplication:
+		return in.Spec.RetainResources
+	case *qav1alpha1.SQBDeployment:
+		return in.Spec.RetainResources
+	}
+	return nil
+}
+
+// IsDeleted 是否需要清理子资源：带有正确的删除注解，或者正在删除且deletionPolicy为Delete
 func IsDeleted(obj runtimeObj) (bool, error) {
 	if deleteCheckSum, ok := obj.GetAnnotations()[entity.ExplicitDeleteAnnotationKey]; ok {
-		if deleteCheckSum == util.GetDeleteCheckSum(obj.GetName()) {
+		checksum, err := util.GetDeleteCheckSum(obj.GetName())
+		if err != nil {
+			return false, err
+		}
+		if deleteCheckSum == checksum {
 			return true, nil
 		} else {
 			return false, fmt.Errorf("delete annotation %s is wrong", deleteCheckSum)
 		}
 	}
+	if !obj.GetDeletionTimestamp().IsZero() {
+		return getDeletionPolicy(obj) == qav1alpha1.DeletionPolicyDelete, nil
+	}
 	return false, nil
 }
+
+func getDeletionPolicy(obj runtimeObj) qav1alpha1.DeletionPolicy {
+	var policy qav1alpha1.DeletionPolicy
+	switch in := obj.(type) {
+	case *qav1alpha1.SQBApplication:
+		policy = in.Spec.DeletionPolicy
+	case *qav1alpha1.SQBDeployment:
+		policy = in.Spec.DeletionPolicy
+	case *qav1alpha1.SQBPlane:
+		policy = in.Spec.DeletionPolicy
+	}
+	if policy == "" {
+		return qav1alpha1.DeletionPolicyDelete
+	}
+	return policy
+}
+
+// handleFinalizer 未删除的对象添加finalizer；正在删除但不需要清理子资源时，
+// Orphan直接移除finalizer，Protect保留finalizer并报错。返回true表示不需要继续处理
+func handleFinalizer(ctx context.Context, obj runtimeObj, deleted bool) (bool, error) {
+	if obj.GetDeletionTimestamp().IsZero() {
+		if controllerutil.ContainsFinalizer(obj, entity.FINALIZER) {
+			return false, nil
+		}
+		controllerutil.AddFinalizer(obj, entity.FINALIZER)
+		return false, CreateOrUpdate(ctx, obj)
+	}
+	if deleted {
+		return false, nil
+	}
+	if policy := getDeletionPolicy(obj); policy == qav1alpha1.DeletionPolicyProtect {
+		return true, fmt.Errorf("deletion is protected by deletionPolicy %s, "+
+			"change deletionPolicy or add annotation %s to delete", policy, entity.ExplicitDeleteAnnotationKey)
+	}
+	if err := removeSqbdeploymentOwnerReferences(ctx, obj); err != nil {
+		return true, err
+	}
+	return true, removeFinalizer(ctx, obj)
+}
+
+// removeSqbdeploymentOwnerReferences Orphan的SQBApplication和SQBPlane移除finalizer前，
+// 先去掉SQBDeployment上指向它的owner reference，避免SQBDeployment被垃圾回收
+func removeSqbdeploymentOwnerReferences(ctx context.Context, obj runtimeObj) error {
+	switch obj.(type) {
+	case *qav1alpha1.SQBApplication, *qav1alpha1.SQBPlane:
+	default:
+		return nil
+	}
+	sqbdeployments := &qav1alpha1.SQBDeploymentList{}
+	if err := k8sclient.List(ctx, sqbdeployments, client.InNamespace(obj.GetNamespace())); err != nil {
+		return err
+	}
+	for i := range sqbdeployments.Items {
+		sqbdeployment := &sqbdeployments.Items[i]
+		ownerReferences := make([]metav1.OwnerReference, 0, len(sqbdeployment.OwnerReferences))
+		for _, ownerReference := range sqbdeployment.OwnerReferences {
+			if ownerReference.UID != obj.GetUID() {
+				ownerReferences = append(ownerReferences, ownerReference)
+			}
+		}
+		if len(ownerReferences) == len(sqbdeployment.OwnerReferences) {
+			continue
+		}
+		sqbdeployment.OwnerReferences = ownerReferences
+		err := k8sclient.Update(ctx, sqbdeployment)
+		log.Info("remove owner reference", "namespace", sqbdeployment.Namespace, "name", sqbdeployment.Name,
+			"owner", obj.GetName(), "error", err)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishDeletion 子资源清理完成后删除对象：还没有开始删除时发起删除，正在删除时移除finalizer
+func finishDeletion(ctx context.Context, obj runtimeObj) error {
+	if obj.GetDeletionTimestamp().IsZero() {
+		return Delete(ctx, obj)
+	}
+	return removeFinalizer(ctx, obj)
+}
+
+// 移除finalizer不能跳过kubevela管理的对象，否则对象无法删除
+func removeFinalizer(ctx context.Context, obj runtimeObj) error {
+	if !controllerutil.ContainsFinalizer(obj, entity.FINALIZER) {
+		return nil
+	}
+	controllerutil.RemoveFinalizer(obj, entity.FINALIZER)
+	kind, _ := apiutil.GVKForObject(obj, k8sScheme)
+	err := k8sclient.Update(ctx, obj)
+	log.Info("remove finalizer", "kind", kind,
+		"namespace", obj.GetNamespace(), "name", obj.GetName(), "error", err)
+	return client.IgnoreNotFound(err)
+}
+
+// 依次执行handler，子资源的处理结果记录到conditions中，出错后不再继续执行
+func handleAll(handlers []SQBHandler, conditions *[]metav1.Condition, generation int64) error {
+	for _, handler := range handlers {
+		err := handler.Handle()
+		if h, ok := handler.(SQBConditionHandler); ok {
+			if err != nil {
+				setCondition(conditions, generation, h.ConditionType(), metav1.ConditionFalse,
+					qav1alpha1.ReasonReconcileFailed, err.Error())
+			} else {
+				setCondition(conditions, generation, h.ConditionType(), metav1.ConditionTrue,
+					qav1alpha1.ReasonReconcileSucceeded, "")
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string,
+	status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// 处理成功后根据子资源的condition汇总Ready和Degraded
+func setReconcileSucceeded(conditions *[]metav1.Condition, generation int64) {
+	for _, condition := range *conditions {
+		if isSummaryCondition(condition.Type) || condition.Status == metav1.ConditionTrue {
+			continue
+		}
+		message := fmt.Sprintf("%s: %s", condition.Type, condition.Message)
+		setCondition(conditions, generation, qav1alpha1.ConditionReady, metav1.ConditionFalse,
+			condition.Reason, message)
+		if isDegradedReason(condition.Reason) {
+			setCondition(conditions, generation, qav1alpha1.ConditionDegraded, metav1.ConditionTrue,
+				condition.Reason, message)
+		} else {
+			setCondition(conditions, generation, qav1alpha1.ConditionDegraded, metav1.ConditionFalse,
+				qav1alpha1.ReasonReconcileSucceeded, "")
+		}
+		return
+	}
+	setCondition(conditions, generation, qav1alpha1.ConditionReady, metav1.ConditionTrue,
+		qav1alpha1.ReasonReconcileSucceeded, "")
+	setCondition(conditions, generation, qav1alpha1.ConditionDegraded, metav1.ConditionFalse,
+		qav1alpha1.ReasonReconcileSucceeded, "")
+}
+
+// 处理失败后更新汇总的condition
+func setReconcileFailed(conditions *[]metav1.Condition, generation int64, err error) {
+	setCondition(conditions, generation, qav1alpha1.ConditionReady, metav1.ConditionFalse,
+		qav1alpha1.ReasonReconcileFailed, err.Error())
+	setCondition(conditions, generation, qav1alpha1.ConditionDegraded, metav1.ConditionTrue,
+		qav1alpha1.ReasonReconcileFailed, err.Error())
+}
+
+// 滚动更新超时和灰度发布停在当前步骤时需要人工处理
+func isDegradedReason(reason string) bool {
+	return reason == qav1alpha1.ReasonProgressDeadlineExceeded || reason == qav1alpha1.ReasonCanaryMetricsUnavailable ||
+		reason == qav1alpha1.ReasonCanaryAnalysisInconclusive
+}
+
+func isSummaryCondition(conditionType string) bool {
+	return conditionType == qav1alpha1.ConditionReady || conditionType == qav1alpha1.ConditionProgressing ||
+		conditionType == qav1alpha1.ConditionDegraded
+}
@@ -0,0 +1,404 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"github.com/wosai/elastic-env-operator/domain/util"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"testing"
+	"time"
+)
+
+type fakeConditionHandler struct {
+	conditionType string
+	err           error
+	handled       bool
+}
+
+func (h *fakeConditionHandler) Handle() error {
+	h.handled = true
+	return h.err
+}
+
+func (h *fakeConditionHandler) ConditionType() string {
+	return h.conditionType
+}
+
+func TestHandleAll(t *testing.T) {
+	conditions := make([]metav1.Condition, 0)
+	service := &fakeConditionHandler{conditionType: qav1alpha1.ConditionServiceReady}
+	ingress := &fakeConditionHandler{conditionType: qav1alpha1.ConditionIngressReady, err: errors.New("ingress error")}
+	scrape := &fakeConditionHandler{conditionType: qav1alpha1.ConditionScrapeReady}
+
+	err := handleAll([]SQBHandler{service, ingress, scrape}, &conditions, 2)
+	assert.Error(t, err, "ingress error")
+	assert.Assert(t, !scrape.handled)
+	assert.Assert(t, meta.IsStatusConditionTrue(conditions, qav1alpha1.ConditionServiceReady))
+	assert.Assert(t, meta.IsStatusConditionFalse(conditions, qav1alpha1.ConditionIngressReady))
+	assert.Equal(t, meta.FindStatusCondition(conditions, qav1alpha1.ConditionIngressReady).Message, "ingress error")
+	assert.Equal(t, meta.FindStatusCondition(conditions, qav1alpha1.ConditionIngressReady).ObservedGeneration, int64(2))
+	assert.Assert(t, meta.FindStatusCondition(conditions, qav1alpha1.ConditionScrapeReady) == nil)
+
+	setReconcileFailed(&conditions, 2, err)
+	assert.Assert(t, meta.IsStatusConditionFalse(conditions, qav1alpha1.ConditionReady))
+	assert.Assert(t, meta.IsStatusConditionTrue(conditions, qav1alpha1.ConditionDegraded))
+
+	ingress.err = nil
+	err = handleAll([]SQBHandler{service, ingress, scrape}, &conditions, 3)
+	assert.NilError(t, err)
+	setReconcileSucceeded(&conditions, 3)
+	assert.Assert(t, meta.IsStatusConditionTrue(conditions, qav1alpha1.ConditionIngressReady))
+	assert.Assert(t, meta.IsStatusConditionTrue(conditions, qav1alpha1.ConditionReady))
+	assert.Assert(t, meta.IsStatusConditionFalse(conditions, qav1alpha1.ConditionDegraded))
+	assert.Equal(t, meta.FindStatusCondition(conditions, qav1alpha1.ConditionReady).ObservedGeneration, int64(3))
+}
+
+func TestIsDeleted(t *testing.T) {
+	entity.SecretData.FromMap(map[string][]byte{"salt": []byte("salt")})
+	in := &qav1alpha1.SQBPlane{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+	deleted, err := IsDeleted(in)
+	assert.NilError(t, err)
+	assert.Equal(t, deleted, false)
+
+	in.Annotations = map[string]string{entity.ExplicitDeleteAnnotationKey: "wrong"}
+	_, err = IsDeleted(in)
+	assert.ErrorContains(t, err, "is wrong")
+
+	in.Annotations[entity.ExplicitDeleteAnnotationKey], _ = util.GetDeleteCheckSum(in.Name)
+	deleted, err = IsDeleted(in)
+	assert.NilError(t, err)
+	assert.Equal(t, deleted, true)
+
+	// 没有删除注解时，正在删除的对象根据deletionPolicy判断
+	in.Annotations = nil
+	now := metav1.Now()
+	in.DeletionTimestamp = &now
+	deleted, _ = IsDeleted(in)
+	assert.Equal(t, deleted, true)
+	in.Spec.DeletionPolicy = qav1alpha1.DeletionPolicyOrphan
+	deleted, _ = IsDeleted(in)
+	assert.Equal(t, deleted, false)
+}
+
+func TestHandleFinalizer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = qav1alpha1.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	SetK8sLog(ctrl.Log.WithName("test"))
+	ctx := context.Background()
+	in := &qav1alpha1.SQBPlane{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default",
+		UID: "plane-uid", CreationTimestamp: metav1.Now()}}
+	sqbdeployment := &qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-test", Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "qa.shouqianba.com/v1alpha1", Kind: "SQBApplication", Name: "app", UID: "app-uid"},
+			{APIVersion: "qa.shouqianba.com/v1alpha1", Kind: "SQBPlane", Name: "test", UID: "plane-uid"},
+		}}}
+	SetK8sClient(fake.NewClientBuilder().WithScheme(scheme).WithObjects(in, sqbdeployment).Build())
+
+	// 未删除时添加finalizer
+	_ = k8sclient.Get(ctx, client.ObjectKeyFromObject(in), in)
+	done, err := handleFinalizer(ctx, in, false)
+	assert.NilError(t, err)
+	assert.Equal(t, done, false)
+	_ = k8sclient.Get(ctx, client.ObjectKeyFromObject(in), in)
+	assert.Equal(t, controllerutil.ContainsFinalizer(in, entity.FINALIZER), true)
+
+	// Protect保留finalizer
+	now := metav1.Now()
+	in.DeletionTimestamp = &now
+	in.Spec.DeletionPolicy = qav1alpha1.DeletionPolicyProtect
+	done, err = handleFinalizer(ctx, in, false)
+	assert.ErrorContains(t, err, "protected")
+	assert.Equal(t, done, true)
+	assert.Equal(t, controllerutil.ContainsFinalizer(in, entity.FINALIZER), true)
+
+	// Delete需要先清理子资源
+	in.Spec.DeletionPolicy = qav1alpha1.DeletionPolicyDelete
+	done, err = handleFinalizer(ctx, in, true)
+	assert.NilError(t, err)
+	assert.Equal(t, done, false)
+
+	// Orphan去掉SQBDeployment的owner reference后直接移除finalizer
+	in.Spec.DeletionPolicy = qav1alpha1.DeletionPolicyOrphan
+	done, err = handleFinalizer(ctx, in, false)
+	assert.NilError(t, err)
+	assert.Equal(t, done, true)
+	_ = k8sclient.Get(ctx, client.ObjectKeyFromObject(in), in)
+	assert.Equal(t, controllerutil.ContainsFinalizer(in, entity.FINALIZER), false)
+	_ = k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbdeployment), sqbdeployment)
+	assert.Equal(t, len(sqbdeployment.OwnerReferences), 1)
+	assert.Equal(t, sqbdeployment.OwnerReferences[0].Kind, "SQBApplication")
+}
+
+func TestDeleteOrRetain(t *testing.T) {
+	entity.SecretData.FromMap(map[string][]byte{"salt": []byte("salt")})
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = qav1alpha1.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	SetK8sLog(ctrl.Log.WithName("test"))
+	ctx := context.Background()
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default",
+		Labels:     map[string]string{entity.AppKey: "app", entity.GroupKey: "group"},
+		Finalizers: []string{entity.FINALIZER}}}
+	configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	SetK8sClient(fake.NewClientBuilder().WithScheme(scheme).WithObjects(service, configmap).Build())
+
+	checksum, _ := util.GetDeleteCheckSum("app")
+	sqbapplication := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default",
+		Annotations: map[string]string{entity.ExplicitDeleteAnnotationKey: checksum}}}
+	sqbapplication.Spec.RetainResources = []qav1alpha1.ResourceKind{"Service"}
+
+	assert.NilError(t, deleteOrRetain(ctx, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}, sqbapplication))
+	retained := &corev1.Service{}
+	assert.NilError(t, k8sclient.Get(ctx, client.ObjectKeyFromObject(service), retained))
+	assert.DeepEqual(t, retained.Labels, map[string]string{entity.GroupKey: "group"})
+	assert.Equal(t, len(retained.Finalizers), 0)
+	assert.Equal(t, retained.Annotations[entity.RetainedAnnotationKey], "true")
+
+	assert.NilError(t, deleteOrRetain(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}, sqbapplication))
+	err := k8sclient.Get(ctx, client.ObjectKeyFromObject(configmap), &corev1.ConfigMap{})
+	assert.Equal(t, apierrors.IsNotFound(err), true)
+}
+
+func TestUnchangedSinceRestart(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = qav1alpha1.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	entity.ConfigMapData.FromMap(map[string]string{})
+	h := NewSqbApplicationHanlder(ctrl.Request{}, context.Background())
+
+	unchanged := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "unchanged", Namespace: "default", UID: "unchanged"}}
+	unchanged.Status.ObservedHash = h.Hash(unchanged)
+	assert.Equal(t, unchangedSinceRestart(unchanged, h), true)
+	// 只有启动后第一次处理时跳过
+	assert.Equal(t, unchangedSinceRestart(unchanged, h), false)
+	// 删除中的对象从reconciled中移除
+	now := metav1.Now()
+	unchanged.DeletionTimestamp = &now
+	assert.Equal(t, unchangedSinceRestart(unchanged, h), false)
+	_, ok := reconciled.Load(unchanged.UID)
+	assert.Equal(t, ok, false)
+	// 同名重建的对象UID不同，按第一次处理
+	recreated := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "unchanged", Namespace: "default", UID: "recreated"}}
+	recreated.Status.ObservedHash = h.Hash(recreated)
+	assert.Equal(t, unchangedSinceRestart(recreated, h), true)
+
+	changed := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "changed", Namespace: "default", UID: "changed"}}
+	changed.Status.ObservedHash = h.Hash(changed)
+	changed.Spec.Image = "new"
+	assert.Equal(t, unchangedSinceRestart(changed, h), false)
+
+	// operator配置变化
+	configChanged := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default", UID: "config"}}
+	configChanged.Status.ObservedHash = h.Hash(configChanged)
+	entity.ConfigMapData.FromMap(map[string]string{"istioTimeout": "60"})
+	assert.Equal(t, unchangedSinceRestart(configChanged, h), false)
+	entity.ConfigMapData.FromMap(map[string]string{})
+
+	noHash := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "nohash", Namespace: "default", UID: "nohash"}}
+	assert.Equal(t, unchangedSinceRestart(noHash, h), false)
+}
+
+func TestHandleReconcileNotReady(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{})
+	SetReady(false)
+	// 就绪前的事件requeue
+	result, err := HandleReconcile(NewSqbApplicationHanlder(ctrl.Request{}, context.Background()))
+	assert.NilError(t, err)
+	assert.Equal(t, result.RequeueAfter, time.Second)
+}
+
+// fake client不支持server-side apply，使用create和update模拟，errs依次作为apply的返回值
+type applyClient struct {
+	client.Client
+	patches []*client.PatchOptions
+	errs    []error
+}
+
+func (c *applyClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch != client.Apply {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	options := &client.PatchOptions{}
+	options.ApplyOptions(opts)
+	c.patches = append(c.patches, options)
+	if len(c.errs) != 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}
+	live := obj.DeepCopyObject().(client.Object)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+		return c.Create(ctx, obj)
+	}
+	// 保留其他field manager的label和annotation
+	obj.SetLabels(util.MergeStringMap(live.GetLabels(), obj.GetLabels()))
+	obj.SetAnnotations(util.MergeStringMap(live.GetAnnotations(), obj.GetAnnotations()))
+	obj.SetResourceVersion(live.GetResourceVersion())
+	return c.Update(ctx, obj)
+}
+
+func conflictError(manager string) error {
+	err := apierrors.NewConflict(corev1.Resource("services"), "apply", errors.New("apply failed"))
+	err.ErrStatus.Details.Causes = []metav1.StatusCause{{
+		Type:    metav1.CauseTypeFieldManagerConflict,
+		Message: fmt.Sprintf("conflict with %q using v1", manager),
+		Field:   ".spec.ports",
+	}}
+	return err
+}
+
+func TestApply(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	SetK8sLog(ctrl.Log.WithName("test"))
+	c := &applyClient{Client: fake.NewClientBuilder().WithScheme(scheme).Build()}
+	SetK8sClient(c)
+	ctx := context.Background()
+	written := func(result string) float64 {
+		return testutil.ToFloat64(childWrites.WithLabelValues("Service", result))
+	}
+	desired := func(port int32) *corev1.Service {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "apply", Namespace: "default"}}
+		service.Spec.Ports = []corev1.ServicePort{{Name: "http", Port: port}}
+		return service
+	}
+
+	service := desired(80)
+	assert.NilError(t, Apply(ctx, service))
+	assert.Equal(t, written(writeResultCreated), float64(1))
+	assert.Equal(t, len(c.patches), 1)
+	assert.Equal(t, c.patches[0].FieldManager, FieldManager)
+	assert.Assert(t, c.patches[0].Force == nil)
+	assert.Equal(t, service.Kind, "Service")
+	hash := service.Annotations[entity.LastAppliedHashAnnotationKey]
+	assert.Assert(t, hash != "")
+
+	// 期望状态没有变化，跳过apply
+	service = desired(80)
+	assert.NilError(t, Apply(ctx, service))
+	assert.Equal(t, written(writeResultSkipped), float64(1))
+	assert.Equal(t, len(c.patches), 1)
+	assert.Equal(t, service.Spec.Ports[0].Port, int32(80))
+
+	// 其他field manager添加的字段不影响跳过
+	live := &corev1.Service{}
+	_ = c.Get(ctx, client.ObjectKeyFromObject(service), live)
+	live.Labels = map[string]string{"other": "value"}
+	assert.NilError(t, c.Update(ctx, live))
+	assert.NilError(t, Apply(ctx, desired(80)))
+	assert.Equal(t, len(c.patches), 1)
+
+	// operator渲染的字段被修改，即使期望状态不变也需要apply
+	live.Spec.Ports[0].Port = 9090
+	assert.NilError(t, c.Update(ctx, live))
+	assert.NilError(t, Apply(ctx, desired(80)))
+	assert.Equal(t, written(writeResultUpdated), float64(1))
+	assert.Equal(t, len(c.patches), 2)
+
+	// 期望状态变化
+	service = desired(8080)
+	assert.NilError(t, Apply(ctx, service))
+	assert.Equal(t, written(writeResultUpdated), float64(2))
+	assert.Assert(t, service.Annotations[entity.LastAppliedHashAnnotationKey] != hash)
+
+	// 与其他field manager冲突时返回错误，不强制覆盖
+	c.patches = nil
+	c.errs = []error{conflictError("kubectl-edit")}
+	err := Apply(ctx, desired(8081))
+	assert.ErrorContains(t, err, "apply Service default/apply conflicts with other field managers")
+	assert.Assert(t, apierrors.IsConflict(errors.Unwrap(err)))
+	assert.Equal(t, len(c.patches), 1)
+
+	// 只与之前Update写入的字段冲突时强制接管
+	c.patches = nil
+	c.errs = []error{conflictError(legacyFieldManager)}
+	assert.NilError(t, Apply(ctx, desired(8081)))
+	assert.Equal(t, len(c.patches), 2)
+	assert.Equal(t, *c.patches[1].Force, true)
+}
+
+func TestKubevelaMode(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	SetK8sLog(ctrl.Log.WithName("test"))
+	velaService := func(name string, annotations map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default",
+			Labels:      map[string]string{entity.KubevelaAppNameLabel: "vela-app"},
+			Annotations: annotations}}
+	}
+	c := &applyClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		velaService("vela", map[string]string{entity.KubevelaLastAppliedTime: "2021-01-01T00:00:00Z"}),
+		velaService("merge", map[string]string{entity.KubevelaModeAnnotationKey: entity.KubevelaModeMerge}),
+		velaService("operator", map[string]string{entity.KubevelaModeAnnotationKey: entity.KubevelaModeOperator}),
+		velaService("takeover", map[string]string{entity.KubevelaCommandAnnotationKey: entity.KubevelaCommandTakeover}),
+		velaService("invalid", map[string]string{entity.KubevelaCommandAnnotationKey: "unknown"}),
+	).Build()}
+	SetK8sClient(c)
+	ctx := withKubevelaSkipped(context.Background())
+	desired := func(name string) *corev1.Service {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		service.Spec.Ports = []corev1.ServicePort{{Name: "http", Port: 80}}
+		return service
+	}
+
+	// vela: 不修改也不删除，记录到status
+	assert.NilError(t, Apply(ctx, desired("vela")))
+	assert.NilError(t, Delete(ctx, desired("vela")))
+	assert.Equal(t, len(c.patches), 0)
+	assert.DeepEqual(t, getKubevelaSkipped(ctx), []qav1alpha1.KubevelaSkippedResource{
+		{Kind: "Service", Name: "vela", LastAppliedTime: "2021-01-01T00:00:00Z"}})
+
+	// merge: apply时不强制接管，不删除
+	assert.NilError(t, Apply(ctx, desired("merge")))
+	assert.Equal(t, len(c.patches), 1)
+	assert.Assert(t, c.patches[0].Force == nil)
+	assert.NilError(t, Delete(ctx, desired("merge")))
+	assert.NilError(t, c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "merge"}, &corev1.Service{}))
+
+	// operator: apply时强制接管，可以删除
+	assert.NilError(t, Apply(ctx, desired("operator")))
+	assert.Equal(t, len(c.patches), 2)
+	assert.Equal(t, *c.patches[1].Force, true)
+	assert.NilError(t, Delete(ctx, desired("operator")))
+	err := c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "operator"}, &corev1.Service{})
+	assert.Assert(t, apierrors.IsNotFound(err))
+
+	// takeover: 切换为operator并移除命令
+	service := desired("takeover")
+	assert.NilError(t, Apply(ctx, service))
+	assert.Equal(t, len(c.patches), 3)
+	assert.Equal(t, *c.patches[2].Force, true)
+	live := &corev1.Service{}
+	assert.NilError(t, c.Get(ctx, client.ObjectKeyFromObject(service), live))
+	_, ok := live.Annotations[entity.KubevelaCommandAnnotationKey]
+	assert.Equal(t, ok, false)
+	assert.Equal(t, live.Annotations[entity.KubevelaModeAnnotationKey], entity.KubevelaModeOperator)
+
+	// handback: 切换为vela
+	live.Annotations[entity.KubevelaCommandAnnotationKey] = entity.KubevelaCommandHandback
+	assert.NilError(t, c.Update(ctx, live))
+	assert.NilError(t, Apply(ctx, desired("takeover")))
+	assert.Equal(t, len(c.patches), 3)
+	assert.NilError(t, c.Get(ctx, client.ObjectKeyFromObject(service), live))
+	assert.Equal(t, live.Annotations[entity.KubevelaModeAnnotationKey], entity.KubevelaModeVela)
+
+	assert.ErrorContains(t, Apply(ctx, desired("invalid")), "is invalid")
+}
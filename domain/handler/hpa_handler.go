@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/util"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// hpaHandler 使用autoscaling/v2beta2，Kubernetes 1.26移除了该版本
+type hpaHandler struct {
+	sqbdeployment *qav1alpha1.SQBDeployment
+	deploy        *qav1alpha1.DeploySpec
+	ctx           context.Context
+}
+
+func NewHPAHandler(sqbdeployment *qav1alpha1.SQBDeployment, deploy *qav1alpha1.DeploySpec, ctx context.Context) *hpaHandler {
+	return &hpaHandler{sqbdeployment: sqbdeployment, deploy: deploy, ctx: ctx}
+}
+
+func (h *hpaHandler) CreateOrUpdate() error {
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
+	hpa.Labels = util.MergeStringMap(nil, h.sqbdeployment.Labels)
+	autoscaling := h.deploy.Autoscaling
+	hpa.Spec = autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+		ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       h.sqbdeployment.Name,
+		},
+		MinReplicas: autoscaling.MinReplicas,
+		MaxReplicas: autoscaling.MaxReplicas,
+		Metrics:     generateHPAMetrics(autoscaling),
+	}
+	return Apply(h.ctx, hpa)
+}
+
+// cpu、内存使用率在前，自定义指标在后
+func generateHPAMetrics(autoscaling *qav1alpha1.AutoscalingSpec) []autoscalingv2beta2.MetricSpec {
+	metrics := make([]autoscalingv2beta2.MetricSpec, 0)
+	for _, target := range []struct {
+		name        corev1.ResourceName
+		utilization *int32
+	}{
+		{corev1.ResourceCPU, autoscaling.TargetCPUUtilizationPercentage},
+		{corev1.ResourceMemory, autoscaling.TargetMemoryUtilizationPercentage},
+	} {
+		if target.utilization == nil {
+			continue
+		}
+		metrics = append(metrics, autoscalingv2beta2.MetricSpec{
+			Type: autoscalingv2beta2.ResourceMetricSourceType,
+			Resource: &autoscalingv2beta2.ResourceMetricSource{
+				Name: target.name,
+				Target: autoscalingv2beta2.MetricTarget{
+					Type:               autoscalingv2beta2.UtilizationMetricType,
+					AverageUtilization: target.utilization,
+				},
+			},
+		})
+	}
+	return append(metrics, autoscaling.Metrics...)
+}
+
+func (h *hpaHandler) Delete() error {
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
+	return deleteOrRetain(h.ctx, hpa, h.sqbdeployment)
+}
+
+func (h *hpaHandler) Handle() error {
+	if deleted, _ := IsDeleted(h.sqbdeployment); deleted {
+		return h.Delete()
+	}
+	if h.deploy.AutoscalingEnabled() {
+		return h.CreateOrUpdate()
+	}
+	return h.Delete()
+}
+
+func (h *hpaHandler) ConditionType() string {
+	return qav1alpha1.ConditionAutoscalerReady
+}
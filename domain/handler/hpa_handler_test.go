@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"github.com/gogo/protobuf/proto"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"gotest.tools/assert"
+	appv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestGenerateHPAMetrics(t *testing.T) {
+	custom := autoscalingv2beta2.MetricSpec{
+		Type: autoscalingv2beta2.PodsMetricSourceType,
+		Pods: &autoscalingv2beta2.PodsMetricSource{
+			Metric: autoscalingv2beta2.MetricIdentifier{Name: "qps"},
+			Target: autoscalingv2beta2.MetricTarget{Type: autoscalingv2beta2.AverageValueMetricType},
+		},
+	}
+	metrics := generateHPAMetrics(&qav1alpha1.AutoscalingSpec{
+		MaxReplicas:                       3,
+		TargetCPUUtilizationPercentage:    proto.Int32(60),
+		TargetMemoryUtilizationPercentage: proto.Int32(80),
+		Metrics:                           []autoscalingv2beta2.MetricSpec{custom},
+	})
+	assert.Equal(t, len(metrics), 3)
+	assert.Equal(t, metrics[0].Resource.Name, corev1.ResourceCPU)
+	assert.Equal(t, *metrics[0].Resource.Target.AverageUtilization, int32(60))
+	assert.Equal(t, metrics[1].Resource.Name, corev1.ResourceMemory)
+	assert.Equal(t, metrics[2].Pods.Metric.Name, "qps")
+
+	// 只有自定义指标
+	metrics = generateHPAMetrics(&qav1alpha1.AutoscalingSpec{MaxReplicas: 3,
+		Metrics: []autoscalingv2beta2.MetricSpec{custom}})
+	assert.Equal(t, len(metrics), 1)
+}
+
+func TestOwnsField(t *testing.T) {
+	deployment := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{ManagedFields: []metav1.ManagedFieldsEntry{
+		{
+			Manager:   FieldManager,
+			Operation: metav1.ManagedFieldsOperationApply,
+			FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{},"f:template":{}}}`)},
+		},
+		{
+			Manager:   "kube-controller-manager",
+			Operation: metav1.ManagedFieldsOperationUpdate,
+			FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:status":{"f:replicas":{}}}`)},
+		},
+	}}}
+	assert.Equal(t, ownsField(deployment, FieldManager, "f:spec", "f:replicas"), true)
+	assert.Equal(t, ownsField(deployment, FieldManager, "f:spec", "f:strategy"), false)
+	assert.Equal(t, ownsField(deployment, FieldManager, "f:status", "f:replicas"), false)
+	assert.Equal(t, ownsField(deployment, "kube-controller-manager", "f:status", "f:replicas"), false)
+}
@@ -42,14 +42,10 @@ func (h *ingressHandler) CreateOrUpdateForSqbapplication() error {
 			},
 		}
 		ingressNames[i] = ingress.Name
-		err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: ingress.Namespace, Name: ingress.Name}, ingress)
-		if err != nil && !apierrors.IsNotFound(err) {
-			return err
-		}
 
 		paths := make([]v1.HTTPIngressPath, 0)
 		// 开启istio并且有istio-ingressgateway组件
-		if IsIstioInject(h.sqbapplication) && HasIstioIngressGateway() {
+		if IsIstioInject(h.sqbapplication) && HasIstioIngressGateway(h.sqbapplication.Namespace) {
 			path := v1.HTTPIngressPath{
 				Backend: v1.IngressBackend{
 					Service: &v1.IngressServiceBackend{
@@ -105,12 +101,9 @@ func (h *ingressHandler) CreateOrUpdateForSqbapplication() error {
 			},
 		}
 		ingress.Spec.Rules = []v1.IngressRule{rule}
-		ingress.Labels = util.MergeStringMap(ingress.Labels, map[string]string{
+		ingress.Labels = map[string]string{
 			entity.AppKey:   h.sqbapplication.Name,
 			entity.GroupKey: h.sqbapplication.Labels[entity.GroupKey],
-		})
-		if len(domain.Annotation) != 0 {
-			ingress.Annotations = util.MergeStringMap(ingress.Annotations, domain.Annotation)
 		}
 		mergedAnnotations := map[string]string{
 			entity.IngressClassAnnotationKey: domain.Class,
@@ -119,8 +112,8 @@ func (h *ingressHandler) CreateOrUpdateForSqbapplication() error {
 			mergedAnnotations["nginx.ingress.kubernetes.io/server-snippet"] = "location ~ ^/metrics {deny all;return 404;}"
 		}
 
-		ingress.Annotations = util.MergeStringMap(ingress.Annotations, mergedAnnotations)
-		if err = CreateOrUpdate(h.ctx, ingress); err != nil {
+		ingress.Annotations = util.MergeStringMap(domain.Annotation, mergedAnnotations)
+		if err := Apply(h.ctx, ingress); err != nil {
 			return err
 		}
 	}
@@ -147,7 +140,7 @@ func (h *ingressHandler) CreateOrUpdateForSqbapplication() error {
 	for _, sqbdeployment := range sqbdeploymentList.Items {
 		if sqbdeployment.GetAnnotations()[entity.PublicEntryAnnotationKey] == "true" {
 			ingressClass := SpecialVirtualServiceIngress(&sqbdeployment)
-			host := entity.ConfigMapData.GetDomainNameByClass(sqbdeployment.Name, ingressClass)
+			host := entity.ConfigMapData.ForNamespace(h.sqbapplication.Namespace).GetDomainNameByClass(sqbdeployment.Name, ingressClass)
 			name := getIngressName(h.sqbapplication.Name, ingressClass, host)
 			ingressNames = append(ingressNames, name)
 		}
@@ -167,7 +160,7 @@ func (h *ingressHandler) CreateOrUpdateForSqbapplication() error {
 func (h *ingressHandler) CreateOrUpdateForSqbdeployment() error {
 	ingressClass := SpecialVirtualServiceIngress(h.sqbdeployment)
 	pathType := v1.PathTypeImplementationSpecific
-	host := entity.ConfigMapData.GetDomainNameByClass(h.sqbdeployment.Name, SpecialVirtualServiceIngress(h.sqbdeployment))
+	host := entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).GetDomainNameByClass(h.sqbdeployment.Name, SpecialVirtualServiceIngress(h.sqbdeployment))
 	ingress := &v1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: h.sqbdeployment.Namespace,
@@ -178,10 +171,7 @@ func (h *ingressHandler) CreateOrUpdateForSqbdeployment() error {
 			},
 		},
 	}
-	if err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: ingress.Namespace, Name: ingress.Name}, ingress); err != nil && !apierrors.IsNotFound(err) {
-		return err
-	}
-	ingress.Labels = util.MergeStringMap(ingress.Labels, h.sqbdeployment.Labels)
+	ingress.Labels = util.MergeStringMap(nil, h.sqbdeployment.Labels)
 
 	rule := v1.IngressRule{
 		Host: host,
@@ -202,7 +192,7 @@ func (h *ingressHandler) CreateOrUpdateForSqbdeployment() error {
 		},
 	}
 	ingress.Spec.Rules = []v1.IngressRule{rule}
-	return CreateOrUpdate(h.ctx, ingress)
+	return Apply(h.ctx, ingress)
 }
 
 func (h *ingressHandler) DeleteForSqbapplication() error {
@@ -218,7 +208,7 @@ func (h *ingressHandler) DeleteForSqbapplication() error {
 		if !h.isAutoIngress(ingress) {
 			continue
 		}
-		if err = Delete(h.ctx, &ingress); err != nil {
+		if err = deleteOrRetain(h.ctx, &ingress, h.sqbapplication); err != nil {
 			return err
 		}
 	}
@@ -227,7 +217,7 @@ func (h *ingressHandler) DeleteForSqbapplication() error {
 
 func (h *ingressHandler) DeleteForSqbdeployment() error {
 	ingressClass := SpecialVirtualServiceIngress(h.sqbdeployment)
-	host := entity.ConfigMapData.GetDomainNameByClass(h.sqbdeployment.Name, ingressClass)
+	host := entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).GetDomainNameByClass(h.sqbdeployment.Name, ingressClass)
 	ingress := &v1.Ingress{ObjectMeta: metav1.ObjectMeta{
 		Namespace: h.sqbdeployment.Namespace,
 		Name:      getIngressName(h.sqbdeployment.Labels[entity.AppKey], ingressClass, host),
@@ -236,7 +226,7 @@ func (h *ingressHandler) DeleteForSqbdeployment() error {
 	if err != nil {
 		return client.IgnoreNotFound(err)
 	}
-	if err = Delete(h.ctx, ingress); err != nil {
+	if err = deleteOrRetain(h.ctx, ingress, h.sqbdeployment); err != nil {
 		return err
 	}
 	return nil
@@ -264,6 +254,10 @@ func (h *ingressHandler) Handle() error {
 	return nil
 }
 
+func (h *ingressHandler) ConditionType() string {
+	return qav1alpha1.ConditionIngressReady
+}
+
 // getIngressName, 生成ingress的名称
 func getIngressName(appName, nginxClass, host string) string {
 	return fmt.Sprintf("%s.%s.%s", appName, nginxClass, host)
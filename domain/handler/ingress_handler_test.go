@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"gotest.tools/assert"
+	v1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+)
+
+func TestSqbapplicationIngressWithPublicEntry(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{"ingressOpen": "true",
+		"domainPostfix": `{"nginx":"*.example.com"}`})
+	defer entity.ConfigMapData.FromMap(map[string]string{})
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = qav1alpha1.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	SetK8sLog(ctrl.Log.WithName("test"))
+
+	// 特殊入口的ingress由SQBDeployment创建，SQBApplication处理时需要保留
+	sqbdeployment := &qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-feature-a", Namespace: "default",
+		Labels:      map[string]string{entity.AppKey: "app", entity.PlaneKey: "feature-a"},
+		Annotations: map[string]string{entity.PublicEntryAnnotationKey: "true"}}}
+	publicEntry := &v1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: getIngressName("app", "nginx", "app-feature-a.example.com"), Namespace: "default",
+			Labels:      map[string]string{entity.AppKey: "app"},
+			Annotations: map[string]string{entity.IngressClassAnnotationKey: "nginx"}},
+		Spec: v1.IngressSpec{Rules: []v1.IngressRule{{Host: "app-feature-a.example.com"}}},
+	}
+	SetK8sClient(&applyClient{Client: fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(sqbdeployment, publicEntry).Build()})
+	ctx := context.Background()
+	sqbapplication := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	sqbapplication.Spec.Domains = []qav1alpha1.Domain{{Class: "nginx", Host: "app.example.com"}}
+
+	assert.NilError(t, NewSqbapplicationIngressHandler(sqbapplication, ctx).Handle())
+	ingressList := &v1.IngressList{}
+	assert.NilError(t, k8sclient.List(ctx, ingressList, client.InNamespace("default")))
+	names := make([]string, 0)
+	for _, ingress := range ingressList.Items {
+		names = append(names, ingress.Name)
+	}
+	assert.DeepEqual(t, names, []string{"app.nginx.app-feature-a.example.com", "app.nginx.app.example.com"})
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sync"
+)
+
+type kubevelaSkippedKey struct{}
+
+// 一次处理中因为由kubevela管理而跳过的子资源
+type kubevelaSkipped struct {
+	sync.Mutex
+	resources []qav1alpha1.KubevelaSkippedResource
+}
+
+// withKubevelaSkipped 子资源handler使用返回的ctx，处理完成后通过getKubevelaSkipped取出跳过的子资源
+func withKubevelaSkipped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, kubevelaSkippedKey{}, &kubevelaSkipped{})
+}
+
+func getKubevelaSkipped(ctx context.Context) []qav1alpha1.KubevelaSkippedResource {
+	skipped, ok := ctx.Value(kubevelaSkippedKey{}).(*kubevelaSkipped)
+	if !ok {
+		return nil
+	}
+	skipped.Lock()
+	defer skipped.Unlock()
+	return skipped.resources
+}
+
+func recordKubevelaSkipped(ctx context.Context, obj runtimeObj) {
+	kind, _ := apiutil.GVKForObject(obj, k8sScheme)
+	log.Info("skip obj managed by kubevela", "kind", kind,
+		"namespace", obj.GetNamespace(), "name", obj.GetName())
+	skipped, ok := ctx.Value(kubevelaSkippedKey{}).(*kubevelaSkipped)
+	if !ok {
+		return
+	}
+	skipped.Lock()
+	defer skipped.Unlock()
+	for _, resource := range skipped.resources {
+		if resource.Kind == kind.Kind && resource.Name == obj.GetName() {
+			return
+		}
+	}
+	skipped.resources = append(skipped.resources, qav1alpha1.KubevelaSkippedResource{
+		Kind:            kind.Kind,
+		Name:            obj.GetName(),
+		LastAppliedTime: obj.GetAnnotations()[entity.KubevelaLastAppliedTime],
+	})
+}
+
+// kubevelaMode 对象的处理方式，不是kubevela创建的对象由operator拥有
+func kubevelaMode(obj runtimeObj) string {
+	if !isKubevelaManaged(obj) {
+		return entity.KubevelaModeOperator
+	}
+	switch mode := obj.GetAnnotations()[entity.KubevelaModeAnnotationKey]; mode {
+	case entity.KubevelaModeOperator, entity.KubevelaModeMerge:
+		return mode
+	}
+	return entity.KubevelaModeVela
+}
+
+func isKubevelaManaged(obj runtimeObj) bool {
+	_, ok := obj.GetLabels()[entity.KubevelaAppNameLabel]
+	return ok
+}
+
+// handleKubevelaCommand 执行集群中对象上的kubevela-command注解：修改kubevela-mode注解并移除命令，返回是否为takeover
+func handleKubevelaCommand(ctx context.Context, live runtimeObj) (bool, error) {
+	command, ok := live.GetAnnotations()[entity.KubevelaCommandAnnotationKey]
+	if !ok {
+		return false, nil
+	}
+	var mode string
+	switch command {
+	case entity.KubevelaCommandTakeover:
+		mode = entity.KubevelaModeOperator
+	case entity.KubevelaCommandHandback:
+		mode = entity.KubevelaModeVela
+	default:
+		return false, fmt.Errorf("annotation %s=%s is invalid, must be %s or %s", entity.KubevelaCommandAnnotationKey,
+			command, entity.KubevelaCommandTakeover, entity.KubevelaCommandHandback)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				entity.KubevelaCommandAnnotationKey: nil,
+				entity.KubevelaModeAnnotationKey:    mode,
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	kind, _ := apiutil.GVKForObject(live, k8sScheme)
+	err = k8sclient.Patch(ctx, live, client.RawPatch(types.MergePatchType, patch))
+	log.Info("kubevela command", "kind", kind,
+		"namespace", live.GetNamespace(), "name", live.GetName(), "command", command, "error", err)
+	return command == entity.KubevelaCommandTakeover, err
+}
@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	writeResultCreated = "created"
+	writeResultUpdated = "updated"
+	writeResultSkipped = "skipped"
+)
+
+// 子资源的写入次数，result为created、updated或者skipped(期望状态没有变化，跳过更新)
+var childWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "elastic_env_operator_child_writes_total",
+	Help: "Number of child resource writes by kind and result",
+}, []string{"kind", "result"})
+
+func init() {
+	metrics.Registry.MustRegister(childWrites)
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"github.com/wosai/elastic-env-operator/domain/util"
+	appv1 "k8s.io/api/apps/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type pdbHandler struct {
+	sqbdeployment *qav1alpha1.SQBDeployment
+	deploy        *qav1alpha1.DeploySpec
+	ctx           context.Context
+}
+
+func NewPDBHandler(sqbdeployment *qav1alpha1.SQBDeployment, deploy *qav1alpha1.DeploySpec, ctx context.Context) *pdbHandler {
+	return &pdbHandler{sqbdeployment: sqbdeployment, deploy: deploy, ctx: ctx}
+}
+
+func (h *pdbHandler) CreateOrUpdate() error {
+	selector, err := h.podSelector()
+	if err != nil {
+		return err
+	}
+	pdb := &policyv1beta1.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
+	pdb.Labels = util.MergeStringMap(nil, h.sqbdeployment.Labels)
+	pdb.Spec.Selector = &metav1.LabelSelector{MatchLabels: selector}
+	budget := h.deploy.DisruptionBudget
+	if budget == nil || (budget.MinAvailable == nil && budget.MaxUnavailable == nil) {
+		budget = defaultDisruptionBudget(entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).Env())
+	}
+	pdb.Spec.MinAvailable = budget.MinAvailable
+	pdb.Spec.MaxUnavailable = budget.MaxUnavailable
+	return Apply(h.ctx, pdb)
+}
+
+// defaultDisruptionBudget 没有配置minAvailable和maxUnavailable时的默认值，使用maxUnavailable，
+// 只有一个副本时也不会阻塞节点驱逐。生产环境最多四分之一的pod不可用(向上取整)，测试环境最多一个
+func defaultDisruptionBudget(env string) *qav1alpha1.DisruptionBudgetSpec {
+	maxUnavailable := intstr.FromInt(1)
+	if env == entity.ENV_PROD {
+		maxUnavailable = intstr.FromString("25%")
+	}
+	return &qav1alpha1.DisruptionBudgetSpec{MaxUnavailable: &maxUnavailable}
+}
+
+// disruptionBudgetEnabled 没有配置disruptionBudget时基础环境默认创建，特性环境需要配置后才创建
+func (h *pdbHandler) disruptionBudgetEnabled() bool {
+	if h.deploy.DisruptionBudget == nil {
+		return h.sqbdeployment.Labels[entity.PlaneKey] == entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).BaseFlag()
+	}
+	return h.deploy.DisruptionBudgetEnabled()
+}
+
+// podSelector 与deployment的pod的app、version标签一致，存量deployment的app标签以deployment的selector为准
+func (h *pdbHandler) podSelector() (map[string]string, error) {
+	selector := map[string]string{
+		entity.AppKey:   h.sqbdeployment.Spec.Selector.App,
+		entity.PlaneKey: h.sqbdeployment.Labels[entity.PlaneKey],
+	}
+	deployment := &appv1.Deployment{}
+	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}, deployment)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return selector, nil
+		}
+		return nil, err
+	}
+	for _, key := range []string{entity.AppKey, entity.PlaneKey} {
+		if value, ok := deployment.Spec.Template.Labels[key]; ok {
+			selector[key] = value
+		}
+	}
+	return selector, nil
+}
+
+func (h *pdbHandler) Delete() error {
+	pdb := &policyv1beta1.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
+	return deleteOrRetain(h.ctx, pdb, h.sqbdeployment)
+}
+
+func (h *pdbHandler) Handle() error {
+	if deleted, _ := IsDeleted(h.sqbdeployment); deleted {
+		return h.Delete()
+	}
+	if h.disruptionBudgetEnabled() {
+		return h.CreateOrUpdate()
+	}
+	return h.Delete()
+}
+
+func (h *pdbHandler) ConditionType() string {
+	return qav1alpha1.ConditionDisruptionBudgetReady
+}
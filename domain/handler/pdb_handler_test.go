@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"gotest.tools/assert"
+	appv1 "k8s.io/api/apps/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+)
+
+func TestPDBHandler(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{"env": entity.ENV_PROD, "baseFlag": "base"})
+	defer entity.ConfigMapData.FromMap(map[string]string{})
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = qav1alpha1.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	SetK8sLog(ctrl.Log.WithName("test"))
+	// 存量deployment的app标签带有-ack后缀
+	deployment := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app-base", Namespace: "default"}}
+	deployment.Spec.Template.Labels = map[string]string{entity.AppKey: "app-ack", entity.PlaneKey: "base"}
+	SetK8sClient(&applyClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(deployment).Build()})
+	ctx := context.Background()
+
+	sqbdeployment := &qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-base", Namespace: "default",
+		Labels: map[string]string{entity.AppKey: "app", entity.PlaneKey: "base"}}}
+	sqbdeployment.Spec.Selector = qav1alpha1.Selector{App: "app", Plane: "base"}
+	// 没有配置时基础环境使用默认值
+	deploy := &qav1alpha1.DeploySpec{}
+	assert.NilError(t, NewPDBHandler(sqbdeployment, deploy, ctx).Handle())
+	pdb := &policyv1beta1.PodDisruptionBudget{}
+	assert.NilError(t, k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbdeployment), pdb))
+	assert.DeepEqual(t, pdb.Spec.Selector.MatchLabels, map[string]string{entity.AppKey: "app-ack", entity.PlaneKey: "base"})
+	assert.Assert(t, pdb.Spec.MinAvailable == nil)
+	assert.Equal(t, pdb.Spec.MaxUnavailable.String(), "25%")
+
+	// 没有配置时特性环境不创建
+	feature := &qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-feature", Namespace: "default",
+		Labels: map[string]string{entity.AppKey: "app", entity.PlaneKey: "feature"}}}
+	feature.Spec.Selector = qav1alpha1.Selector{App: "app", Plane: "feature"}
+	assert.NilError(t, NewPDBHandler(feature, deploy, ctx).Handle())
+	err := k8sclient.Get(ctx, client.ObjectKeyFromObject(feature), &policyv1beta1.PodDisruptionBudget{})
+	assert.Equal(t, apierrors.IsNotFound(err), true)
+	assert.NilError(t, NewPDBHandler(feature, &qav1alpha1.DeploySpec{DisruptionBudget: &qav1alpha1.DisruptionBudgetSpec{}}, ctx).Handle())
+	assert.NilError(t, k8sclient.Get(ctx, client.ObjectKeyFromObject(feature), &policyv1beta1.PodDisruptionBudget{}))
+
+	deploy.DisruptionBudget = &qav1alpha1.DisruptionBudgetSpec{}
+
+	// 配置的值优先于默认值
+	maxUnavailable := intstr.FromInt(2)
+	deploy.DisruptionBudget.MaxUnavailable = &maxUnavailable
+	assert.NilError(t, NewPDBHandler(sqbdeployment, deploy, ctx).Handle())
+	pdb = &policyv1beta1.PodDisruptionBudget{}
+	assert.NilError(t, k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbdeployment), pdb))
+	assert.Assert(t, pdb.Spec.MinAvailable == nil)
+	assert.Equal(t, pdb.Spec.MaxUnavailable.IntValue(), 2)
+
+	deploy.DisruptionBudget.Disabled = true
+	assert.NilError(t, NewPDBHandler(sqbdeployment, deploy, ctx).Handle())
+	err = k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbdeployment), &policyv1beta1.PodDisruptionBudget{})
+	assert.Equal(t, apierrors.IsNotFound(err), true)
+}
+
+func TestDefaultDisruptionBudget(t *testing.T) {
+	budget := defaultDisruptionBudget(entity.ENV_TEST)
+	assert.Assert(t, budget.MinAvailable == nil)
+	assert.Equal(t, budget.MaxUnavailable.IntValue(), 1)
+	budget = defaultDisruptionBudget(entity.ENV_PROD)
+	assert.Assert(t, budget.MinAvailable == nil)
+	assert.Equal(t, budget.MaxUnavailable.String(), "25%")
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	istioapi "istio.io/api/networking/v1beta1"
+	"regexp"
+	"strings"
+)
+
+// istio通过这个前缀的header匹配RequestAuthentication校验后的JWT claim
+const jwtClaimHeaderPrefix = "@request.auth.claims."
+
+// defaultPlaneRouting 匹配x-env-flag的header、query参数和调用方的version label，转发时设置x-env-flag
+func defaultPlaneRouting() *qav1alpha1.PlaneRoutingSpec {
+	return &qav1alpha1.PlaneRoutingSpec{
+		Matches: []qav1alpha1.PlaneRouteMatch{
+			{Type: qav1alpha1.PlaneRouteMatchHeader, Key: entity.XEnvFlag},
+			{Type: qav1alpha1.PlaneRouteMatchQuery, Key: entity.XEnvFlag},
+			{Type: qav1alpha1.PlaneRouteMatchSourceLabel, Key: entity.PlaneKey},
+		},
+		PropagateHeaders: []string{entity.XEnvFlag},
+	}
+}
+
+// resolvePlaneRouting 计算实际生效的位面匹配方式：默认值 -> operator配置 -> SQBApplication，逐层覆盖
+func resolvePlaneRouting(sqbapplication *qav1alpha1.SQBApplication) (*qav1alpha1.PlaneRoutingSpec, error) {
+	routing := defaultPlaneRouting()
+	if specString := entity.ConfigMapData.ForNamespace(sqbapplication.Namespace).PlaneRouting(); specString != "" {
+		config := &qav1alpha1.PlaneRoutingSpec{}
+		if err := json.Unmarshal([]byte(specString), config); err != nil {
+			return nil, fmt.Errorf("planeRouting: %w", err)
+		}
+		routing = routing.Overlay(config)
+	}
+	routing = routing.Overlay(sqbapplication.Spec.PlaneRouting)
+	if err := routing.Validate(); err != nil {
+		return nil, fmt.Errorf("planeRouting: %w", err)
+	}
+	return routing, nil
+}
+
+// planeHttpMatches 每种匹配方式生成一个match，path不为/时同时匹配前缀
+func planeHttpMatches(routing *qav1alpha1.PlaneRoutingSpec, plane, path string) []*istioapi.HTTPMatchRequest {
+	matches := make([]*istioapi.HTTPMatchRequest, 0, len(routing.Matches))
+	exactMatch := &istioapi.StringMatch{
+		MatchType: &istioapi.StringMatch_Exact{Exact: plane},
+	}
+	for _, match := range routing.Matches {
+		matchRequest := &istioapi.HTTPMatchRequest{}
+		switch match.Type {
+		case qav1alpha1.PlaneRouteMatchHeader:
+			// istio要求header名称为小写
+			matchRequest.Headers = map[string]*istioapi.StringMatch{strings.ToLower(match.Key): exactMatch}
+		case qav1alpha1.PlaneRouteMatchQuery:
+			matchRequest.QueryParams = map[string]*istioapi.StringMatch{match.Key: exactMatch}
+		case qav1alpha1.PlaneRouteMatchCookie:
+			matchRequest.Headers = map[string]*istioapi.StringMatch{"cookie": {
+				MatchType: &istioapi.StringMatch_Regex{Regex: cookieRegex(match.Key, plane)},
+			}}
+		case qav1alpha1.PlaneRouteMatchSourceLabel:
+			matchRequest.SourceLabels = map[string]string{match.Key: plane}
+		case qav1alpha1.PlaneRouteMatchJWTClaim:
+			matchRequest.Headers = map[string]*istioapi.StringMatch{jwtClaimHeaderPrefix + match.Key: exactMatch}
+		default:
+			continue
+		}
+		if path != "/" {
+			matchRequest.Uri = &istioapi.StringMatch{
+				MatchType: &istioapi.StringMatch_Prefix{Prefix: path},
+			}
+		}
+		matches = append(matches, matchRequest)
+	}
+	return matches
+}
+
+// cookieRegex istio的regex需要匹配整个cookie header
+func cookieRegex(name, value string) string {
+	return fmt.Sprintf(`^(.*?;\s*)?%s=%s(;.*)?$`, regexp.QuoteMeta(name), regexp.QuoteMeta(value))
+}
+
+// planeTcpMatches tcp只能按调用方的label匹配，没有配置sourceLabel时返回空
+func planeTcpMatches(routing *qav1alpha1.PlaneRoutingSpec, plane string) []*istioapi.L4MatchAttributes {
+	matches := make([]*istioapi.L4MatchAttributes, 0)
+	for _, match := range routing.Matches {
+		if match.Type == qav1alpha1.PlaneRouteMatchSourceLabel {
+			matches = append(matches, &istioapi.L4MatchAttributes{SourceLabels: map[string]string{match.Key: plane}})
+		}
+	}
+	return matches
+}
+
+// planeRequestHeaders 转发到位面时设置的请求header，关闭传递时返回nil
+func planeRequestHeaders(routing *qav1alpha1.PlaneRoutingSpec, plane string) *istioapi.Headers {
+	if (routing.DisablePropagation != nil && *routing.DisablePropagation) || len(routing.PropagateHeaders) == 0 {
+		return nil
+	}
+	set := make(map[string]string)
+	for _, header := range routing.PropagateHeaders {
+		set[strings.ToLower(header)] = plane
+	}
+	return &istioapi.Headers{
+		Request: &istioapi.Headers_HeaderOperations{Set: set},
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"regexp"
+	"testing"
+)
+
+func TestResolvePlaneRouting(t *testing.T) {
+	defer entity.ConfigMapData.SetNamespaceOverride("default", nil)
+	sqbapplication := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+
+	entity.ConfigMapData.FromMap(map[string]string{})
+	routing, err := resolvePlaneRouting(sqbapplication)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, routing, defaultPlaneRouting())
+
+	// namespace配置覆盖默认值，SQBApplication覆盖namespace配置
+	entity.ConfigMapData.FromMap(map[string]string{})
+	entity.ConfigMapData.SetNamespaceOverride("default", map[string]string{
+		"planeRouting": `{"matches":[{"type":"header","key":"x-b3-env"}],"propagateHeaders":["x-b3-env"]}`})
+	routing, err = resolvePlaneRouting(sqbapplication)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, routing.Matches, []qav1alpha1.PlaneRouteMatch{{Type: qav1alpha1.PlaneRouteMatchHeader, Key: "x-b3-env"}})
+	assert.DeepEqual(t, routing.PropagateHeaders, []string{"x-b3-env"})
+
+	disabled := true
+	sqbapplication.Spec.PlaneRouting = &qav1alpha1.PlaneRoutingSpec{DisablePropagation: &disabled}
+	routing, err = resolvePlaneRouting(sqbapplication)
+	assert.NilError(t, err)
+	assert.Equal(t, routing.Matches[0].Key, "x-b3-env")
+	assert.Assert(t, planeRequestHeaders(routing, "feature-a") == nil)
+
+	// configmap中的配置没有经过schema校验，使用时报错
+	entity.ConfigMapData.SetNamespaceOverride("default", map[string]string{
+		"planeRouting": `{"matches":[{"type":"grpc","key":"env"}]}`})
+	_, err = resolvePlaneRouting(sqbapplication)
+	assert.ErrorContains(t, err, "matches[0].type")
+}
+
+func TestPlaneMatches(t *testing.T) {
+	routing := &qav1alpha1.PlaneRoutingSpec{Matches: []qav1alpha1.PlaneRouteMatch{
+		{Type: qav1alpha1.PlaneRouteMatchQuery, Key: "env"},
+		{Type: qav1alpha1.PlaneRouteMatchSourceLabel, Key: "lane"},
+		{Type: qav1alpha1.PlaneRouteMatchSourceLabel, Key: entity.PlaneKey},
+	}}
+	matches := planeHttpMatches(routing, "feature-a", "/api")
+	assert.Equal(t, len(matches), 3)
+	assert.Equal(t, matches[0].QueryParams["env"].GetExact(), "feature-a")
+	assert.Equal(t, matches[0].Uri.GetPrefix(), "/api")
+	assert.Equal(t, matches[1].SourceLabels["lane"], "feature-a")
+
+	tcpMatches := planeTcpMatches(routing, "feature-a")
+	assert.Equal(t, len(tcpMatches), 2)
+	assert.Equal(t, tcpMatches[0].SourceLabels["lane"], "feature-a")
+	assert.Equal(t, len(planeTcpMatches(&qav1alpha1.PlaneRoutingSpec{}, "feature-a")), 0)
+
+	cookie := regexp.MustCompile(cookieRegex("env", "feature-a"))
+	for _, header := range []string{"env=feature-a", "a=1; env=feature-a", "env=feature-a;b=2", "a=1;env=feature-a; b=2"} {
+		assert.Assert(t, cookie.MatchString(header), header)
+	}
+	for _, header := range []string{"env=feature-ab", "xenv=feature-a", "env=feature-a1; b=2"} {
+		assert.Assert(t, !cookie.MatchString(header), header)
+	}
+}
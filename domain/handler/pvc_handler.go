@@ -18,11 +18,12 @@ import (
 
 type pvcHandler struct {
 	sqbdeployment *qav1alpha1.SQBDeployment
+	deploy        *qav1alpha1.DeploySpec
 	ctx           context.Context
 }
 
-func NewPVCHandler(sqbdeployment *qav1alpha1.SQBDeployment, ctx context.Context) *pvcHandler {
-	return &pvcHandler{sqbdeployment: sqbdeployment, ctx: ctx}
+func NewPVCHandler(sqbdeployment *qav1alpha1.SQBDeployment, deploy *qav1alpha1.DeploySpec, ctx context.Context) *pvcHandler {
+	return &pvcHandler{sqbdeployment: sqbdeployment, deploy: deploy, ctx: ctx}
 }
 
 func (h *pvcHandler) CreateOrUpdate() error {
@@ -34,7 +35,7 @@ func (h *pvcHandler) CreateOrUpdate() error {
 	for _, pvc := range pvcList.Items {
 		exists[pvc.Name] = struct{}{}
 	}
-	for _, volumespec := range h.sqbdeployment.Spec.Volumes {
+	for _, volumespec := range h.deploy.Volumes {
 		if !volumespec.PersistentVolumeClaim {
 			continue
 		}
@@ -75,7 +76,7 @@ func (h *pvcHandler) CreateOrUpdate() error {
 				pvc.Spec.StorageClassName = proto.String("ack" + "-" + group)
 			}
 			pvc.Labels = util.MergeStringMap(pvc.Labels, h.sqbdeployment.Labels)
-			if err = CreateOrUpdate(h.ctx, pvc); err != nil {
+			if err = Apply(h.ctx, pvc); err != nil {
 				return err
 			}
 		}
@@ -100,7 +101,7 @@ func (h *pvcHandler) Delete() error {
 		return err
 	}
 	for _, pvc := range pvcList.Items {
-		if Delete(h.ctx, &pvc) != nil {
+		if err = deleteOrRetain(h.ctx, &pvc, h.sqbdeployment); err != nil {
 			return err
 		}
 	}
@@ -127,7 +128,7 @@ func (h *pvcHandler) getPVCName(mountPath string) string {
 }
 
 func (h *pvcHandler) Handle() error {
-	if !entity.ConfigMapData.IsPVCEnable() {
+	if !entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).IsPVCEnable() {
 		return nil
 	}
 	if deleted, _ := IsDeleted(h.sqbdeployment); deleted {
@@ -135,3 +136,7 @@ func (h *pvcHandler) Handle() error {
 	}
 	return h.CreateOrUpdate()
 }
+
+func (h *pvcHandler) ConditionType() string {
+	return qav1alpha1.ConditionPVCReady
+}
@@ -32,22 +32,22 @@ func NewGrayServiceHandler(sqbdeployment *qav1alpha1.SQBDeployment, ctx context.
 }
 
 func (h *serviceHandler) CreateOrUpdate() error {
-	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
-	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: service.Namespace, Name: service.Name}, service)
+	// 集群中的service只用于读取存量的selector
+	live := &corev1.Service{}
+	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}, live)
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
 	service.Spec.Ports = h.sqbapplication.Spec.Ports
 	// 兼容线上的配置，因为pod的label不能更改，所以service的selector也不能更改
 	service.Spec.Selector = util.MergeStringMap(map[string]string{entity.AppKey: h.sqbapplication.Name},
-		service.Spec.Selector)
+		live.Spec.Selector)
 	if anno, ok := h.sqbapplication.Annotations[entity.ServiceAnnotationKey]; ok {
 		service.Annotations = make(map[string]string)
 		_ = json.Unmarshal([]byte(anno), &service.Annotations)
-	} else {
-		service.Annotations = nil
 	}
-	service.Labels = util.MergeStringMap(service.Labels, h.sqbapplication.Labels)
+	service.Labels = util.MergeStringMap(nil, h.sqbapplication.Labels)
 	// 如果是线上配置，selector需要加上version：base， label需要加上base
 	//if entity.ConfigMapData.Env() == entity.ENV_PROD {
 	//	service.Spec.Selector[entity.PlaneKey] = entity.ConfigMapData.BaseFlag()
@@ -55,12 +55,12 @@ func (h *serviceHandler) CreateOrUpdate() error {
 	//}
 	// 去掉selector的version字段
 	delete(service.Spec.Selector, entity.PlaneKey)
-	return CreateOrUpdate(h.ctx, service)
+	return Apply(h.ctx, service)
 }
 
 func (h *serviceHandler) Delete() error {
 	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
-	return Delete(h.ctx, service)
+	return deleteOrRetain(h.ctx, service, h.sqbapplication)
 }
 
 func (h *serviceHandler) Handle() error {
@@ -70,9 +70,13 @@ func (h *serviceHandler) Handle() error {
 	return h.CreateOrUpdate()
 }
 
+func (h *serviceHandler) ConditionType() string {
+	return qav1alpha1.ConditionServiceReady
+}
+
 func (h *grayServiceHandler) CreateOrUpdate() error {
 	// 生产环境，对于gray的部署，需要创建gray的svc
-	if entity.ConfigMapData.Env() != entity.ENV_PROD || h.sqbdeployment.Spec.Selector.Plane != h.plane {
+	if entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).Env() != entity.ENV_PROD || h.sqbdeployment.Spec.Selector.Plane != h.plane {
 		return nil
 	}
 	sqbapplication := &qav1alpha1.SQBApplication{}
@@ -81,23 +85,19 @@ func (h *grayServiceHandler) CreateOrUpdate() error {
 		return err
 	}
 	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
-	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: service.Namespace, Name: service.Name}, service)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return err
-	}
 	service.Spec.Ports = sqbapplication.Spec.Ports
 	service.Spec.Selector = map[string]string{
 		entity.AppKey:   sqbapplication.Name,
 		entity.PlaneKey: h.plane,
 	}
-	service.Labels = util.MergeStringMap(service.Labels, sqbapplication.Labels)
+	service.Labels = util.MergeStringMap(nil, sqbapplication.Labels)
 	service.Labels[entity.PlaneKey] = h.plane
-	return CreateOrUpdate(h.ctx, service)
+	return Apply(h.ctx, service)
 }
 
 func (h *grayServiceHandler) Delete() error {
 	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
-	return Delete(h.ctx, service)
+	return deleteOrRetain(h.ctx, service, h.sqbdeployment)
 }
 
 func (h *grayServiceHandler) Handle() error {
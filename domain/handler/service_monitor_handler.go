@@ -7,9 +7,7 @@ import (
 	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
 	"github.com/wosai/elastic-env-operator/domain/entity"
 	"github.com/wosai/elastic-env-operator/domain/util"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type serviceMonitorHandler struct {
@@ -23,10 +21,6 @@ func NewServiceMonitorHandler(sqbapplication *qav1alpha1.SQBApplication, ctx con
 
 func (h *serviceMonitorHandler) CreateOrUpdate() error {
 	serviceMonitor := &prometheus.ServiceMonitor{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
-	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: serviceMonitor.Namespace, Name: serviceMonitor.Name}, serviceMonitor)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return err
-	}
 
 	serviceMonitor.Spec.TargetLabels = []string{entity.GroupKey}
 	serviceMonitor.Spec.Selector.MatchLabels = map[string]string{
@@ -36,21 +30,21 @@ func (h *serviceMonitorHandler) CreateOrUpdate() error {
 	serviceMonitor.Spec.NamespaceSelector.MatchNames = []string{h.sqbapplication.Namespace}
 
 	endpoints := make([]prometheus.Endpoint, 0)
-	if err = json.Unmarshal([]byte(h.sqbapplication.Annotations[entity.ServiceMonitorAnnotationKey]), &endpoints); err != nil {
+	if err := json.Unmarshal([]byte(h.sqbapplication.Annotations[entity.ServiceMonitorAnnotationKey]), &endpoints); err != nil {
 		return err
 	}
 	serviceMonitor.Spec.Endpoints = endpoints
-	serviceMonitor.Labels = util.MergeStringMap(serviceMonitor.Labels, h.sqbapplication.Labels)
-	return CreateOrUpdate(h.ctx, serviceMonitor)
+	serviceMonitor.Labels = util.MergeStringMap(nil, h.sqbapplication.Labels)
+	return Apply(h.ctx, serviceMonitor)
 }
 
 func (h *serviceMonitorHandler) Delete() error {
 	service := &prometheus.ServiceMonitor{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
-	return Delete(h.ctx, service)
+	return deleteOrRetain(h.ctx, service, h.sqbapplication)
 }
 
 func (h *serviceMonitorHandler) Handle() error {
-	if !entity.ConfigMapData.IsServiceMonitorEnable() {
+	if !entity.ConfigMapData.ForNamespace(h.sqbapplication.Namespace).IsServiceMonitorEnable() {
 		return nil
 	}
 	if deleted, _ := IsDeleted(h.sqbapplication); deleted {
@@ -62,3 +56,7 @@ func (h *serviceMonitorHandler) Handle() error {
 	}
 	return h.Delete()
 }
+
+func (h *serviceMonitorHandler) ConditionType() string {
+	return qav1alpha1.ConditionScrapeReady
+}
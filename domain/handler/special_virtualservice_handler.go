@@ -8,7 +8,6 @@ import (
 	"github.com/wosai/elastic-env-operator/domain/util"
 	istioapi "istio.io/api/networking/v1beta1"
 	istio "istio.io/client-go/pkg/apis/networking/v1beta1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -24,24 +23,23 @@ func NewSpecialVirtualServiceHandler(sqbdeployment *qav1alpha1.SQBDeployment, ct
 
 func (h *specialVirtualServiceHandler) CreateOrUpdate() error {
 	specialvirtualservice := &istio.VirtualService{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
-	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: specialvirtualservice.Namespace, Name: specialvirtualservice.Name}, specialvirtualservice)
-	if err != nil && !apierrors.IsNotFound(err) {
+	sqbapplication := &qav1alpha1.SQBApplication{}
+	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: specialvirtualservice.Namespace, Name: h.sqbdeployment.Spec.Selector.App}, sqbapplication)
+	if err != nil {
 		return err
 	}
-
-	sqbapplication := &qav1alpha1.SQBApplication{}
-	err = k8sclient.Get(h.ctx, client.ObjectKey{Namespace: specialvirtualservice.Namespace, Name: h.sqbdeployment.Spec.Selector.App}, sqbapplication)
+	routing, err := resolvePlaneRouting(sqbapplication)
 	if err != nil {
 		return err
 	}
 
-	virtualserviceHosts := []string{entity.ConfigMapData.GetDomainNameByClass(h.sqbdeployment.Name, SpecialVirtualServiceIngress(h.sqbdeployment))}
+	virtualserviceHosts := []string{entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).GetDomainNameByClass(h.sqbdeployment.Name, SpecialVirtualServiceIngress(h.sqbdeployment))}
 	specialvirtualservice.Spec.Hosts = virtualserviceHosts
-	specialvirtualservice.Spec.Gateways = entity.ConfigMapData.IstioGateways()
+	specialvirtualservice.Spec.Gateways = entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).IstioGateways()
 
 	httproutes := make([]*istioapi.HTTPRoute, 0)
 
-	for _, path := range sqbapplication.Spec.Subpaths {
+	for _, path := range sortSubpaths(sqbapplication.Spec.Subpaths) {
 		httpRoute := &istioapi.HTTPRoute{
 			Match: []*istioapi.HTTPMatchRequest{
 				{
@@ -56,10 +54,8 @@ func (h *specialVirtualServiceHandler) CreateOrUpdate() error {
 					Subset: h.sqbdeployment.Labels[entity.PlaneKey],
 				}},
 			},
-			Headers: &istioapi.Headers{
-				Request: &istioapi.Headers_HeaderOperations{Set: map[string]string{entity.XEnvFlag: h.sqbdeployment.Labels[entity.PlaneKey]}},
-			},
-			Timeout: &types2.Duration{Seconds: entity.ConfigMapData.IstioTimeout()},
+			Headers: planeRequestHeaders(routing, h.sqbdeployment.Labels[entity.PlaneKey]),
+			Timeout: &types2.Duration{Seconds: entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).IstioTimeout()},
 		}
 		httproutes = append(httproutes, httpRoute)
 	}
@@ -70,24 +66,22 @@ func (h *specialVirtualServiceHandler) CreateOrUpdate() error {
 				Subset: h.sqbdeployment.Labels[entity.PlaneKey],
 			}},
 		},
-		Timeout: &types2.Duration{Seconds: entity.ConfigMapData.IstioTimeout()},
-		Headers: &istioapi.Headers{
-			Request: &istioapi.Headers_HeaderOperations{Set: map[string]string{entity.XEnvFlag: h.sqbdeployment.Labels[entity.PlaneKey]}},
-		},
+		Timeout: &types2.Duration{Seconds: entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).IstioTimeout()},
+		Headers: planeRequestHeaders(routing, h.sqbdeployment.Labels[entity.PlaneKey]),
 	})
 
 	specialvirtualservice.Spec.Http = httproutes
-	specialvirtualservice.Labels = util.MergeStringMap(specialvirtualservice.Labels, h.sqbdeployment.Labels)
-	return CreateOrUpdate(h.ctx, specialvirtualservice)
+	specialvirtualservice.Labels = util.MergeStringMap(nil, h.sqbdeployment.Labels)
+	return Apply(h.ctx, specialvirtualservice)
 }
 
 func (h *specialVirtualServiceHandler) Delete() error {
 	specialvirtualservice := &istio.VirtualService{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
-	return Delete(h.ctx, specialvirtualservice)
+	return deleteOrRetain(h.ctx, specialvirtualservice, h.sqbdeployment)
 }
 
 func (h *specialVirtualServiceHandler) Handle() error {
-	if !entity.ConfigMapData.IstioEnable() {
+	if !entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).IstioEnable() {
 		return nil
 	}
 	deleted, _ := IsDeleted(h.sqbdeployment)
@@ -96,3 +90,7 @@ func (h *specialVirtualServiceHandler) Handle() error {
 	}
 	return h.Delete()
 }
+
+func (h *specialVirtualServiceHandler) ConditionType() string {
+	return qav1alpha1.ConditionVirtualServiceReady
+}
@@ -4,7 +4,12 @@ import (
 	"context"
 	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
 	"github.com/wosai/elastic-env-operator/domain/entity"
+	"github.com/wosai/elastic-env-operator/domain/util"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
 )
 
 type sqbApplicationHandler struct {
@@ -32,61 +37,123 @@ func (h *sqbApplicationHandler) Operate(obj runtimeObj) error {
 	if err != nil {
 		return err
 	}
+	if done, err := handleFinalizer(h.ctx, in, deleted); done || err != nil {
+		return err
+	}
+	status := in.Status.DeepCopy()
+	hash := h.Hash(in)
 	// 补充默认值
 	for i, domain := range in.Spec.Domains {
 		if domain.Host == "" {
-			domain.Host = entity.ConfigMapData.GetDomainNameByClass(in.Name, domain.Class)
+			domain.Host = entity.ConfigMapData.ForNamespace(in.Namespace).GetDomainNameByClass(in.Name, domain.Class)
 			in.Spec.Domains[i] = domain
 		}
 	}
 
+	// 记录子资源handler跳过的kubevela管理的对象
+	ctx := withKubevelaSkipped(h.ctx)
 	handlers := []SQBHandler{
-		NewServiceHandler(in, h.ctx),
-		NewSqbapplicationIngressHandler(in, h.ctx),
-		//NewDestinationRuleHandler(in, h.ctx),
-		//NewVirtualServiceHandler(in, h.ctx),
-		//NewServiceMonitorHandler(in, h.ctx),
-		NewSqbDeploymentListHandlerForSqbapplication(in, h.ctx),
-		NewVMServiceScrapeHandler(in, h.ctx),
+		NewServiceHandler(in, ctx),
+		NewSqbapplicationIngressHandler(in, ctx),
+		NewDestinationRuleHandler(in, ctx),
+		NewVirtualServiceHandler(in, ctx),
+		NewServiceMonitorHandler(in, ctx),
+		NewSqbDeploymentListHandlerForSqbapplication(in, ctx),
+		NewVMServiceScrapeHandler(in, ctx),
 	}
 
-	for _, handler := range handlers {
-		if err := handler.Handle(); err != nil {
-			return err
-		}
+	if err = handleAll(handlers, &in.Status.Conditions, in.Generation); err != nil {
+		return err
 	}
 
 	if deleted {
-		return Delete(h.ctx, in)
-	} else if in.Status.ErrorInfo != "" {
-		in.Status.ErrorInfo = ""
+		return finishDeletion(h.ctx, in)
+	}
+	in.Status.ErrorInfo = ""
+	in.Status.KubevelaSkipped = getKubevelaSkipped(ctx)
+	in.Status.ObservedGeneration = in.Generation
+	in.Status.ObservedHash = hash
+	setCondition(&in.Status.Conditions, in.Generation, qav1alpha1.ConditionProgressing, metav1.ConditionFalse,
+		qav1alpha1.ReasonReconcileSucceeded, "")
+	setReconcileSucceeded(&in.Status.Conditions, in.Generation)
+	if !equality.Semantic.DeepEqual(status, &in.Status) {
 		return UpdateStatus(h.ctx, in)
 	}
 	return nil
 }
 
+// Hash 子资源还依赖SQBDeployment汇总的位面和灰度权重
+func (h *sqbApplicationHandler) Hash(obj runtimeObj) string {
+	in := obj.(*qav1alpha1.SQBApplication)
+	return objectHash(in, in.Spec, in.Status.Planes, in.Status.CanaryWeights)
+}
+
+func (h *sqbApplicationHandler) ObservedHash(obj runtimeObj) string {
+	return obj.(*qav1alpha1.SQBApplication).Status.ObservedHash
+}
+
 func (h *sqbApplicationHandler) ReconcileFail(obj runtimeObj, err error) {
 	in := obj.(*qav1alpha1.SQBApplication)
 	in.Status.ErrorInfo = err.Error()
+	in.Status.ObservedGeneration = in.Generation
+	in.Status.ObservedHash = ""
+	setReconcileFailed(&in.Status.Conditions, in.Generation, err)
 	_ = UpdateStatus(h.ctx, in)
 }
 
+// getPlanes 应用当前的位面，来自未删除的SQBDeployment，按名称排序
+func getPlanes(ctx context.Context, sqbapplication *qav1alpha1.SQBApplication) ([]string, error) {
+	sqbdeployments, err := listPlaneSQBDeployments(ctx, sqbapplication)
+	if err != nil {
+		return nil, err
+	}
+	planes := make([]string, 0, len(sqbdeployments))
+	for _, sqbdeployment := range sqbdeployments {
+		if plane := sqbdeployment.Labels[entity.PlaneKey]; !util.ContainString(planes, plane) {
+			planes = append(planes, plane)
+		}
+	}
+	sort.Strings(planes)
+	return planes, nil
+}
+
+// listPlaneSQBDeployments 应用下有位面标签并且未删除的SQBDeployment
+func listPlaneSQBDeployments(ctx context.Context, sqbapplication *qav1alpha1.SQBApplication) ([]*qav1alpha1.SQBDeployment, error) {
+	sqbdeployments := &qav1alpha1.SQBDeploymentList{}
+	if err := k8sclient.List(ctx, sqbdeployments, client.InNamespace(sqbapplication.Namespace),
+		client.MatchingLabels{entity.AppKey: sqbapplication.Name}); err != nil {
+		return nil, err
+	}
+	result := make([]*qav1alpha1.SQBDeployment, 0, len(sqbdeployments.Items))
+	for i := range sqbdeployments.Items {
+		sqbdeployment := &sqbdeployments.Items[i]
+		if sqbdeployment.Labels[entity.PlaneKey] == "" || !sqbdeployment.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if deleted, _ := IsDeleted(sqbdeployment); deleted {
+			continue
+		}
+		result = append(result, sqbdeployment)
+	}
+	return result, nil
+}
+
 // 判断应用是否启用istio逻辑：
 // 1.如果集群装了istio且有注解，根据注解
 // 2.如果集群装了istio但没有注解，根据集群默认配置
 // 3.如果集群没有装istio，不启用istio
 func IsIstioInject(sqbapplication *qav1alpha1.SQBApplication) bool {
-	if entity.ConfigMapData.IstioEnable() {
+	if entity.ConfigMapData.ForNamespace(sqbapplication.Namespace).IstioEnable() {
 		if istioInject, ok := sqbapplication.Annotations[entity.IstioInjectAnnotationKey]; ok {
 			return istioInject == "true"
 		}
-		return entity.ConfigMapData.IstioInject()
+		return entity.ConfigMapData.ForNamespace(sqbapplication.Namespace).IstioInject()
 	}
 	return false
 }
 
-func HasIstioIngressGateway() bool {
-	return entity.ConfigMapData.HasIstioIngressGateway()
+func HasIstioIngressGateway(namespace string) bool {
+	return entity.ConfigMapData.ForNamespace(namespace).HasIstioIngressGateway()
 }
 
 // 判断应用是否启用ingress逻辑：
@@ -96,5 +163,5 @@ func IsIngressOpen(sqbapplication *qav1alpha1.SQBApplication) bool {
 	if is, ok := sqbapplication.Annotations[entity.IngressOpenAnnotationKey]; ok {
 		return is == "true"
 	}
-	return entity.ConfigMapData.IngressOpen()
+	return entity.ConfigMapData.ForNamespace(sqbapplication.Namespace).IngressOpen()
 }
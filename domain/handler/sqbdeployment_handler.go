@@ -2,15 +2,19 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
 	"github.com/wosai/elastic-env-operator/domain/entity"
+	"k8s.io/apimachinery/pkg/api/equality"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
 )
 
 type sqbDeploymentHandler struct {
-	req ctrl.Request
-	ctx context.Context
+	req          ctrl.Request
+	ctx          context.Context
+	requeueAfter time.Duration
 }
 
 func NewSqbDeploymentHanlder(req ctrl.Request, ctx context.Context) *sqbDeploymentHandler {
@@ -55,38 +59,110 @@ func (h *sqbDeploymentHandler) Operate(obj runtimeObj) error {
 	if err != nil {
 		return err
 	}
+	if done, err := handleFinalizer(h.ctx, in, deleted); done || err != nil {
+		return err
+	}
 
+	status := in.Status.DeepCopy()
+	hash := h.Hash(in)
+	// 删除时不需要计算生效的配置，sqbapplication可能已经不存在
+	deploy := in.Spec.DeploySpec.DeepCopy()
+	if !deleted {
+		sqbapplication := &qav1alpha1.SQBApplication{}
+		if err = k8sclient.Get(h.ctx, client.ObjectKey{Namespace: in.Namespace, Name: in.Spec.Selector.App},
+			sqbapplication); err != nil {
+			return err
+		}
+		if deploy, err = ResolveDeploySpec(sqbapplication, in); err != nil {
+			return err
+		}
+	}
+
+	// 记录子资源handler跳过的kubevela管理的对象
+	ctx := withKubevelaSkipped(h.ctx)
 	handlers := []SQBHandler{
-		NewPVCHandler(in, h.ctx),
-		NewDeploymentHandler(in, h.ctx),
+		NewPVCHandler(in, deploy, ctx),
+		NewDeploymentHandler(in, deploy, ctx),
+		NewHPAHandler(in, deploy, ctx),
+		NewPDBHandler(in, deploy, ctx),
 		//NewGrayServiceHandler(in, h.ctx),
 		//NewGrayVMServiceScrapeHandler(in, h.ctx),
-		NewSqbdeploymentIngressHandler(in, h.ctx),
-		NewSpecialVirtualServiceHandler(in, h.ctx),
+		NewSqbdeploymentIngressHandler(in, ctx),
+		NewSpecialVirtualServiceHandler(in, ctx),
 	}
 
-	for _, handler := range handlers {
-		if err = handler.Handle(); err != nil {
-			return err
-		}
+	if err = handleAll(handlers, &in.Status.Conditions, in.Generation); err != nil {
+		return err
 	}
 
 	if deleted {
-		return Delete(h.ctx, in)
-	} else if in.Status.ErrorInfo != "" {
-		in.Status.ErrorInfo = ""
+		if err = syncCanaryWeight(h.ctx, in, true); err != nil {
+			return err
+		}
+		return finishDeletion(h.ctx, in)
+	}
+	h.requeueAfter = advanceCanary(h.ctx, in, time.Now())
+	setCanaryAnalysisCondition(in)
+	if err = syncCanaryWeight(h.ctx, in, false); err != nil {
+		return err
+	}
+	in.Status.ErrorInfo = ""
+	in.Status.KubevelaSkipped = getKubevelaSkipped(ctx)
+	in.Status.DeploySpec = deploy
+	in.Status.ObservedGeneration = in.Generation
+	in.Status.ObservedHash = hash
+	setReconcileSucceeded(&in.Status.Conditions, in.Generation)
+	if !equality.Semantic.DeepEqual(status, &in.Status) {
 		return UpdateStatus(h.ctx, in)
 	}
 	return nil
 }
 
+// Hash 生效的部署配置还依赖SQBApplication
+func (h *sqbDeploymentHandler) Hash(obj runtimeObj) string {
+	in := obj.(*qav1alpha1.SQBDeployment)
+	sqbapplication := &qav1alpha1.SQBApplication{}
+	if err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: in.Namespace, Name: in.Spec.Selector.App},
+		sqbapplication); err != nil {
+		return ""
+	}
+	return objectHash(in, in.Spec, sqbapplication.Spec, sqbapplication.Annotations)
+}
+
+// ObservedHash 灰度发布进行中时需要继续推进，operator重启后不能跳过
+func (h *sqbDeploymentHandler) ObservedHash(obj runtimeObj) string {
+	in := obj.(*qav1alpha1.SQBDeployment)
+	if isCanaryProgressing(in) {
+		return ""
+	}
+	return in.Status.ObservedHash
+}
+
+func (h *sqbDeploymentHandler) RequeueAfter() time.Duration {
+	return h.requeueAfter
+}
+
 // 处理失败后逻辑
 func (h *sqbDeploymentHandler) ReconcileFail(obj runtimeObj, err error) {
 	in := obj.(*qav1alpha1.SQBDeployment)
 	in.Status.ErrorInfo = err.Error()
+	in.Status.ObservedGeneration = in.Generation
+	in.Status.ObservedHash = ""
+	setReconcileFailed(&in.Status.Conditions, in.Generation, err)
 	_ = UpdateStatus(h.ctx, in)
 }
 
+// 计算实际生效的部署配置：operator configmap默认配置 -> SQBApplication -> SQBDeployment，逐层覆盖
+func ResolveDeploySpec(sqbapplication *qav1alpha1.SQBApplication, sqbdeployment *qav1alpha1.SQBDeployment) (*qav1alpha1.DeploySpec, error) {
+	deploy := &qav1alpha1.DeploySpec{}
+	if specString := entity.ConfigMapData.ForNamespace(sqbdeployment.Namespace).DefaultDeploySpec(); specString != "" {
+		if err := json.Unmarshal([]byte(specString), deploy); err != nil {
+			return nil, err
+		}
+	}
+	return deploy.Overlay(&sqbapplication.Spec.DeploySpec).Overlay(&sqbdeployment.Spec.DeploySpec), nil
+}
+
 func HasPublicEntry(sqbdeployment *qav1alpha1.SQBDeployment) bool {
 	publicEntry, ok := sqbdeployment.Annotations[entity.PublicEntryAnnotationKey]
 	if ok {
@@ -100,5 +176,5 @@ func SpecialVirtualServiceIngress(sqbdeployment *qav1alpha1.SQBDeployment) strin
 	if specialVirtualServiceIngress, ok := sqbdeployment.Annotations[entity.SpecialVirtualServiceIngress]; ok {
 		return specialVirtualServiceIngress
 	}
-	return entity.ConfigMapData.SpecialVirtualServiceIngress()
+	return entity.ConfigMapData.ForNamespace(sqbdeployment.Namespace).SpecialVirtualServiceIngress()
 }
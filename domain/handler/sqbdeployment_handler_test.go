@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"github.com/gogo/protobuf/proto"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+func TestResolveDeploySpec(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{
+		"defaultDeploySpec": `{"replicas": 1, "image": "default", "env": [{"name": "a", "value": "1"}]}`,
+	})
+	sqbapplication := &qav1alpha1.SQBApplication{
+		Spec: qav1alpha1.SQBApplicationSpec{
+			DeploySpec: qav1alpha1.DeploySpec{
+				Image:       "app",
+				HealthCheck: &corev1.Probe{InitialDelaySeconds: 30},
+				Volumes: []*qav1alpha1.VolumeSpec{
+					{MountPath: "/app", EmptyDir: true},
+				},
+			},
+		},
+	}
+	sqbdeployment := &qav1alpha1.SQBDeployment{
+		Spec: qav1alpha1.SQBDeploymentSpec{
+			DeploySpec: qav1alpha1.DeploySpec{
+				Replicas: proto.Int32(3),
+			},
+		},
+	}
+
+	deploy, err := ResolveDeploySpec(sqbapplication, sqbdeployment)
+	assert.NilError(t, err)
+	assert.Equal(t, *deploy.Replicas, int32(3))
+	assert.Equal(t, deploy.Image, "app")
+	assert.Equal(t, len(deploy.Env), 1)
+	assert.Equal(t, deploy.HealthCheck.InitialDelaySeconds, int32(30))
+	assert.Equal(t, deploy.Volumes[0].MountPath, "/app")
+
+	sqbdeployment.Spec.Image = "deploy"
+	deploy, err = ResolveDeploySpec(sqbapplication, sqbdeployment)
+	assert.NilError(t, err)
+	assert.Equal(t, deploy.Image, "deploy")
+	// 不修改sqbapplication的配置
+	assert.Equal(t, sqbapplication.Spec.Image, "app")
+
+	entity.ConfigMapData.FromMap(map[string]string{"defaultDeploySpec": "{"})
+	_, err = ResolveDeploySpec(sqbapplication, sqbdeployment)
+	assert.Assert(t, err != nil)
+	entity.ConfigMapData.FromMap(map[string]string{})
+}
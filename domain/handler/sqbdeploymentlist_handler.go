@@ -5,9 +5,12 @@ import (
 	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
 	"github.com/wosai/elastic-env-operator/domain/entity"
 	"github.com/wosai/elastic-env-operator/domain/util"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
 )
 
 type sqbDeploymentListHandler struct {
@@ -44,6 +47,72 @@ func (h *sqbDeploymentListHandler) CreateOrUpdateForSqbapplication() error {
 	return nil
 }
 
+// 从cloneFrom位面复制SQBDeployment，已经复制过或者同名SQBDeployment已存在的应用不再处理
+func (h *sqbDeploymentListHandler) CreateOrUpdateForSqbplane() error {
+	if h.sqbplane.Spec.CloneFrom == "" {
+		return nil
+	}
+	sources, err := h.listByLabel(map[string]string{entity.PlaneKey: h.sqbplane.Spec.CloneFrom})
+	if err != nil {
+		return err
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Name < sources[j].Name
+	})
+	options := h.sqbplane.Spec.CloneOptions
+	if options == nil {
+		options = &qav1alpha1.CloneOptions{}
+	}
+	for _, source := range sources {
+		app := source.Spec.Selector.App
+		if !source.DeletionTimestamp.IsZero() || util.ContainString(options.Exclude, app) ||
+			(len(options.Include) != 0 && !util.ContainString(options.Include, app)) {
+			continue
+		}
+		sqbdeployment := cloneSqbDeployment(&source, h.sqbplane)
+		if util.ContainString(h.sqbplane.Status.ClonedDeployments, sqbdeployment.Name) {
+			continue
+		}
+		err = k8sclient.Get(h.ctx, client.ObjectKeyFromObject(sqbdeployment), &qav1alpha1.SQBDeployment{})
+		if err == nil {
+			continue
+		}
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		if image, ok := options.ImageOverrides[app]; ok {
+			sqbdeployment.Spec.Image = image
+		}
+		if err = CreateOrUpdate(h.ctx, sqbdeployment); err != nil {
+			return err
+		}
+		h.sqbplane.Status.ClonedDeployments = append(h.sqbplane.Status.ClonedDeployments, sqbdeployment.Name)
+	}
+	return nil
+}
+
+// 复制SQBDeployment到另一个位面，不复制operator和kubevela维护的注解
+func cloneSqbDeployment(source *qav1alpha1.SQBDeployment, sqbplane *qav1alpha1.SQBPlane) *qav1alpha1.SQBDeployment {
+	app := source.Spec.Selector.App
+	sqbdeployment := &qav1alpha1.SQBDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   sqbplane.Namespace,
+			Name:        app + "-" + sqbplane.Name,
+			Labels:      util.MergeStringMap(source.Labels, map[string]string{entity.AppKey: app, entity.PlaneKey: sqbplane.Name}),
+			Annotations: util.MergeStringMap(source.Annotations, nil),
+		},
+		Spec: *source.Spec.DeepCopy(),
+	}
+	for _, key := range []string{entity.InitializeAnnotationKey, entity.IstioInjectAnnotationKey,
+		entity.ExplicitDeleteAnnotationKey, entity.KubevelaLastAppliedTime, corev1.LastAppliedConfigAnnotation} {
+		delete(sqbdeployment.Annotations, key)
+	}
+	// 复制出的SQBDeployment由operator管理，不属于kubevela应用
+	delete(sqbdeployment.Labels, entity.KubevelaAppNameLabel)
+	sqbdeployment.Spec.Selector.Plane = sqbplane.Name
+	return sqbdeployment
+}
+
 func (h *sqbDeploymentListHandler) DeleteForSqbapplication() error {
 	return h.deleteByLabel(map[string]string{entity.AppKey: h.sqbapplication.Name})
 }
@@ -76,7 +145,19 @@ func (h *sqbDeploymentListHandler) deleteByLabel(label map[string]string) error
 		return err
 	}
 	for _, sqbdeployment := range sqbdeployments {
-		sqbdeployment.Annotations[entity.ExplicitDeleteAnnotationKey] = util.GetDeleteCheckSum(sqbdeployment.Name)
+		checksum, err := util.GetDeleteCheckSum(sqbdeployment.Name)
+		if err != nil {
+			return err
+		}
+		if len(sqbdeployment.Annotations) == 0 {
+			sqbdeployment.Annotations = make(map[string]string)
+		}
+		sqbdeployment.Annotations[entity.ExplicitDeleteAnnotationKey] = checksum
+		// SQBApplication保留的子资源类型，SQBDeployment删除时同样保留
+		if h.sqbapplication != nil {
+			sqbdeployment.Spec.RetainResources = mergeRetainResources(sqbdeployment.Spec.RetainResources,
+				h.sqbapplication.Spec.RetainResources)
+		}
 		if err = CreateOrUpdate(h.ctx, &sqbdeployment); err != nil {
 			return err
 		}
@@ -95,6 +176,7 @@ func (h *sqbDeploymentListHandler) Handle() error {
 		if deleted, _ := IsDeleted(h.sqbplane); deleted {
 			return h.DeleteForSqbplane()
 		}
+		return h.CreateOrUpdateForSqbplane()
 	}
 	return nil
 }
@@ -117,3 +199,20 @@ func (h *sqbDeploymentListHandler) handleIstio(sqbdeployment *qav1alpha1.SQBDepl
 		*changed = true
 	}
 }
+
+func mergeRetainResources(base, toMerge []qav1alpha1.ResourceKind) []qav1alpha1.ResourceKind {
+	result := append([]qav1alpha1.ResourceKind{}, base...)
+	for _, kind := range toMerge {
+		exist := false
+		for _, r := range result {
+			if r == kind {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			result = append(result, kind)
+		}
+	}
+	return result
+}
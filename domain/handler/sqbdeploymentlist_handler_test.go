@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+)
+
+func newSourceSqbDeployment(app string) *qav1alpha1.SQBDeployment {
+	return &qav1alpha1.SQBDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        app + "-base",
+			Labels:      map[string]string{entity.AppKey: app, entity.PlaneKey: "base"},
+			Annotations: map[string]string{entity.InitializeAnnotationKey: "true", entity.PublicEntryAnnotationKey: "true"},
+		},
+		Spec: qav1alpha1.SQBDeploymentSpec{
+			Selector:   qav1alpha1.Selector{App: app, Plane: "base"},
+			DeploySpec: qav1alpha1.DeploySpec{Image: app + ":base"},
+		},
+	}
+}
+
+func TestCreateOrUpdateForSqbplane(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = qav1alpha1.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	SetK8sLog(ctrl.Log.WithName("test"))
+	ctx := context.Background()
+	SetK8sClient(fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newSourceSqbDeployment("a"), newSourceSqbDeployment("b"), newSourceSqbDeployment("c")).Build())
+
+	sqbplane := &qav1alpha1.SQBPlane{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "feature"},
+		Spec: qav1alpha1.SQBPlaneSpec{
+			CloneFrom: "base",
+			CloneOptions: &qav1alpha1.CloneOptions{
+				Exclude:        []string{"c"},
+				ImageOverrides: map[string]string{"a": "a:feature"},
+			},
+		},
+	}
+	h := NewSqbDeploymentListHandlerForSqbplane(sqbplane, ctx)
+	assert.NilError(t, h.Handle())
+	assert.DeepEqual(t, sqbplane.Status.ClonedDeployments, []string{"a-feature", "b-feature"})
+
+	cloned := &qav1alpha1.SQBDeployment{}
+	assert.NilError(t, k8sclient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "a-feature"}, cloned))
+	assert.Equal(t, cloned.Spec.Selector.Plane, "feature")
+	assert.Equal(t, cloned.Spec.Image, "a:feature")
+	assert.Equal(t, cloned.Labels[entity.PlaneKey], "feature")
+	assert.Equal(t, cloned.Annotations[entity.PublicEntryAnnotationKey], "true")
+	_, initialized := cloned.Annotations[entity.InitializeAnnotationKey]
+	assert.Equal(t, initialized, false)
+	assert.NilError(t, k8sclient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "b-feature"}, cloned))
+	assert.Equal(t, cloned.Spec.Image, "b:base")
+
+	// 删除后不会重新复制
+	assert.NilError(t, k8sclient.Delete(ctx, cloned))
+	assert.NilError(t, h.Handle())
+	assert.DeepEqual(t, sqbplane.Status.ClonedDeployments, []string{"a-feature", "b-feature"})
+	err := k8sclient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "b-feature"}, cloned)
+	assert.ErrorContains(t, err, "not found")
+}
@@ -3,12 +3,18 @@ package handler
 import (
 	"context"
 	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
 )
 
 type sqbPlaneHandler struct {
-	req ctrl.Request
-	ctx context.Context
+	req          ctrl.Request
+	ctx          context.Context
+	requeueAfter time.Duration
 }
 
 func NewSqbPlaneHanlder(req ctrl.Request, ctx context.Context) *sqbPlaneHandler {
@@ -33,29 +39,125 @@ func (h *sqbPlaneHandler) Operate(obj runtimeObj) error {
 	if err != nil {
 		return err
 	}
+	if done, err := handleFinalizer(h.ctx, in, deleted); done || err != nil {
+		return err
+	}
+	status := in.Status.DeepCopy()
+
+	if !deleted {
+		var expired bool
+		if expired, h.requeueAfter = checkPlaneExpired(in, time.Now()); expired {
+			// 过期后正常删除，由finalizer按deletionPolicy处理位面中的SQBDeployment
+			h.requeueAfter = 0
+			err = k8sclient.Delete(h.ctx, in)
+			log.Info("plane expired", "namespace", in.Namespace, "name", in.Name, "error", err)
+			return client.IgnoreNotFound(err)
+		}
+	}
 
 	handlers := []SQBHandler{
 		NewSqbDeploymentListHandlerForSqbplane(in, h.ctx),
 	}
 
-	for _, handler := range handlers {
-		if err = handler.Handle(); err != nil {
-			return err
-		}
+	if err = handleAll(handlers, &in.Status.Conditions, in.Generation); err != nil {
+		return err
 	}
 
 	if deleted {
-		return Delete(h.ctx, in)
-	} else if in.Status.ErrorInfo != "" {
-		in.Status.ErrorInfo = ""
+		return finishDeletion(h.ctx, in)
+	}
+	in.Status.ErrorInfo = ""
+	in.Status.ObservedGeneration = in.Generation
+	setCondition(&in.Status.Conditions, in.Generation, qav1alpha1.ConditionProgressing, metav1.ConditionFalse,
+		qav1alpha1.ReasonReconcileSucceeded, "")
+	setReconcileSucceeded(&in.Status.Conditions, in.Generation)
+	if !equality.Semantic.DeepEqual(status, &in.Status) {
 		return UpdateStatus(h.ctx, in)
 	}
 	return nil
 }
 
+func (h *sqbPlaneHandler) RequeueAfter() time.Duration {
+	return h.requeueAfter
+}
+
+// 判断位面是否过期，同时更新status的expireTime和idleSince，返回是否过期和距离下次检查的时间
+// base位面和deletionPolicy为Protect的位面不会过期
+func checkPlaneExpired(in *qav1alpha1.SQBPlane, now time.Time) (bool, time.Duration) {
+	in.Status.ExpireTime = nil
+	if in.Name == entity.ConfigMapData.ForNamespace(in.Namespace).BaseFlag() || getDeletionPolicy(in) == qav1alpha1.DeletionPolicyProtect {
+		in.Status.IdleSince = nil
+		return false, 0
+	}
+
+	// ttl从创建或者最近一次续期开始计算
+	start := in.CreationTimestamp.Time
+	if renew, err := time.Parse(time.RFC3339, in.Annotations[entity.LeaseRenewAnnotationKey]); err == nil && renew.After(start) {
+		start = renew
+	}
+	if in.Spec.TTL != nil {
+		expireTime := metav1.NewTime(start.Add(in.Spec.TTL.Duration))
+		in.Status.ExpireTime = &expireTime
+	}
+	if in.Spec.ExpireAt != nil && (in.Status.ExpireTime == nil || in.Spec.ExpireAt.Before(in.Status.ExpireTime)) {
+		in.Status.ExpireTime = in.Spec.ExpireAt.DeepCopy()
+	}
+
+	var requeueAfter time.Duration
+	// 到期返回true，未到期记录最近的检查时间
+	reached := func(t time.Time) bool {
+		if !now.Before(t) {
+			return true
+		}
+		if d := t.Sub(now); requeueAfter == 0 || d < requeueAfter {
+			requeueAfter = d
+		}
+		return false
+	}
+	if in.Status.ExpireTime != nil && reached(in.Status.ExpireTime.Time) {
+		return true, 0
+	}
+
+	if in.Spec.IdleTimeout == nil {
+		in.Status.IdleSince = nil
+		return false, requeueAfter
+	}
+	idle := true
+	for _, readyReplicas := range in.Status.Mirrors {
+		if readyReplicas > 0 {
+			idle = false
+			break
+		}
+	}
+	if !idle {
+		// mirrors变化时会重新处理位面，定期检查作为兜底
+		in.Status.IdleSince = nil
+		reached(now.Add(in.Spec.IdleTimeout.Duration))
+		return false, requeueAfter
+	}
+	if in.Status.IdleSince == nil {
+		idleSince := metav1.NewTime(now).Rfc3339Copy()
+		in.Status.IdleSince = &idleSince
+	}
+	// 续期同样重新计算空闲时间。新建的位面拉取镜像时还没有ready副本，创建idleTimeout之后才开始计算
+	idleStart := in.Status.IdleSince.Time
+	if grace := in.CreationTimestamp.Add(in.Spec.IdleTimeout.Duration); grace.After(idleStart) {
+		idleStart = grace
+	}
+	if start.After(idleStart) {
+		idleStart = start
+	}
+	if reached(idleStart.Add(in.Spec.IdleTimeout.Duration)) {
+		return true, 0
+	}
+	return false, requeueAfter
+}
+
 // 处理失败后逻辑
 func (h *sqbPlaneHandler) ReconcileFail(obj runtimeObj, err error) {
 	in := obj.(*qav1alpha1.SQBPlane)
 	in.Status.ErrorInfo = err.Error()
+	in.Status.ObservedGeneration = in.Generation
+	setReconcileFailed(&in.Status.Conditions, in.Generation, err)
 	_ = UpdateStatus(h.ctx, in)
 }
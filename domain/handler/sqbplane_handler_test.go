@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"gotest.tools/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+	"time"
+)
+
+func TestCheckPlaneExpired(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{"baseFlag": "base"})
+	now := time.Now()
+	created := metav1.NewTime(now.Add(-2 * time.Hour))
+	in := &qav1alpha1.SQBPlane{ObjectMeta: metav1.ObjectMeta{Name: "feature", CreationTimestamp: created}}
+
+	// 没有配置ttl不会过期
+	expired, requeueAfter := checkPlaneExpired(in, now)
+	assert.Equal(t, expired, false)
+	assert.Equal(t, requeueAfter, time.Duration(0))
+	assert.Assert(t, in.Status.ExpireTime == nil)
+
+	in.Spec.TTL = &metav1.Duration{Duration: 3 * time.Hour}
+	expired, requeueAfter = checkPlaneExpired(in, now)
+	assert.Equal(t, expired, false)
+	assert.Equal(t, requeueAfter, time.Hour)
+	assert.Equal(t, in.Status.ExpireTime.Time, created.Add(3*time.Hour))
+
+	// expireAt早于ttl
+	expireAt := metav1.NewTime(now.Add(-time.Minute))
+	in.Spec.ExpireAt = &expireAt
+	expired, _ = checkPlaneExpired(in, now)
+	assert.Equal(t, expired, true)
+
+	// 续期不影响expireAt，只影响ttl
+	in.Spec.ExpireAt = nil
+	in.Spec.TTL = &metav1.Duration{Duration: time.Hour}
+	expired, _ = checkPlaneExpired(in, now)
+	assert.Equal(t, expired, true)
+	in.Annotations = map[string]string{entity.LeaseRenewAnnotationKey: now.Add(-30 * time.Minute).Format(time.RFC3339)}
+	expired, _ = checkPlaneExpired(in, now)
+	assert.Equal(t, expired, false)
+
+	// base位面不会过期
+	base := in.DeepCopy()
+	base.Name = "base"
+	base.Annotations = nil
+	expired, _ = checkPlaneExpired(base, now)
+	assert.Equal(t, expired, false)
+	assert.Assert(t, base.Status.ExpireTime == nil)
+}
+
+func TestCheckPlaneIdle(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{"baseFlag": "base"})
+	now := time.Now()
+	in := &qav1alpha1.SQBPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "feature", CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour))},
+		Spec:       qav1alpha1.SQBPlaneSpec{IdleTimeout: &metav1.Duration{Duration: time.Hour}},
+		Status:     qav1alpha1.SQBPlaneStatus{Mirrors: map[string]int{"app-feature": 1}},
+	}
+
+	expired, requeueAfter := checkPlaneExpired(in, now)
+	assert.Equal(t, expired, false)
+	assert.Equal(t, requeueAfter, time.Hour)
+	assert.Assert(t, in.Status.IdleSince == nil)
+
+	// 开始空闲
+	in.Status.Mirrors["app-feature"] = 0
+	expired, _ = checkPlaneExpired(in, now)
+	assert.Equal(t, expired, false)
+	assert.Assert(t, in.Status.IdleSince != nil)
+
+	expired, _ = checkPlaneExpired(in, now.Add(time.Hour+time.Second))
+	assert.Equal(t, expired, true)
+
+	// 恢复后清除idleSince
+	in.Status.Mirrors["app-feature"] = 1
+	expired, _ = checkPlaneExpired(in, now)
+	assert.Equal(t, expired, false)
+	assert.Assert(t, in.Status.IdleSince == nil)
+
+	// 新建的位面还没有ready副本，创建idleTimeout之后才开始计算空闲时间
+	created := &qav1alpha1.SQBPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "feature", CreationTimestamp: metav1.NewTime(now)},
+		Spec:       qav1alpha1.SQBPlaneSpec{IdleTimeout: &metav1.Duration{Duration: time.Hour}},
+	}
+	expired, requeueAfter = checkPlaneExpired(created, now)
+	assert.Equal(t, expired, false)
+	assert.Equal(t, requeueAfter, 2*time.Hour)
+	expired, _ = checkPlaneExpired(created, now.Add(time.Hour+time.Second))
+	assert.Equal(t, expired, false)
+	expired, _ = checkPlaneExpired(created, now.Add(2*time.Hour))
+	assert.Equal(t, expired, true)
+}
+
+func TestSqbPlaneExpiredOrphan(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{"baseFlag": "base"})
+	scheme := runtime.NewScheme()
+	_ = qav1alpha1.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	SetK8sLog(ctrl.Log.WithName("test"))
+	ctx := context.Background()
+	in := &qav1alpha1.SQBPlane{ObjectMeta: metav1.ObjectMeta{Name: "feature", Namespace: "default",
+		CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Hour)), Finalizers: []string{entity.FINALIZER}}}
+	in.Spec.TTL = &metav1.Duration{Duration: time.Hour}
+	in.Spec.DeletionPolicy = qav1alpha1.DeletionPolicyOrphan
+	SetK8sClient(fake.NewClientBuilder().WithScheme(scheme).WithObjects(in).Build())
+
+	// 过期后正常删除，不使用明确删除的注解，由finalizer按deletionPolicy处理
+	h := NewSqbPlaneHanlder(ctrl.Request{NamespacedName: client.ObjectKeyFromObject(in)}, ctx)
+	_ = k8sclient.Get(ctx, client.ObjectKeyFromObject(in), in)
+	assert.NilError(t, h.Operate(in))
+	assert.Equal(t, h.RequeueAfter(), time.Duration(0))
+	_, ok := in.Annotations[entity.ExplicitDeleteAnnotationKey]
+	assert.Equal(t, ok, false)
+	current := &qav1alpha1.SQBPlane{}
+	err := k8sclient.Get(ctx, client.ObjectKeyFromObject(in), current)
+	assert.Assert(t, apierrors.IsNotFound(err) || !current.DeletionTimestamp.IsZero())
+	if err == nil {
+		deleted, err := IsDeleted(current)
+		assert.NilError(t, err)
+		assert.Equal(t, deleted, false)
+	}
+}
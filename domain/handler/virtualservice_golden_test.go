@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"flag"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"gotest.tools/assert"
+	"io/ioutil"
+	istio "istio.io/client-go/pkg/apis/networking/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"path/filepath"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+	"testing"
+)
+
+// go test ./domain/handler -run TestVirtualServiceGolden -update 重新生成testdata/virtualservice下的文件
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func TestVirtualServiceGolden(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{"istioEnable": "true", "istioInject": "true",
+		"istioRoutingEnable": "true", "istioGateways": `["istio-system/ingressgateway","mesh"]`})
+	defer entity.ConfigMapData.FromMap(map[string]string{})
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = qav1alpha1.AddToScheme(scheme)
+	_ = istio.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	SetK8sLog(ctrl.Log.WithName("test"))
+
+	httpPorts := []corev1.ServicePort{{Name: "http-80", Port: 80}}
+	cases := []struct {
+		name     string
+		planes   []string
+		subpaths []qav1alpha1.Subpath
+		ports    []corev1.ServicePort
+		// 灰度发布中的位面的权重
+		canary map[string]int32
+		// SQBApplication的planeRouting
+		routing *qav1alpha1.PlaneRoutingSpec
+	}{
+		{
+			name:   "multi-plane",
+			planes: []string{"feature-c", "base", "feature-a", "feature-b"},
+			ports:  httpPorts,
+		},
+		{
+			// 重叠的subpath前缀长的在前
+			name:   "multi-subpath",
+			planes: []string{"feature-b", "base", "feature-a"},
+			subpaths: []qav1alpha1.Subpath{
+				{Path: "/api", ServiceName: "app-api"},
+				{Path: "/api/v2/orders", ServiceName: "app-orders"},
+				{Path: "/admin", ServiceName: "app-admin"},
+				{Path: "/api/v2", ServiceName: "app-api-v2"},
+			},
+			ports: httpPorts,
+		},
+		{
+			name:   "no-base",
+			planes: []string{"feature-b", "feature-a"},
+			subpaths: []qav1alpha1.Subpath{
+				{Path: "/api", ServiceName: "app-api"},
+			},
+			ports: httpPorts,
+		},
+		{
+			name:   "canary",
+			planes: []string{"feature-b", "base", "feature-a"},
+			subpaths: []qav1alpha1.Subpath{
+				{Path: "/api", ServiceName: "app-api"},
+			},
+			ports:  httpPorts,
+			canary: map[string]int32{"feature-a": 20, "feature-b": 10},
+		},
+		{
+			// 按链路追踪header、cookie和JWT claim匹配，tcp没有sourceLabel时只保留基础环境
+			name:   "custom-routing",
+			planes: []string{"feature-a", "base"},
+			subpaths: []qav1alpha1.Subpath{
+				{Path: "/api", ServiceName: "app-api"},
+			},
+			ports:  []corev1.ServicePort{{Name: "http-80", Port: 80}, {Name: "mysql-3306", Port: 3306}},
+			canary: map[string]int32{"feature-a": 10},
+			routing: &qav1alpha1.PlaneRoutingSpec{
+				Matches: []qav1alpha1.PlaneRouteMatch{
+					{Type: qav1alpha1.PlaneRouteMatchHeader, Key: "X-Trace-Env"},
+					{Type: qav1alpha1.PlaneRouteMatchCookie, Key: "env"},
+					{Type: qav1alpha1.PlaneRouteMatchJWTClaim, Key: "env"},
+				},
+				PropagateHeaders: []string{"X-Trace-Env"},
+			},
+		},
+		{
+			name:   "tcp",
+			planes: []string{"feature-b", "base", "feature-a"},
+			ports:  []corev1.ServicePort{{Name: "http-80", Port: 80}, {Name: "mysql-3306", Port: 3306}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			objs := make([]client.Object, 0)
+			for _, plane := range c.planes {
+				sqbdeployment := &qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-" + plane,
+					Namespace: "default", Labels: map[string]string{entity.AppKey: "app", entity.PlaneKey: plane}}}
+				if weight, ok := c.canary[plane]; ok {
+					sqbdeployment.Spec.Canary = &qav1alpha1.CanarySpec{Steps: []qav1alpha1.CanaryStep{{Weight: weight}}}
+					sqbdeployment.Status.Canary = &qav1alpha1.CanaryStatus{Weight: weight}
+				}
+				objs = append(objs, sqbdeployment)
+			}
+			SetK8sClient(&applyClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()})
+			ctx := context.Background()
+			sqbapplication := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+			sqbapplication.Spec.Domains = []qav1alpha1.Domain{{Class: "nginx", Host: "app.example.com"}}
+			sqbapplication.Spec.Subpaths = c.subpaths
+			sqbapplication.Spec.Ports = c.ports
+			sqbapplication.Spec.PlaneRouting = c.routing
+
+			assert.NilError(t, NewVirtualServiceHandler(sqbapplication, ctx).Handle())
+			virtualservice := &istio.VirtualService{}
+			assert.NilError(t, k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbapplication), virtualservice))
+			got, err := yaml.Marshal(&virtualservice.Spec)
+			assert.NilError(t, err)
+
+			// 重复处理时route的顺序不变
+			assert.NilError(t, NewVirtualServiceHandler(sqbapplication, ctx).CreateOrUpdate())
+			again := &istio.VirtualService{}
+			assert.NilError(t, k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbapplication), again))
+			gotAgain, err := yaml.Marshal(&again.Spec)
+			assert.NilError(t, err)
+			assert.Equal(t, string(gotAgain), string(got))
+
+			golden := filepath.Join("testdata", "virtualservice", c.name+".yaml")
+			if *updateGolden {
+				assert.NilError(t, ioutil.WriteFile(golden, got, 0644))
+			}
+			want, err := ioutil.ReadFile(golden)
+			assert.NilError(t, err)
+			assert.Equal(t, string(got), string(want))
+		})
+	}
+}
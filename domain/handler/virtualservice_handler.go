@@ -12,6 +12,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
 	"strings"
 )
 
@@ -25,44 +26,59 @@ func NewVirtualServiceHandler(sqbapplication *qav1alpha1.SQBApplication, ctx con
 }
 
 func (h *virtualServiceHandler) CreateOrUpdate() error {
-	virtualservice := &istio.VirtualService{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
-	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: virtualservice.Namespace, Name: virtualservice.Name}, virtualservice)
+	// 集群中的virtualservice只用于读取基础环境的route，基础环境的route允许手动修改
+	live := &istio.VirtualService{}
+	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}, live)
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
+	virtualservice := &istio.VirtualService{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
 	virtualserviceHosts := getIngressHosts(h.sqbapplication)
 	virtualserviceHosts = append(virtualserviceHosts, h.sqbapplication.Name)
-	gateways := entity.ConfigMapData.IstioGateways()
+	gateways := entity.ConfigMapData.ForNamespace(h.sqbapplication.Namespace).IstioGateways()
 	virtualservice.Spec.Hosts = virtualserviceHosts
 	virtualservice.Spec.Gateways = gateways
-	virtualservice.Spec.Http = h.getOrGenerateHttpRoutes(virtualservice.Spec.Http)
+	planes, err := getPlanes(h.ctx, h.sqbapplication)
+	if err != nil {
+		return err
+	}
+	weights, err := getCanaryWeights(h.ctx, h.sqbapplication)
+	if err != nil {
+		return err
+	}
+	routing, err := resolvePlaneRouting(h.sqbapplication)
+	if err != nil {
+		return err
+	}
+	virtualservice.Spec.Http = h.getOrGenerateHttpRoutes(routing, planes, weights, live.Spec.Http)
 	// 处理tcp route
 	for _, port := range h.sqbapplication.Spec.Ports {
 		if util.ContainString([]string{"tcp", "mongo", "mysql", "redis"}, strings.ToLower(strings.Split(port.Name, "-")[0])) {
-			virtualservice.Spec.Tcp = h.getOrGenerateTcpRoutes(virtualservice.Spec.Tcp)
+			virtualservice.Spec.Tcp = h.getOrGenerateTcpRoutes(routing, planes, live.Spec.Tcp)
 			break
-		} else {
-			virtualservice.Spec.Tcp = nil
 		}
 	}
 	if anno, ok := h.sqbapplication.Annotations[entity.VirtualServiceAnnotationKey]; ok {
 		_ = json.Unmarshal([]byte(anno), &virtualservice.Annotations)
-	} else {
-		virtualservice.Annotations = nil
 	}
-	virtualservice.Labels = h.sqbapplication.Labels
-	return CreateOrUpdate(h.ctx, virtualservice)
+	virtualservice.Labels = util.MergeStringMap(nil, h.sqbapplication.Labels)
+	return Apply(h.ctx, virtualservice)
 }
 
 func (h *virtualServiceHandler) Delete() error {
 	virtualservice := &istio.VirtualService{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
-	return Delete(h.ctx, virtualservice)
+	return deleteOrRetain(h.ctx, virtualservice, h.sqbapplication)
 }
 
 func (h *virtualServiceHandler) Handle() error {
-	if !entity.ConfigMapData.IstioEnable() {
+	config := entity.ConfigMapData.ForNamespace(h.sqbapplication.Namespace)
+	// 没有安装istio时不处理，关闭istioRoutingEnable后删除之前生成的virtualservice
+	if !config.IstioEnable() {
 		return nil
 	}
+	if !config.IstioRoutingEnable() {
+		return h.Delete()
+	}
 	if deleted, _ := IsDeleted(h.sqbapplication); deleted {
 		return h.Delete()
 	}
@@ -72,59 +88,94 @@ func (h *virtualServiceHandler) Handle() error {
 	return h.Delete()
 }
 
-func (h *virtualServiceHandler) getOrGenerateHttpRoutes(httpRoutes []*istioapi.HTTPRoute) []*istioapi.HTTPRoute {
-	resultHttpRoutes := make([]*istioapi.HTTPRoute, 0)
-	subpaths := h.sqbapplication.Spec.Subpaths
-	planes := h.sqbapplication.Status.Planes
-	baseFlag := entity.ConfigMapData.BaseFlag()
-	// 特殊处理base,base需要放在最后
-	_, ok := planes[baseFlag]
-	if ok {
-		delete(planes, baseFlag)
+func (h *virtualServiceHandler) ConditionType() string {
+	return qav1alpha1.ConditionVirtualServiceReady
+}
+
+// splitBasePlane 区分特性环境和基础环境，基础环境的route需要放在最后，特性环境按名称排序
+func splitBasePlane(planes []string, baseFlag string) ([]string, bool) {
+	featurePlanes := make([]string, 0, len(planes))
+	hasBase := false
+	for _, plane := range planes {
+		if plane == baseFlag {
+			hasBase = true
+		} else {
+			featurePlanes = append(featurePlanes, plane)
+		}
 	}
+	sort.Strings(featurePlanes)
+	return featurePlanes, hasBase
+}
+
+// sortSubpaths 前缀长的path更具体，需要先匹配；长度相同时按path和serviceName排序保证顺序稳定
+func sortSubpaths(subpaths []qav1alpha1.Subpath) []qav1alpha1.Subpath {
+	sorted := append([]qav1alpha1.Subpath(nil), subpaths...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if len(sorted[i].Path) != len(sorted[j].Path) {
+			return len(sorted[i].Path) > len(sorted[j].Path)
+		}
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].ServiceName < sorted[j].ServiceName
+	})
+	return sorted
+}
+
+// weights为灰度发布中的位面的权重，作用于基础环境的所有route，包括subpath
+func (h *virtualServiceHandler) getOrGenerateHttpRoutes(routing *qav1alpha1.PlaneRoutingSpec, planes []string, weights map[string]int32,
+	httpRoutes []*istioapi.HTTPRoute) []*istioapi.HTTPRoute {
+	resultHttpRoutes := make([]*istioapi.HTTPRoute, 0)
+	subpaths := sortSubpaths(h.sqbapplication.Spec.Subpaths)
+	config := entity.ConfigMapData.ForNamespace(h.sqbapplication.Namespace)
+	baseFlag := config.BaseFlag()
+	featurePlanes, hasBase := splitBasePlane(planes, baseFlag)
 	// plane+subpath决定一条route,path有顺序要求
 	// 处理特性环境
-	for plane := range planes {
+	for _, plane := range featurePlanes {
 		// 处理subpath
 		for _, subpath := range subpaths {
 			// 生成httproute
-			httpRoute := generatePlaneHttpRoute(subpath.ServiceName, plane, subpath.Path)
+			httpRoute := generatePlaneHttpRoute(config, routing, subpath.ServiceName, plane, subpath.Path)
 			resultHttpRoutes = append(resultHttpRoutes, httpRoute)
 		}
 		// 处理默认路径
-		httpRoute := generatePlaneHttpRoute(h.sqbapplication.Name, plane, "/")
+		httpRoute := generatePlaneHttpRoute(config, routing, h.sqbapplication.Name, plane, "/")
 		resultHttpRoutes = append(resultHttpRoutes, httpRoute)
 	}
 	// 处理基础环境
-	if ok {
-		planes[baseFlag] = 1
+	if hasBase {
 		for _, subpath := range subpaths {
-			httpRoute := generateBaseHttpRoute(subpath.ServiceName, subpath.Path)
+			httpRoute := generateBaseHttpRoute(config, subpath.ServiceName, subpath.Path)
+			setCanaryDestinations(httpRoute, subpath.ServiceName, weights, routing)
 			resultHttpRoutes = append(resultHttpRoutes, httpRoute)
 		}
 
+		var httpRoute *istioapi.HTTPRoute
 		found, route := findRoute(HTTPRoutes(httpRoutes), h.sqbapplication.Name, baseFlag)
 		if found {
-			httpRoute := istioapi.HTTPRoute(route.(HTTPRoute))
-			resultHttpRoutes = append(resultHttpRoutes, &httpRoute)
+			liveRoute := istioapi.HTTPRoute(route.(HTTPRoute))
+			httpRoute = &liveRoute
 		} else {
-			httpRoute := generateBaseHttpRoute(h.sqbapplication.Name, "/")
-			resultHttpRoutes = append(resultHttpRoutes, httpRoute)
+			httpRoute = generateBaseHttpRoute(config, h.sqbapplication.Name, "/")
 		}
+		setCanaryDestinations(httpRoute, h.sqbapplication.Name, weights, routing)
+		resultHttpRoutes = append(resultHttpRoutes, httpRoute)
 	}
 	return resultHttpRoutes
 }
 
-func (h *virtualServiceHandler) getOrGenerateTcpRoutes(tcpRoutes []*istioapi.TCPRoute) []*istioapi.TCPRoute {
+// 没有配置sourceLabel的匹配方式时，特性环境不生成tcp route，否则会匹配所有流量
+func (h *virtualServiceHandler) getOrGenerateTcpRoutes(routing *qav1alpha1.PlaneRoutingSpec, planes []string, tcpRoutes []*istioapi.TCPRoute) []*istioapi.TCPRoute {
 	resultTcpRoutes := make([]*istioapi.TCPRoute, 0)
-	planes := h.sqbapplication.Status.Planes
-	baseFlag := entity.ConfigMapData.BaseFlag()
-	_, ok := planes[baseFlag]
-	if ok {
-		delete(planes, baseFlag)
-	}
+	baseFlag := entity.ConfigMapData.ForNamespace(h.sqbapplication.Namespace).BaseFlag()
+	featurePlanes, hasBase := splitBasePlane(planes, baseFlag)
 	// 处理特性环境
-	for plane := range planes {
+	for _, plane := range featurePlanes {
+		matches := planeTcpMatches(routing, plane)
+		if len(matches) == 0 {
+			break
+		}
 		// 生成tcproute
 		tcpRoute := &istioapi.TCPRoute{
 			Route: []*istioapi.RouteDestination{
@@ -133,17 +184,12 @@ func (h *virtualServiceHandler) getOrGenerateTcpRoutes(tcpRoutes []*istioapi.TCP
 					Subset: util.GetSubsetName(h.sqbapplication.Name, plane),
 				}},
 			},
-			Match: []*istioapi.L4MatchAttributes{
-				{SourceLabels: map[string]string{
-					entity.PlaneKey: plane,
-				}},
-			},
+			Match: matches,
 		}
 		resultTcpRoutes = append(resultTcpRoutes, tcpRoute)
 	}
 	// 处理基础环境
-	if ok {
-		planes[baseFlag] = 1
+	if hasBase {
 		found, route := findRoute(TCPRoutes(tcpRoutes), h.sqbapplication.Name, baseFlag)
 		if found {
 			tcpRoute := istioapi.TCPRoute(route.(TCPRoute))
@@ -163,7 +209,7 @@ func (h *virtualServiceHandler) getOrGenerateTcpRoutes(tcpRoutes []*istioapi.TCP
 	return resultTcpRoutes
 }
 
-func generatePlaneHttpRoute(host, plane, path string) *istioapi.HTTPRoute {
+func generatePlaneHttpRoute(config *entity.SQBConfigMapEntity, routing *qav1alpha1.PlaneRoutingSpec, host, plane, path string) *istioapi.HTTPRoute {
 	httpRoute := &istioapi.HTTPRoute{
 		Route: []*istioapi.HTTPRouteDestination{
 			{Destination: &istioapi.Destination{
@@ -171,40 +217,15 @@ func generatePlaneHttpRoute(host, plane, path string) *istioapi.HTTPRoute {
 				Subset: util.GetSubsetName(host, plane),
 			}},
 		},
-		Timeout: &types2.Duration{Seconds: entity.ConfigMapData.IstioTimeout()},
-	}
-	prefixMatch := &istioapi.StringMatch{
-		MatchType: &istioapi.StringMatch_Prefix{Prefix: path},
-	}
-	exactMatch := &istioapi.StringMatch{
-		MatchType: &istioapi.StringMatch_Exact{Exact: plane},
-	}
-	headerMatchRequest := &istioapi.HTTPMatchRequest{}
-	queryparamsMatchRequest := &istioapi.HTTPMatchRequest{}
-	sourcelabelsMatchRequest := &istioapi.HTTPMatchRequest{}
-
-	headerMatchRequest.Headers = map[string]*istioapi.StringMatch{
-		entity.XEnvFlag: exactMatch,
-	}
-	queryparamsMatchRequest.QueryParams = map[string]*istioapi.StringMatch{
-		entity.XEnvFlag: exactMatch,
-	}
-	sourcelabelsMatchRequest.SourceLabels = map[string]string{entity.PlaneKey: plane}
-
-	if path != "/" {
-		headerMatchRequest.Uri = prefixMatch
-		queryparamsMatchRequest.Uri = prefixMatch
-		sourcelabelsMatchRequest.Uri = prefixMatch
-	}
-	httpRoute.Match = []*istioapi.HTTPMatchRequest{headerMatchRequest, queryparamsMatchRequest, sourcelabelsMatchRequest}
-	httpRoute.Headers = &istioapi.Headers{
-		Request: &istioapi.Headers_HeaderOperations{Set: map[string]string{entity.XEnvFlag: plane}},
+		Timeout: &types2.Duration{Seconds: config.IstioTimeout()},
 	}
+	httpRoute.Match = planeHttpMatches(routing, plane, path)
+	httpRoute.Headers = planeRequestHeaders(routing, plane)
 	return httpRoute
 }
 
-func generateBaseHttpRoute(host, path string) *istioapi.HTTPRoute {
-	plane := entity.ConfigMapData.BaseFlag()
+func generateBaseHttpRoute(config *entity.SQBConfigMapEntity, host, path string) *istioapi.HTTPRoute {
+	plane := config.BaseFlag()
 	httpRoute := &istioapi.HTTPRoute{
 		Route: []*istioapi.HTTPRouteDestination{
 			{Destination: &istioapi.Destination{
@@ -212,7 +233,7 @@ func generateBaseHttpRoute(host, path string) *istioapi.HTTPRoute {
 				Subset: util.GetSubsetName(host, plane),
 			}},
 		},
-		Timeout: &types2.Duration{Seconds: entity.ConfigMapData.IstioTimeout()},
+		Timeout: &types2.Duration{Seconds: config.IstioTimeout()},
 	}
 	if path != "/" {
 		httpRoute.Match = []*istioapi.HTTPMatchRequest{
@@ -1,9 +1,19 @@
 package handler
 
 import (
+	"context"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
 	"github.com/wosai/elastic-env-operator/domain/entity"
 	"github.com/wosai/elastic-env-operator/domain/util"
 	"gotest.tools/assert"
+	istio "istio.io/client-go/pkg/apis/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"testing"
 )
 
@@ -11,7 +21,7 @@ func TestGeneratePlaneHttpRoute(t *testing.T) {
 	host := "host1"
 	plane := "plane1"
 	path := "/v1"
-	route := generatePlaneHttpRoute(host, plane, path)
+	route := generatePlaneHttpRoute(entity.ConfigMapData, defaultPlaneRouting(), host, plane, path)
 	assert.Equal(t, len(route.Route), 1)
 	assert.Equal(t, route.Route[0].Destination.Host, "host1")
 	assert.Equal(t, route.Route[0].Destination.Subset, util.GetSubsetName(host, plane))
@@ -26,7 +36,7 @@ func TestGeneratePlaneHttpRoute(t *testing.T) {
 	host = "host1"
 	plane = "plane1"
 	path = "/"
-	route = generatePlaneHttpRoute(host, plane, path)
+	route = generatePlaneHttpRoute(entity.ConfigMapData, defaultPlaneRouting(), host, plane, path)
 	assert.Equal(t, len(route.Route), 1)
 	assert.Equal(t, route.Route[0].Destination.Host, host)
 	assert.Equal(t, route.Route[0].Destination.Subset, util.GetSubsetName(host, plane))
@@ -42,7 +52,7 @@ func TestGeneratePlaneHttpRoute(t *testing.T) {
 func TestGenerateBaseHttpRoute(t *testing.T) {
 	host := "host1"
 	path := "/v1"
-	route := generateBaseHttpRoute(host, path)
+	route := generateBaseHttpRoute(entity.ConfigMapData, host, path)
 	assert.Equal(t, len(route.Route), 1)
 	assert.Equal(t, route.Route[0].Destination.Host, host)
 	assert.Equal(t, route.Route[0].Destination.Subset, util.GetSubsetName(host, "base"))
@@ -54,9 +64,92 @@ func TestGenerateBaseHttpRoute(t *testing.T) {
 
 	host = "host1"
 	path = "/"
-	route = generateBaseHttpRoute(host, path)
+	route = generateBaseHttpRoute(entity.ConfigMapData, host, path)
 	assert.Equal(t, len(route.Route), 1)
 	assert.Equal(t, route.Route[0].Destination.Host, host)
 	assert.Equal(t, route.Route[0].Destination.Subset, util.GetSubsetName(host, "base"))
 	assert.Equal(t, len(route.Match), 0)
 }
+
+func TestIstioRouting(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{"istioEnable": "true", "istioInject": "true"})
+	defer entity.ConfigMapData.FromMap(map[string]string{})
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = qav1alpha1.AddToScheme(scheme)
+	_ = istio.AddToScheme(scheme)
+	SetK8sScheme(scheme)
+	SetK8sLog(ctrl.Log.WithName("test"))
+	sqbdeployment := func(plane string) *qav1alpha1.SQBDeployment {
+		return &qav1alpha1.SQBDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app-" + plane, Namespace: "default",
+			Labels: map[string]string{entity.AppKey: "app", entity.PlaneKey: plane}}}
+	}
+	deleting := sqbdeployment("deleting")
+	deleting.Annotations = map[string]string{entity.ExplicitDeleteAnnotationKey: ""}
+	entity.SecretData.FromMap(map[string][]byte{"salt": []byte("salt")})
+	deleting.Annotations[entity.ExplicitDeleteAnnotationKey], _ = util.GetDeleteCheckSum(deleting.Name)
+	SetK8sClient(&applyClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		sqbdeployment("feature-b"), sqbdeployment("base"), sqbdeployment("feature-a"), deleting).Build()})
+	ctx := context.Background()
+	sqbapplication := &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	sqbapplication.Status.Planes = map[string]int{"base": 1, "feature-a": 1}
+
+	planes, err := getPlanes(ctx, sqbapplication)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, planes, []string{"base", "feature-a", "feature-b"})
+
+	// 未开启istioRoutingEnable时不生成
+	assert.NilError(t, NewVirtualServiceHandler(sqbapplication, ctx).Handle())
+	err = k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbapplication), &istio.VirtualService{})
+	assert.Assert(t, err != nil)
+
+	entity.ConfigMapData.FromMap(map[string]string{"istioEnable": "true", "istioInject": "true", "istioRoutingEnable": "true"})
+	assert.NilError(t, NewVirtualServiceHandler(sqbapplication, ctx).Handle())
+	assert.NilError(t, NewDestinationRuleHandler(sqbapplication, ctx).Handle())
+	// 基础环境放在最后，status中的位面不被修改
+	virtualservice := &istio.VirtualService{}
+	assert.NilError(t, k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbapplication), virtualservice))
+	subsets := make([]string, 0)
+	for _, route := range virtualservice.Spec.Http {
+		subsets = append(subsets, route.Route[0].Destination.Subset)
+	}
+	assert.DeepEqual(t, subsets, []string{util.GetSubsetName("app", "feature-a"),
+		util.GetSubsetName("app", "feature-b"), util.GetSubsetName("app", "base")})
+	assert.DeepEqual(t, sqbapplication.Status.Planes, map[string]int{"base": 1, "feature-a": 1})
+	destinationrule := &istio.DestinationRule{}
+	assert.NilError(t, k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbapplication), destinationrule))
+	assert.Equal(t, len(destinationrule.Spec.Subsets), 3)
+	assert.Equal(t, destinationrule.Spec.Subsets[0].Labels[entity.PlaneKey], "base")
+
+	// 关闭istioRoutingEnable后删除
+	entity.ConfigMapData.FromMap(map[string]string{"istioEnable": "true", "istioInject": "true"})
+	assert.NilError(t, NewVirtualServiceHandler(sqbapplication, ctx).Handle())
+	assert.NilError(t, NewDestinationRuleHandler(sqbapplication, ctx).Handle())
+	err = k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbapplication), &istio.VirtualService{})
+	assert.Equal(t, apierrors.IsNotFound(err), true)
+	err = k8sclient.Get(ctx, client.ObjectKeyFromObject(sqbapplication), &istio.DestinationRule{})
+	assert.Equal(t, apierrors.IsNotFound(err), true)
+}
+
+func TestGetOrGenerateRoutesOrder(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{})
+	h := &virtualServiceHandler{sqbapplication: &qav1alpha1.SQBApplication{ObjectMeta: metav1.ObjectMeta{Name: "app"}}}
+	h.sqbapplication.Spec.Subpaths = []qav1alpha1.Subpath{{Path: "/a", ServiceName: "a"}, {Path: "/a/b", ServiceName: "ab"}}
+	routes := h.getOrGenerateHttpRoutes(defaultPlaneRouting(), []string{"feature-b", "base", "feature-a"}, nil, nil)
+	subsets := make([]string, 0)
+	for _, route := range routes {
+		subsets = append(subsets, route.Route[0].Destination.Subset)
+	}
+	assert.DeepEqual(t, subsets, []string{
+		util.GetSubsetName("ab", "feature-a"), util.GetSubsetName("a", "feature-a"), util.GetSubsetName("app", "feature-a"),
+		util.GetSubsetName("ab", "feature-b"), util.GetSubsetName("a", "feature-b"), util.GetSubsetName("app", "feature-b"),
+		util.GetSubsetName("ab", "base"), util.GetSubsetName("a", "base"), util.GetSubsetName("app", "base"),
+	})
+	// 不修改应用的subpaths
+	assert.Equal(t, h.sqbapplication.Spec.Subpaths[0].Path, "/a")
+
+	tcpRoutes := h.getOrGenerateTcpRoutes(defaultPlaneRouting(), []string{"feature-b", "base", "feature-a"}, nil)
+	assert.Equal(t, len(tcpRoutes), 3)
+	assert.Equal(t, tcpRoutes[0].Match[0].SourceLabels[entity.PlaneKey], "feature-a")
+	assert.Equal(t, tcpRoutes[2].Route[0].Destination.Subset, util.GetSubsetName("app", "base"))
+}
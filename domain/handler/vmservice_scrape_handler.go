@@ -7,7 +7,6 @@ import (
 	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
 	"github.com/wosai/elastic-env-operator/domain/entity"
 	"github.com/wosai/elastic-env-operator/domain/util"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -33,10 +32,6 @@ func NewGrayVMServiceScrapeHandler(sqbdeployment *qav1alpha1.SQBDeployment, ctx
 
 func (h *vmserviceScrapeHandler) CreateOrUpdate() error {
 	vmservice := &vmv1beta1.VMServiceScrape{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
-	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: vmservice.Namespace, Name: vmservice.Name}, vmservice)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return err
-	}
 
 	vmservice.Spec.TargetLabels = []string{entity.GroupKey}
 	vmservice.Spec.Selector.MatchLabels = map[string]string{
@@ -52,7 +47,7 @@ func (h *vmserviceScrapeHandler) CreateOrUpdate() error {
 	vmservice.Spec.NamespaceSelector.MatchNames = []string{h.sqbapplication.Namespace}
 
 	endpoints := make([]vmv1beta1.Endpoint, 0)
-	if err = json.Unmarshal([]byte(h.sqbapplication.Annotations[entity.ServiceMonitorAnnotationKey]), &endpoints); err != nil {
+	if err := json.Unmarshal([]byte(h.sqbapplication.Annotations[entity.ServiceMonitorAnnotationKey]), &endpoints); err != nil {
 		return err
 	}
 	for i, endpoint := range endpoints {
@@ -60,17 +55,17 @@ func (h *vmserviceScrapeHandler) CreateOrUpdate() error {
 		endpoints[i] = endpoint
 	}
 	vmservice.Spec.Endpoints = endpoints
-	vmservice.Labels = util.MergeStringMap(vmservice.Labels, h.sqbapplication.Labels)
-	return CreateOrUpdate(h.ctx, vmservice)
+	vmservice.Labels = util.MergeStringMap(nil, h.sqbapplication.Labels)
+	return Apply(h.ctx, vmservice)
 }
 
 func (h *vmserviceScrapeHandler) Delete() error {
 	service := &vmv1beta1.VMServiceScrape{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbapplication.Namespace, Name: h.sqbapplication.Name}}
-	return Delete(h.ctx, service)
+	return deleteOrRetain(h.ctx, service, h.sqbapplication)
 }
 
 func (h *vmserviceScrapeHandler) Handle() error {
-	if !entity.ConfigMapData.IsVictoriaMetricsEnable() {
+	if !entity.ConfigMapData.ForNamespace(h.sqbapplication.Namespace).IsVictoriaMetricsEnable() {
 		return nil
 	}
 	if deleted, _ := IsDeleted(h.sqbapplication); deleted {
@@ -83,8 +78,12 @@ func (h *vmserviceScrapeHandler) Handle() error {
 	return h.Delete()
 }
 
+func (h *vmserviceScrapeHandler) ConditionType() string {
+	return qav1alpha1.ConditionScrapeReady
+}
+
 func (h *grayVmServiceScrapeHandler) CreateOrUpdate() error {
-	if entity.ConfigMapData.Env() != entity.ENV_PROD || h.sqbdeployment.Spec.Selector.Plane != h.plane {
+	if entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).Env() != entity.ENV_PROD || h.sqbdeployment.Spec.Selector.Plane != h.plane {
 		return nil
 	}
 	sqbapplication := &qav1alpha1.SQBApplication{}
@@ -94,10 +93,6 @@ func (h *grayVmServiceScrapeHandler) CreateOrUpdate() error {
 	}
 
 	vmservice := &vmv1beta1.VMServiceScrape{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
-	err := k8sclient.Get(h.ctx, client.ObjectKey{Namespace: vmservice.Namespace, Name: vmservice.Name}, vmservice)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return err
-	}
 
 	vmservice.Spec.TargetLabels = []string{entity.GroupKey}
 	vmservice.Spec.Selector.MatchLabels = map[string]string{
@@ -108,7 +103,7 @@ func (h *grayVmServiceScrapeHandler) CreateOrUpdate() error {
 	vmservice.Spec.NamespaceSelector.MatchNames = []string{h.sqbdeployment.Namespace}
 
 	endpoints := make([]vmv1beta1.Endpoint, 0)
-	if err = json.Unmarshal([]byte(sqbapplication.Annotations[entity.ServiceMonitorAnnotationKey]), &endpoints); err != nil {
+	if err := json.Unmarshal([]byte(sqbapplication.Annotations[entity.ServiceMonitorAnnotationKey]), &endpoints); err != nil {
 		return err
 	}
 	for i, endpoint := range endpoints {
@@ -116,17 +111,17 @@ func (h *grayVmServiceScrapeHandler) CreateOrUpdate() error {
 		endpoints[i] = endpoint
 	}
 	vmservice.Spec.Endpoints = endpoints
-	vmservice.Labels = util.MergeStringMap(vmservice.Labels, sqbapplication.Labels)
-	return CreateOrUpdate(h.ctx, vmservice)
+	vmservice.Labels = util.MergeStringMap(nil, sqbapplication.Labels)
+	return Apply(h.ctx, vmservice)
 }
 
 func (h *grayVmServiceScrapeHandler) Delete() error {
 	service := &vmv1beta1.VMServiceScrape{ObjectMeta: metav1.ObjectMeta{Namespace: h.sqbdeployment.Namespace, Name: h.sqbdeployment.Name}}
-	return Delete(h.ctx, service)
+	return deleteOrRetain(h.ctx, service, h.sqbdeployment)
 }
 
 func (h *grayVmServiceScrapeHandler) Handle() error {
-	if !entity.ConfigMapData.IsVictoriaMetricsEnable() {
+	if !entity.ConfigMapData.ForNamespace(h.sqbdeployment.Namespace).IsVictoriaMetricsEnable() {
 		return nil
 	}
 	if deleted, _ := IsDeleted(h.sqbdeployment); deleted {
@@ -2,8 +2,9 @@ package util
 
 import (
 	"crypto/md5"
+	"errors"
 	"fmt"
-	"os"
+	"github.com/wosai/elastic-env-operator/domain/entity"
 	"strings"
 )
 
@@ -29,14 +30,14 @@ func ContainString(list []string, item string) bool {
 	return false
 }
 
-//
-func GetDeleteCheckSum(name string) string {
-	salt := os.Getenv("MD5_SALT")
+// GetDeleteCheckSum 删除注解的checksum，md5(name+salt)，salt来自operator-secret
+func GetDeleteCheckSum(name string) (string, error) {
+	salt := entity.SecretData.Salt()
 	if salt == "" {
-		salt = "0e80b3a3-ad6b-4bc5-a41e-57ea49266417"
+		return "", errors.New("salt is not loaded from operator-secret")
 	}
 	checksum := md5.Sum([]byte(name + salt))
-	return fmt.Sprintf("%x", checksum)
+	return fmt.Sprintf("%x", checksum), nil
 }
 
 func GetSubsetName(service, plane string) string {
@@ -17,19 +17,28 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
 	"github.com/wosai/elastic-env-operator/controllers"
 	"github.com/wosai/elastic-env-operator/domain/entity"
 	"github.com/wosai/elastic-env-operator/domain/handler"
+	"github.com/wosai/elastic-env-operator/domain/util"
+	"github.com/wosai/elastic-env-operator/webhooks"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"net/http"
 	"os"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"strings"
 	"time"
 
 	victoriametrics "github.com/VictoriaMetrics/operator/api/v1beta1"
@@ -57,21 +66,38 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var namespace string
+	var watchNamespaces string
+	var configResyncQPS float64
+	var probeAddr string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
-	flag.StringVar(&namespace, "namespace", "elastic-env-operator-system", "operator manager's namespace")
+	flag.StringVar(&namespace, "namespace", controllers.OperatorNamespace(),
+		"operator manager's namespace, where operator-configmap and operator-secret live")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma separated namespaces to watch, empty means all namespaces. "+
+			"The operator manager's namespace is always watched.")
+	flag.StringVar(&probeAddr, "health-probe-addr", ":8081", "The address the probe endpoint binds to.")
+	flag.Float64Var(&configResyncQPS, "config-resync-qps", 5,
+		"Max objects per second re-reconciled after operator config changes, 0 disables the resync.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New())
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		Port:               9443,
-		LeaderElection:     enableLeaderElection,
-		LeaderElectionID:   "7bea0070.shouqianba.com",
-	})
+	options := ctrl.Options{
+		Scheme:                  scheme,
+		MetricsBindAddress:      metricsAddr,
+		Port:                    9443,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "7bea0070.shouqianba.com",
+		LeaderElectionNamespace: namespace,
+		HealthProbeBindAddress:  probeAddr,
+	}
+	if namespaces := parseWatchNamespaces(watchNamespaces, namespace); len(namespaces) != 0 {
+		setupLog.Info("watch namespaces", "namespaces", namespaces)
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
@@ -81,10 +107,20 @@ func main() {
 	handler.SetK8sLog(ctrl.Log.WithName("domain handler"))
 	handler.SetK8sScheme(mgr.GetScheme())
 
+	configResyncer := controllers.NewConfigResyncer(mgr.GetClient(),
+		ctrl.Log.WithName("controllers").WithName("ConfigResync"), configResyncQPS)
+	if configResyncer != nil {
+		if err = mgr.Add(configResyncer); err != nil {
+			setupLog.Error(err, "unable to add config resyncer")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.SQBDeploymentReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("SQBDeployment"),
-		Scheme: mgr.GetScheme(),
+		Client:         mgr.GetClient(),
+		Log:            ctrl.Log.WithName("controllers").WithName("SQBDeployment"),
+		Scheme:         mgr.GetScheme(),
+		ConfigResyncer: configResyncer,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SQBDeployment")
 		os.Exit(1)
@@ -98,22 +134,52 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controllers.SQBApplicationReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("SQBApplication"),
-		Scheme: mgr.GetScheme(),
+		Client:         mgr.GetClient(),
+		Log:            ctrl.Log.WithName("controllers").WithName("SQBApplication"),
+		Scheme:         mgr.GetScheme(),
+		ConfigResyncer: configResyncer,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SQBApplication")
 		os.Exit(1)
 	}
 
+	// 兼容未安装SQBOperatorConfig CRD的集群，此时只读取operator-configmap
+	operatorConfigEnabled := controllers.OperatorConfigEnabled(mgr.GetRESTMapper())
 	if err = (&controllers.ConfigMapReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("ConfigMap"),
-		Scheme: mgr.GetScheme(),
+		Client:                mgr.GetClient(),
+		Log:                   ctrl.Log.WithName("controllers").WithName("ConfigMap"),
+		Scheme:                mgr.GetScheme(),
+		Namespace:             namespace,
+		OperatorConfigEnabled: operatorConfigEnabled,
+		ConfigResyncer:        configResyncer,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ConfigMap")
 		os.Exit(1)
 	}
+	if operatorConfigEnabled {
+		if err = (&controllers.SQBOperatorConfigReconciler{
+			Client:         mgr.GetClient(),
+			Log:            ctrl.Log.WithName("controllers").WithName("SQBOperatorConfig"),
+			Scheme:         mgr.GetScheme(),
+			Namespace:      namespace,
+			ConfigResyncer: configResyncer,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "SQBOperatorConfig")
+			os.Exit(1)
+		}
+	} else {
+		setupLog.Info("SQBOperatorConfig CRD not found, use operator-configmap only")
+	}
+
+	if err = (&controllers.SecretReconciler{
+		Client:    mgr.GetClient(),
+		Log:       ctrl.Log.WithName("controllers").WithName("Secret"),
+		Scheme:    mgr.GetScheme(),
+		Namespace: namespace,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Secret")
+		os.Exit(1)
+	}
 
 	if err = (&controllers.DeploymentReconciler{
 		Client: mgr.GetClient(),
@@ -124,12 +190,36 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&qav1alpha1.SQBDeployment{}).SetupWebhookWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create webhook", "webhook", "SQBDeployment")
+	webhooks.SetupWebhookWithManager(mgr)
+
+	// 非leader也需要operator配置处理webhook请求，选主之前由loader读取配置
+	if err = mgr.Add(&controllers.OperatorConfigLoader{
+		Client:                mgr.GetClient(),
+		SecretReader:          mgr.GetAPIReader(),
+		Log:                   ctrl.Log.WithName("controllers").WithName("ConfigLoader"),
+		Namespace:             namespace,
+		OperatorConfigEnabled: operatorConfigEnabled,
+		Elected:               mgr.Elected(),
+	}); err != nil {
+		setupLog.Error(err, "unable to add config loader")
 		os.Exit(1)
 	}
 
-	go initConfig(mgr)
+	// 选主成功、cache同步完成并且operator配置加载后才开始处理事件，之前的事件requeue
+	if err = mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return waitForReady(ctx, mgr)
+	})); err != nil {
+		setupLog.Error(err, "unable to add ready runnable")
+		os.Exit(1)
+	}
+	if err = mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+	if err = mgr.AddReadyzCheck("readyz", readyzCheck(mgr)); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
@@ -139,20 +229,51 @@ func main() {
 	}
 }
 
-func initConfig(manager manager.Manager) {
-	<-manager.Elected()
+// 解析需要watch的namespace，为空表示watch所有namespace，否则总是包含operator所在的namespace
+func parseWatchNamespaces(watchNamespaces, operatorNamespace string) []string {
+	namespaces := make([]string, 0)
+	for _, ns := range strings.Split(watchNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" && !util.ContainString(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	if len(namespaces) != 0 && !util.ContainString(namespaces, operatorNamespace) {
+		namespaces = append(namespaces, operatorNamespace)
+	}
+	return namespaces
+}
+
+func waitForReady(ctx context.Context, mgr manager.Manager) error {
 	setupLog.Info("manager become leader")
-	timer := time.NewTimer(60 * time.Second)
-	for {
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		return errors.New("cache not synced")
+	}
+	err := wait.PollImmediateUntil(time.Second, func() (bool, error) {
+		return entity.ConfigMapData.IsInitialized(), nil
+	}, ctx.Done())
+	if err != nil {
+		// manager退出
+		return nil
+	}
+	handler.SetReady(true)
+	setupLog.Info("manager ready")
+	return nil
+}
+
+// 所有pod在operator配置加载后才就绪，leader还需要等待开始处理事件
+func readyzCheck(mgr manager.Manager) healthz.Checker {
+	return func(_ *http.Request) error {
 		if !entity.ConfigMapData.IsInitialized() {
-			select {
-			case <-timer.C:
-				panic("operator configmap is not valid")
-			case <-time.After(time.Second):
-			}
-		} else {
-			timer.Stop()
-			break
+			return errors.New("waiting for operator config")
+		}
+		select {
+		case <-mgr.Elected():
+		default:
+			return nil
+		}
+		if !handler.IsReady() {
+			return errors.New("waiting for cache sync")
 		}
+		return nil
 	}
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestParseWatchNamespaces(t *testing.T) {
+	cases := []struct {
+		name            string
+		watchNamespaces string
+		expected        []string
+	}{
+		{
+			// 不配置时监听所有namespace
+			name:     "empty",
+			expected: []string{},
+		},
+		{
+			name:            "blank",
+			watchNamespaces: " , ,",
+			expected:        []string{},
+		},
+		{
+			name:            "whitespace",
+			watchNamespaces: " qa ,dev, ",
+			expected:        []string{"qa", "dev", "system"},
+		},
+		{
+			name:            "duplicate",
+			watchNamespaces: "qa,dev,qa, dev",
+			expected:        []string{"qa", "dev", "system"},
+		},
+		{
+			// 已经包含operator namespace时不重复添加
+			name:            "operator namespace",
+			watchNamespaces: "system,qa",
+			expected:        []string{"system", "qa"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.DeepEqual(t, parseWatchNamespaces(c.watchNamespaces, "system"), c.expected)
+		})
+	}
+}
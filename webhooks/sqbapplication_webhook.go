@@ -0,0 +1,102 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:verbs=create;update;delete,path=/validate-qa-shouqianba-com-v1alpha1-sqbapplication,mutating=false,failurePolicy=fail,groups=qa.shouqianba.com,resources=sqbapplications,versions=v1alpha1,name=vsqbapplication.kb.io
+
+type sqbApplicationValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+func NewSqbApplicationValidator(client client.Client) *sqbApplicationValidator {
+	return &sqbApplicationValidator{client: client}
+}
+
+func (v *sqbApplicationValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+func (v *sqbApplicationValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	in := &qav1alpha1.SQBApplication{}
+	if req.Operation == admissionv1.Delete {
+		if err := v.decoder.DecodeRaw(req.OldObject, in); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		return validationResponse(in, "SQBApplication", validateDeletion(in, in.Spec.DeletionPolicy))
+	}
+	if err := v.decoder.Decode(req, in); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *qav1alpha1.SQBApplication
+	if req.Operation == admissionv1.Update {
+		old = &qav1alpha1.SQBApplication{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+	return validationResponse(in, "SQBApplication", v.validate(ctx, in, old))
+}
+
+// old为nil表示创建
+func (v *sqbApplicationValidator) validate(_ context.Context, in, old *qav1alpha1.SQBApplication) field.ErrorList {
+	// 正在删除的对象不再校验spec
+	if !in.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	deleted, allErrs := validateDeleteCheckSum(in)
+	if deleted || len(allErrs) != 0 {
+		return allErrs
+	}
+	specPath := field.NewPath("spec")
+	var oldPorts []corev1.ServicePort
+	var oldDeploy *qav1alpha1.DeploySpec
+	if old != nil {
+		oldPorts = old.Spec.Ports
+		oldDeploy = &old.Spec.DeploySpec
+	}
+	allErrs = append(allErrs, validatePorts(in.Spec.Ports, oldPorts, specPath.Child("ports"))...)
+	allErrs = append(allErrs, validateDomains(in, specPath.Child("domains"))...)
+	allErrs = append(allErrs, validateDeploySpec(&in.Spec.DeploySpec, oldDeploy, specPath)...)
+	if in.Spec.PlaneRouting != nil {
+		if err := in.Spec.PlaneRouting.Validate(); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("planeRouting"), in.Spec.PlaneRouting, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+// class和host的组合不能重复，host为空时按configmap中的规则补全
+func validateDomains(in *qav1alpha1.SQBApplication, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	seen := make(map[string]bool)
+	for i, domain := range in.Spec.Domains {
+		idxPath := fldPath.Index(i)
+		if domain.Class == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("class"), ""))
+			continue
+		}
+		host := domain.Host
+		if host == "" {
+			host = entity.ConfigMapData.ForNamespace(in.Namespace).GetDomainNameByClass(in.Name, domain.Class)
+		}
+		key := domain.Class + "/" + host
+		if seen[key] {
+			allErrs = append(allErrs, field.Duplicate(idxPath, key))
+		}
+		seen[key] = true
+	}
+	return allErrs
+}
@@ -0,0 +1,244 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"github.com/wosai/elastic-env-operator/domain/handler"
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:verbs=create;update,path=/mutate-qa-shouqianba-com-v1alpha1-sqbdeployment,mutating=true,failurePolicy=fail,groups=qa.shouqianba.com,resources=sqbdeployments,versions=v1alpha1,name=msqbdeployment.kb.io
+
+type sqbDeploymentDefaulter struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+func NewSqbDeploymentDefaulter(client client.Client) *sqbDeploymentDefaulter {
+	return &sqbDeploymentDefaulter{client: client}
+}
+
+func (d *sqbDeploymentDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+func (d *sqbDeploymentDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	in := &qav1alpha1.SQBDeployment{}
+	if err := d.decoder.Decode(req, in); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := d.setDefault(ctx, in); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	marshaled, err := json.Marshal(in)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// 补充plane默认值，根据selector和SQBApplication设置label，设置指向SQBApplication和SQBPlane的owner reference。
+// 正在删除的SQBApplication和SQBPlane不再设置，Orphan时operator会去掉已有的owner reference
+func (d *sqbDeploymentDefaulter) setDefault(ctx context.Context, in *qav1alpha1.SQBDeployment) error {
+	if !in.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	if in.Spec.Selector.Plane == "" {
+		in.Spec.Selector.Plane = entity.ConfigMapData.ForNamespace(in.Namespace).BaseFlag()
+	}
+	if in.Labels == nil {
+		in.Labels = make(map[string]string)
+	}
+	if in.Spec.Selector.App != "" {
+		in.Labels[entity.AppKey] = in.Spec.Selector.App
+	}
+	if in.Spec.Selector.Plane != "" {
+		in.Labels[entity.PlaneKey] = in.Spec.Selector.Plane
+	}
+
+	// SQBApplication或SQBPlane不存在时由validating webhook拒绝
+	sqbapplication := &qav1alpha1.SQBApplication{}
+	if err := d.client.Get(ctx, types.NamespacedName{Namespace: in.Namespace, Name: in.Spec.Selector.App}, sqbapplication); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+	} else {
+		if group, ok := sqbapplication.Labels[entity.GroupKey]; ok {
+			in.Labels[entity.GroupKey] = group
+		}
+		if sqbapplication.DeletionTimestamp.IsZero() {
+			if err = controllerutil.SetOwnerReference(sqbapplication, in, d.client.Scheme()); err != nil {
+				return err
+			}
+		}
+	}
+	sqbplane := &qav1alpha1.SQBPlane{}
+	if err := d.client.Get(ctx, types.NamespacedName{Namespace: in.Namespace, Name: in.Spec.Selector.Plane}, sqbplane); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+	} else if sqbplane.DeletionTimestamp.IsZero() {
+		if err = controllerutil.SetOwnerReference(sqbplane, in, d.client.Scheme()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:verbs=create;update;delete,path=/validate-qa-shouqianba-com-v1alpha1-sqbdeployment,mutating=false,failurePolicy=fail,groups=qa.shouqianba.com,resources=sqbdeployments,versions=v1alpha1,name=vsqbdeployment.kb.io
+
+type sqbDeploymentValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+func NewSqbDeploymentValidator(client client.Client) *sqbDeploymentValidator {
+	return &sqbDeploymentValidator{client: client}
+}
+
+func (v *sqbDeploymentValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+func (v *sqbDeploymentValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	in := &qav1alpha1.SQBDeployment{}
+	if req.Operation == admissionv1.Delete {
+		if err := v.decoder.DecodeRaw(req.OldObject, in); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		return validationResponse(in, "SQBDeployment", validateDeletion(in, in.Spec.DeletionPolicy))
+	}
+	if err := v.decoder.Decode(req, in); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var old *qav1alpha1.SQBDeployment
+	if req.Operation == admissionv1.Update {
+		old = &qav1alpha1.SQBDeployment{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+	allErrs, err := v.validate(ctx, in, old)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return validationResponse(in, "SQBDeployment", allErrs)
+}
+
+// old为nil表示创建
+func (v *sqbDeploymentValidator) validate(ctx context.Context, in, old *qav1alpha1.SQBDeployment) (field.ErrorList, error) {
+	if !in.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	deleted, allErrs := validateDeleteCheckSum(in)
+	if deleted || len(allErrs) != 0 {
+		return allErrs, nil
+	}
+	specPath := field.NewPath("spec")
+	selectorPath := specPath.Child("selector")
+	if old != nil && in.Spec.Selector != old.Spec.Selector {
+		allErrs = append(allErrs, field.Forbidden(selectorPath, "field is immutable"))
+	}
+	var oldDeploy *qav1alpha1.DeploySpec
+	if old != nil {
+		oldDeploy = &old.Spec.DeploySpec
+	}
+	allErrs = append(allErrs, validateDeploySpec(&in.Spec.DeploySpec, oldDeploy, specPath)...)
+	if in.Spec.Canary != nil && in.Spec.Selector.Plane == entity.ConfigMapData.ForNamespace(in.Namespace).BaseFlag() {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("canary"), "canary is not allowed in base plane"))
+	}
+	if in.Spec.Canary != nil && in.Spec.Canary.Analysis != nil {
+		analysisPath := specPath.Child("canary", "analysis")
+		allErrs = append(allErrs, validateCanaryAnalysis(in.Spec.Canary.Analysis, analysisPath)...)
+		// 没有canaryMetricsAddress时无法分析，已经配置了analysis的对象由handler停在当前步骤
+		if (old == nil || old.Spec.Canary == nil || old.Spec.Canary.Analysis == nil) &&
+			entity.ConfigMapData.ForNamespace(in.Namespace).CanaryMetricsAddress() == "" {
+			allErrs = append(allErrs, field.Forbidden(analysisPath, "canaryMetricsAddress is not configured in the operator config"))
+		}
+	}
+
+	// selector不可修改，只在创建时校验SQBApplication和SQBPlane是否存在。
+	// Orphan删除后保留的SQBDeployment、没有SQBPlane的旧对象以及operator自己的更新都不能被拒绝
+	sqbapplication := &qav1alpha1.SQBApplication{}
+	if in.Spec.Selector.App == "" {
+		if old == nil {
+			allErrs = append(allErrs, field.Required(selectorPath.Child("app"), ""))
+		}
+	} else if err := v.client.Get(ctx, types.NamespacedName{Namespace: in.Namespace, Name: in.Spec.Selector.App}, sqbapplication); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		if old == nil {
+			allErrs = append(allErrs, field.NotFound(selectorPath.Child("app"), in.Spec.Selector.App))
+		}
+	} else {
+		deploy, err := handler.ResolveDeploySpec(sqbapplication, in)
+		if err != nil {
+			return nil, err
+		}
+		if deploy.Image == "" {
+			allErrs = append(allErrs, field.Required(specPath.Child("image"), "image is empty after merging defaults and SQBApplication"))
+		}
+		// 主容器使用SQBDeployment的名称，sidecar可能继承自SQBApplication
+		for i, sidecar := range deploy.Sidecars {
+			if sidecar.Container.Name == in.Name {
+				allErrs = append(allErrs, field.Invalid(specPath.Child("sidecars").Index(i).Child("container", "name"),
+					sidecar.Container.Name, "must be different from the main container name after merging defaults and SQBApplication"))
+			}
+		}
+		if deploy.AutoscalingEnabled() {
+			autoscalingPath := specPath.Child("autoscaling")
+			autoscaling := deploy.Autoscaling
+			if autoscaling.MaxReplicas < 1 {
+				allErrs = append(allErrs, field.Required(autoscalingPath.Child("maxReplicas"),
+					"maxReplicas is empty after merging defaults and SQBApplication"))
+			} else if autoscaling.MinReplicas != nil && *autoscaling.MinReplicas > autoscaling.MaxReplicas {
+				allErrs = append(allErrs, field.Invalid(autoscalingPath.Child("minReplicas"), *autoscaling.MinReplicas,
+					"must be less than or equal to maxReplicas after merging defaults and SQBApplication"))
+			}
+		}
+	}
+
+	if old != nil {
+		return allErrs, nil
+	}
+	if in.Spec.Selector.Plane == "" {
+		allErrs = append(allErrs, field.Required(selectorPath.Child("plane"), ""))
+	} else if err := v.client.Get(ctx, types.NamespacedName{Namespace: in.Namespace, Name: in.Spec.Selector.Plane}, &qav1alpha1.SQBPlane{}); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		allErrs = append(allErrs, field.NotFound(selectorPath.Child("plane"), in.Spec.Selector.Plane))
+	}
+	return allErrs, nil
+}
+
+func validateCanaryAnalysis(analysis *qav1alpha1.CanaryAnalysis, path *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if analysis.MaxErrorRate == "" && analysis.MaxLatency == nil {
+		allErrs = append(allErrs, field.Required(path, "maxErrorRate or maxLatency is required"))
+	}
+	if analysis.ErrorRateQuery != "" {
+		if err := handler.ValidateCanaryQuery(analysis.ErrorRateQuery); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("errorRateQuery"), analysis.ErrorRateQuery, err.Error()))
+		}
+	}
+	if analysis.LatencyQuery != "" {
+		if err := handler.ValidateCanaryQuery(analysis.LatencyQuery); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("latencyQuery"), analysis.LatencyQuery, err.Error()))
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,71 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:verbs=create;update;delete,path=/validate-qa-shouqianba-com-v1alpha1-sqbplane,mutating=false,failurePolicy=fail,groups=qa.shouqianba.com,resources=sqbplanes,versions=v1alpha1,name=vsqbplane.kb.io
+
+type sqbPlaneValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+func NewSqbPlaneValidator(client client.Client) *sqbPlaneValidator {
+	return &sqbPlaneValidator{client: client}
+}
+
+func (v *sqbPlaneValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+func (v *sqbPlaneValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	in := &qav1alpha1.SQBPlane{}
+	if req.Operation == admissionv1.Delete {
+		if err := v.decoder.DecodeRaw(req.OldObject, in); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		return validationResponse(in, "SQBPlane", validateDeletion(in, in.Spec.DeletionPolicy))
+	}
+	if err := v.decoder.Decode(req, in); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	return validationResponse(in, "SQBPlane", v.validate(ctx, in))
+}
+
+func (v *sqbPlaneValidator) validate(_ context.Context, in *qav1alpha1.SQBPlane) field.ErrorList {
+	if !in.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	deleted, allErrs := validateDeleteCheckSum(in)
+	if deleted || len(allErrs) != 0 {
+		return allErrs
+	}
+	specPath := field.NewPath("spec")
+	if in.Spec.TTL != nil && in.Spec.TTL.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("ttl"), in.Spec.TTL.String(), "must be positive"))
+	}
+	if in.Spec.IdleTimeout != nil && in.Spec.IdleTimeout.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("idleTimeout"), in.Spec.IdleTimeout.String(), "must be positive"))
+	}
+	if in.Spec.CloneFrom == in.Name {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("cloneFrom"), in.Spec.CloneFrom, "can not clone from itself"))
+	}
+	if renew, ok := in.Annotations[entity.LeaseRenewAnnotationKey]; ok {
+		if _, err := time.Parse(time.RFC3339, renew); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("metadata", "annotations").Key(entity.LeaseRenewAnnotationKey),
+				renew, "must be RFC3339 time"))
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,186 @@
+package webhooks
+
+import (
+	"fmt"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"github.com/wosai/elastic-env-operator/domain/handler"
+	"github.com/wosai/elastic-env-operator/domain/util"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"reflect"
+	"regexp"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"strconv"
+)
+
+// port name命名规则：{istio支持的protocol}-{port}
+var portNameRegexp = regexp.MustCompile(`^(?i:http|http2|https|grpc|grpc-web|tcp|tls|mongo|mysql|redis|udp)-([0-9]+)$`)
+
+// SetupWebhookWithManager 注册SQBApplication、SQBDeployment和SQBPlane的webhook
+func SetupWebhookWithManager(mgr ctrl.Manager) {
+	server := mgr.GetWebhookServer()
+	server.Register("/validate-qa-shouqianba-com-v1alpha1-sqbapplication",
+		&webhook.Admission{Handler: NewSqbApplicationValidator(mgr.GetClient())})
+	server.Register("/mutate-qa-shouqianba-com-v1alpha1-sqbdeployment",
+		&webhook.Admission{Handler: NewSqbDeploymentDefaulter(mgr.GetClient())})
+	server.Register("/validate-qa-shouqianba-com-v1alpha1-sqbdeployment",
+		&webhook.Admission{Handler: NewSqbDeploymentValidator(mgr.GetClient())})
+	server.Register("/validate-qa-shouqianba-com-v1alpha1-sqbplane",
+		&webhook.Admission{Handler: NewSqbPlaneValidator(mgr.GetClient())})
+}
+
+// 校验删除注解，返回是否明确删除
+func validateDeleteCheckSum(obj metav1.Object) (bool, field.ErrorList) {
+	deleteCheckSum, ok := obj.GetAnnotations()[entity.ExplicitDeleteAnnotationKey]
+	if !ok {
+		return false, nil
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(entity.ExplicitDeleteAnnotationKey)
+	checksum, err := util.GetDeleteCheckSum(obj.GetName())
+	if err != nil {
+		return false, field.ErrorList{field.InternalError(fldPath, err)}
+	}
+	if deleteCheckSum != checksum {
+		return false, field.ErrorList{field.Invalid(fldPath, deleteCheckSum, "delete checksum is wrong")}
+	}
+	return true, nil
+}
+
+// deletionPolicy为Protect的对象，只有带正确的删除注解才允许删除
+func validateDeletion(obj metav1.Object, policy qav1alpha1.DeletionPolicy) field.ErrorList {
+	if policy != qav1alpha1.DeletionPolicyProtect {
+		return nil
+	}
+	deleted, allErrs := validateDeleteCheckSum(obj)
+	if deleted || len(allErrs) != 0 {
+		return allErrs
+	}
+	return field.ErrorList{field.Forbidden(field.NewPath("spec", "deletionPolicy"),
+		"deletion is protected, change deletionPolicy or add annotation "+entity.ExplicitDeleteAnnotationKey)}
+}
+
+// 更新时不校验没有修改过的port，兼容校验规则上线前创建的对象
+func validatePorts(ports, oldPorts []corev1.ServicePort, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, port := range ports {
+		if containPort(oldPorts, port) {
+			continue
+		}
+		idxPath := fldPath.Index(i).Child("name")
+		matches := portNameRegexp.FindStringSubmatch(port.Name)
+		if matches == nil {
+			allErrs = append(allErrs, field.Invalid(idxPath, port.Name, "must match {protocol}-{port}"))
+			continue
+		}
+		number, _ := strconv.Atoi(matches[1])
+		if int32(number) != port.Port && int32(number) != port.TargetPort.IntVal {
+			allErrs = append(allErrs, field.Invalid(idxPath, port.Name,
+				fmt.Sprintf("port in name must be %d or %d", port.Port, port.TargetPort.IntVal)))
+		}
+	}
+	return allErrs
+}
+
+func containPort(ports []corev1.ServicePort, port corev1.ServicePort) bool {
+	for _, p := range ports {
+		if reflect.DeepEqual(p, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// old为nil表示创建，更新时不校验没有修改过的volume
+func validateDeploySpec(deploy, old *qav1alpha1.DeploySpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, volume := range deploy.Volumes {
+		if old != nil && containVolume(old.Volumes, volume) {
+			continue
+		}
+		idxPath := fldPath.Child("volumes").Index(i)
+		if volume == nil {
+			allErrs = append(allErrs, field.Required(idxPath, ""))
+			continue
+		}
+		if volume.MountPath == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("mountPath"), ""))
+		}
+		sources := 0
+		for _, set := range []bool{
+			volume.HostPath != "",
+			volume.ConfigMap != "",
+			volume.Secret != "",
+			volume.EmptyDir,
+			volume.PersistentVolumeClaim || volume.PersistentVolumeClaimName != "",
+			len(volume.DownwardAPI) != 0,
+		} {
+			if set {
+				sources++
+			}
+		}
+		if sources != 1 {
+			allErrs = append(allErrs, field.Invalid(idxPath, volume.MountPath,
+				"must specify exactly one of hostPath, configMap, secret, emptyDir, persistentVolumeClaim, downwardAPI"))
+		}
+	}
+	if deploy.AutoscalingEnabled() {
+		// autoscaling逐个字段继承，maxReplicas在合并之后校验
+		autoscaling := deploy.Autoscaling
+		if autoscaling.MaxReplicas > 0 && autoscaling.MinReplicas != nil && *autoscaling.MinReplicas > autoscaling.MaxReplicas {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("autoscaling", "minReplicas"), *autoscaling.MinReplicas,
+				"must be less than or equal to maxReplicas"))
+		}
+	}
+	names := make(map[string]bool)
+	for i, sidecar := range deploy.Sidecars {
+		idxPath := fldPath.Child("sidecars").Index(i).Child("container")
+		if sidecar.Container.Name == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("name"), ""))
+		} else if names[sidecar.Container.Name] {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), sidecar.Container.Name))
+		} else if sidecar.Container.Name == handler.InitContainerName {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("name"), sidecar.Container.Name,
+				"name is reserved for the init container"))
+		}
+		names[sidecar.Container.Name] = true
+		if sidecar.Container.Image == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("image"), ""))
+		}
+	}
+	if deploy.DisruptionBudgetEnabled() {
+		budget := deploy.DisruptionBudget
+		if budget.MinAvailable != nil && budget.MaxUnavailable != nil {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("disruptionBudget", "maxUnavailable"),
+				"minAvailable and maxUnavailable cannot be both set"))
+		}
+	}
+	return allErrs
+}
+
+func containVolume(volumes []*qav1alpha1.VolumeSpec, volume *qav1alpha1.VolumeSpec) bool {
+	for _, v := range volumes {
+		if reflect.DeepEqual(v, volume) {
+			return true
+		}
+	}
+	return false
+}
+
+func validationResponse(obj metav1.Object, kind string, allErrs field.ErrorList) admission.Response {
+	if len(allErrs) == 0 {
+		return admission.Allowed("")
+	}
+	status := apierrors.NewInvalid(qav1alpha1.GroupVersion.WithKind(kind).GroupKind(), obj.GetName(), allErrs).Status()
+	return admission.Response{
+		AdmissionResponse: admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result:  &status,
+		},
+	}
+}
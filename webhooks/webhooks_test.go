@@ -0,0 +1,308 @@
+package webhooks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	qav1alpha1 "github.com/wosai/elastic-env-operator/api/v1alpha1"
+	"github.com/wosai/elastic-env-operator/domain/entity"
+	"github.com/wosai/elastic-env-operator/domain/util"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = qav1alpha1.AddToScheme(scheme)
+	return scheme
+}
+
+func TestValidatePorts(t *testing.T) {
+	ports := []corev1.ServicePort{
+		{Name: "http-80", Port: 80, TargetPort: intstr.FromInt(8080)},
+		{Name: "grpc-8081", Port: 81, TargetPort: intstr.FromInt(8081)},
+		{Name: "http", Port: 82},
+		{Name: "tcp-90", Port: 83, TargetPort: intstr.FromInt(8083)},
+	}
+	allErrs := validatePorts(ports, nil, nil)
+	assert.Equal(t, len(allErrs), 2)
+	assert.Equal(t, allErrs[0].Field, "[2].name")
+	assert.Equal(t, allErrs[1].Field, "[3].name")
+
+	// 更新时只校验修改过的port
+	oldPorts := []corev1.ServicePort{ports[2], {Name: "tcp-90", Port: 83}}
+	allErrs = validatePorts(ports, oldPorts, nil)
+	assert.Equal(t, len(allErrs), 1)
+	assert.Equal(t, allErrs[0].Field, "[3].name")
+}
+
+func TestSqbApplicationValidate(t *testing.T) {
+	entity.SecretData.FromMap(map[string][]byte{"salt": []byte("salt")})
+	entity.ConfigMapData.FromMap(map[string]string{"domainPostfix": `{"public": "*.example.com"}`})
+	v := NewSqbApplicationValidator(fake.NewClientBuilder().WithScheme(newScheme()).Build())
+	in := &qav1alpha1.SQBApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: qav1alpha1.SQBApplicationSpec{
+			IngressSpec: qav1alpha1.IngressSpec{Domains: []qav1alpha1.Domain{
+				{Class: "public"},
+				{Class: "public", Host: "app.example.com"},
+			}},
+			ServiceSpec: qav1alpha1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http-80", Port: 80}}},
+			DeploySpec: qav1alpha1.DeploySpec{Volumes: []*qav1alpha1.VolumeSpec{
+				{MountPath: "/data", EmptyDir: true, ConfigMap: "config"},
+			}},
+			PlaneRouting: &qav1alpha1.PlaneRoutingSpec{PropagateHeaders: []string{""}},
+		},
+	}
+	allErrs := v.validate(context.Background(), in, nil)
+	assert.Equal(t, len(allErrs), 3)
+	assert.Equal(t, allErrs[0].Field, "spec.domains[1]")
+	assert.Equal(t, allErrs[1].Field, "spec.volumes[0]")
+	assert.Equal(t, allErrs[2].Field, "spec.planeRouting")
+
+	// 错误的删除注解
+	in.Annotations = map[string]string{entity.ExplicitDeleteAnnotationKey: "wrong"}
+	allErrs = v.validate(context.Background(), in, nil)
+	assert.Equal(t, len(allErrs), 1)
+
+	// 正确的删除注解跳过其他校验
+	in.Annotations[entity.ExplicitDeleteAnnotationKey], _ = util.GetDeleteCheckSum(in.Name)
+	allErrs = v.validate(context.Background(), in, nil)
+	assert.Equal(t, len(allErrs), 0)
+
+	// 更新时不校验没有修改过的volume
+	in.Annotations = nil
+	old := in.DeepCopy()
+	allErrs = v.validate(context.Background(), in, old)
+	assert.Equal(t, len(allErrs), 2)
+	assert.Equal(t, allErrs[0].Field, "spec.domains[1]")
+	assert.Equal(t, allErrs[1].Field, "spec.planeRouting")
+	in.Spec.Volumes[0].MountPath = "/data2"
+	allErrs = v.validate(context.Background(), in, old)
+	assert.Equal(t, len(allErrs), 3)
+	assert.Equal(t, allErrs[1].Field, "spec.volumes[0]")
+}
+
+func TestSqbDeploymentValidate(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{})
+	sqbapplication := &qav1alpha1.SQBApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+	}
+	sqbplane := &qav1alpha1.SQBPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "base", Namespace: "default"},
+	}
+	v := NewSqbDeploymentValidator(fake.NewClientBuilder().WithScheme(newScheme()).
+		WithObjects(sqbapplication, sqbplane).Build())
+	in := &qav1alpha1.SQBDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-base", Namespace: "default"},
+		Spec: qav1alpha1.SQBDeploymentSpec{
+			Selector: qav1alpha1.Selector{App: "app", Plane: "base"},
+		},
+	}
+
+	allErrs, err := v.validate(context.Background(), in, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(allErrs), 1)
+	assert.Equal(t, allErrs[0].Field, "spec.image")
+
+	in.Spec.Image = "nginx"
+	allErrs, err = v.validate(context.Background(), in, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(allErrs), 0)
+
+	// 基础环境不能灰度
+	in.Spec.Canary = &qav1alpha1.CanarySpec{Steps: []qav1alpha1.CanaryStep{{Weight: 10}}}
+	allErrs, err = v.validate(context.Background(), in, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(allErrs), 1)
+	assert.Equal(t, allErrs[0].Field, "spec.canary")
+
+	// 没有配置canaryMetricsAddress时不能新增analysis
+	in.Spec.Canary.Analysis = &qav1alpha1.CanaryAnalysis{MaxErrorRate: "1"}
+	allErrs, err = v.validate(context.Background(), in, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(allErrs), 2)
+	assert.Equal(t, allErrs[1].Field, "spec.canary.analysis")
+	allErrs, err = v.validate(context.Background(), in, in.DeepCopy())
+	assert.NilError(t, err)
+	assert.Equal(t, len(allErrs), 1)
+	in.Spec.Canary = nil
+
+	// 合并SQBApplication之后maxReplicas不能为空
+	in.Spec.Autoscaling = &qav1alpha1.AutoscalingSpec{MinReplicas: proto.Int32(2)}
+	allErrs, err = v.validate(context.Background(), in, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(allErrs), 1)
+	assert.Equal(t, allErrs[0].Field, "spec.autoscaling.maxReplicas")
+	in.Spec.Autoscaling = nil
+
+	// sidecar不能和主容器同名
+	in.Spec.Sidecars = []qav1alpha1.SidecarSpec{{Container: corev1.Container{Name: "app-base", Image: "proxy"}}}
+	allErrs, err = v.validate(context.Background(), in, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(allErrs), 1)
+	assert.Equal(t, allErrs[0].Field, "spec.sidecars[0].container.name")
+	in.Spec.Sidecars = nil
+
+	old := in.DeepCopy()
+	in.Spec.Selector = qav1alpha1.Selector{App: "app2", Plane: "test"}
+	allErrs, err = v.validate(context.Background(), in, old)
+	assert.NilError(t, err)
+	assert.Equal(t, len(allErrs), 1)
+	assert.Equal(t, allErrs[0].Field, "spec.selector")
+	allErrs, err = v.validate(context.Background(), in, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(allErrs), 2)
+	assert.Equal(t, allErrs[0].Field, "spec.selector.app")
+	assert.Equal(t, allErrs[1].Field, "spec.selector.plane")
+
+	// SQBApplication和SQBPlane删除后保留的SQBDeployment可以修改
+	orphan := &qav1alpha1.SQBDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app3-feature", Namespace: "default"},
+		Spec: qav1alpha1.SQBDeploymentSpec{
+			Selector: qav1alpha1.Selector{App: "app3", Plane: "feature"},
+		},
+	}
+	old = orphan.DeepCopy()
+	orphan.Spec.Image = "nginx:v2"
+	allErrs, err = v.validate(context.Background(), orphan, old)
+	assert.NilError(t, err)
+	assert.Equal(t, len(allErrs), 0)
+}
+
+func TestSqbDeploymentSetDefault(t *testing.T) {
+	entity.ConfigMapData.FromMap(map[string]string{"baseFlag": "base"})
+	sqbapplication := &qav1alpha1.SQBApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "app-uid",
+			Labels: map[string]string{entity.GroupKey: "group"}},
+	}
+	sqbplane := &qav1alpha1.SQBPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "base", Namespace: "default", UID: "plane-uid"},
+	}
+	d := NewSqbDeploymentDefaulter(fake.NewClientBuilder().WithScheme(newScheme()).
+		WithObjects(sqbapplication, sqbplane).Build())
+	in := &qav1alpha1.SQBDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-base", Namespace: "default",
+			Labels: map[string]string{entity.AppKey: "other"}},
+		Spec: qav1alpha1.SQBDeploymentSpec{
+			Selector: qav1alpha1.Selector{App: "app"},
+		},
+	}
+
+	assert.NilError(t, d.setDefault(context.Background(), in))
+	assert.Equal(t, in.Spec.Selector.Plane, "base")
+	assert.DeepEqual(t, in.Labels, map[string]string{
+		entity.AppKey:   "app",
+		entity.PlaneKey: "base",
+		entity.GroupKey: "group",
+	})
+	assert.Equal(t, len(in.OwnerReferences), 2)
+	assert.Equal(t, in.OwnerReferences[0].Kind, "SQBApplication")
+	assert.Equal(t, in.OwnerReferences[1].Kind, "SQBPlane")
+
+	// 重复执行不会重复添加owner reference
+	assert.NilError(t, d.setDefault(context.Background(), in))
+	assert.Equal(t, len(in.OwnerReferences), 2)
+
+	// 正在删除的SQBPlane不添加owner reference
+	now := metav1.Now()
+	sqbplane.DeletionTimestamp = &now
+	sqbplane.Finalizers = []string{entity.FINALIZER}
+	d = NewSqbDeploymentDefaulter(fake.NewClientBuilder().WithScheme(newScheme()).
+		WithObjects(sqbapplication, sqbplane).Build())
+	in.OwnerReferences = nil
+	assert.NilError(t, d.setDefault(context.Background(), in))
+	assert.Equal(t, len(in.OwnerReferences), 1)
+	assert.Equal(t, in.OwnerReferences[0].Kind, "SQBApplication")
+}
+
+func TestValidateDeletion(t *testing.T) {
+	entity.SecretData.FromMap(map[string][]byte{"salt": []byte("salt")})
+	in := &qav1alpha1.SQBPlane{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}}
+	assert.Equal(t, len(validateDeletion(in, qav1alpha1.DeletionPolicyDelete)), 0)
+	assert.Equal(t, len(validateDeletion(in, qav1alpha1.DeletionPolicyOrphan)), 0)
+
+	allErrs := validateDeletion(in, qav1alpha1.DeletionPolicyProtect)
+	assert.Equal(t, len(allErrs), 1)
+	assert.Equal(t, allErrs[0].Field, "spec.deletionPolicy")
+
+	checksum, _ := util.GetDeleteCheckSum(in.Name)
+	in.Annotations = map[string]string{entity.ExplicitDeleteAnnotationKey: checksum}
+	assert.Equal(t, len(validateDeletion(in, qav1alpha1.DeletionPolicyProtect)), 0)
+
+	// salt未加载时不允许通过删除注解删除
+	entity.SecretData.FromMap(nil)
+	assert.Equal(t, len(validateDeletion(in, qav1alpha1.DeletionPolicyProtect)), 1)
+}
+
+func TestValidateDeploySpecAutoscaling(t *testing.T) {
+	path := field.NewPath("spec")
+	// maxReplicas可以从SQBApplication继承，合并之后再校验
+	deploy := &qav1alpha1.DeploySpec{Autoscaling: &qav1alpha1.AutoscalingSpec{MinReplicas: proto.Int32(3)}}
+	assert.Equal(t, len(validateDeploySpec(deploy, nil, path)), 0)
+
+	deploy.Autoscaling.MaxReplicas = 2
+	allErrs := validateDeploySpec(deploy, nil, path)
+	assert.Equal(t, len(allErrs), 1)
+	assert.Equal(t, allErrs[0].Field, "spec.autoscaling.minReplicas")
+
+	deploy.Autoscaling.MinReplicas = proto.Int32(2)
+	assert.Equal(t, len(validateDeploySpec(deploy, nil, path)), 0)
+	// 不启用时不校验
+	assert.Equal(t, len(validateDeploySpec(&qav1alpha1.DeploySpec{
+		Autoscaling: &qav1alpha1.AutoscalingSpec{Disabled: true}}, nil, path)), 0)
+}
+
+func TestValidateDeploySpecDisruptionBudget(t *testing.T) {
+	path := field.NewPath("spec")
+	minAvailable, maxUnavailable := intstr.FromInt(1), intstr.FromString("50%")
+	deploy := &qav1alpha1.DeploySpec{DisruptionBudget: &qav1alpha1.DisruptionBudgetSpec{
+		MinAvailable: &minAvailable, MaxUnavailable: &maxUnavailable}}
+	allErrs := validateDeploySpec(deploy, nil, path)
+	assert.Equal(t, len(allErrs), 1)
+	assert.Equal(t, allErrs[0].Field, "spec.disruptionBudget.maxUnavailable")
+
+	deploy.DisruptionBudget.MaxUnavailable = nil
+	assert.Equal(t, len(validateDeploySpec(deploy, nil, path)), 0)
+}
+
+func TestValidateDeploySpecSidecars(t *testing.T) {
+	path := field.NewPath("spec")
+	deploy := &qav1alpha1.DeploySpec{Sidecars: []qav1alpha1.SidecarSpec{
+		{Container: corev1.Container{Name: "proxy", Image: "proxy:v1"}},
+		{Container: corev1.Container{Name: "proxy", Image: "proxy:v2"}},
+		{Container: corev1.Container{}},
+		// 初始化容器的名称
+		{Container: corev1.Container{Name: "init0", Image: "busybox"}},
+	}}
+	allErrs := validateDeploySpec(deploy, nil, path)
+	assert.Equal(t, len(allErrs), 4)
+	assert.Equal(t, allErrs[0].Field, "spec.sidecars[1].container.name")
+	assert.Equal(t, allErrs[1].Field, "spec.sidecars[2].container.name")
+	assert.Equal(t, allErrs[2].Field, "spec.sidecars[2].container.image")
+	assert.Equal(t, allErrs[3].Field, "spec.sidecars[3].container.name")
+}
+
+func TestValidateCanaryAnalysis(t *testing.T) {
+	path := field.NewPath("spec", "canary", "analysis")
+	analysis := &qav1alpha1.CanaryAnalysis{}
+	allErrs := validateCanaryAnalysis(analysis, path)
+	assert.Equal(t, len(allErrs), 1)
+	assert.Equal(t, allErrs[0].Field, "spec.canary.analysis")
+
+	analysis.MaxErrorRate = "1"
+	analysis.ErrorRateQuery = `sum(rate(http_errors{app="{{.App}}"}[{{.Interval}}]))`
+	analysis.LatencyQuery = `max(latency{namespace="{{.Namespace}}",plane="{{.Plane}}"})`
+	allErrs = validateCanaryAnalysis(analysis, path)
+	assert.Equal(t, len(allErrs), 1)
+	assert.Equal(t, allErrs[0].Field, "spec.canary.analysis.errorRateQuery")
+
+	analysis.ErrorRateQuery = `sum(rate(http_errors{app="{{.Name}}"}[{{.Interval}}]))`
+	assert.Equal(t, len(validateCanaryAnalysis(analysis, path)), 0)
+}